@@ -0,0 +1,125 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Errors from the checks made before mounting, so that each failure can be told apart.
+var (
+	errBackingDirMissing    = errors.New("backing-dir does not exist")
+	errBackingDirNotDir     = errors.New("backing-dir is not a directory")
+	errBackingDirUnreadable = errors.New("backing-dir is not readable")
+	errMountDirMissing      = errors.New("mount-dir does not exist")
+	errMountDirNotDir       = errors.New("mount-dir is not a directory")
+	errMountDirNotEmpty     = errors.New("mount-dir is not empty")
+	errSecureModeNotRoot    = errors.New("secure mode requires root privileges")
+)
+
+// preMountCheck is the outcome of one of the checks --dry-run makes.
+type preMountCheck struct {
+	name string
+	err  error
+}
+
+// checkBackingDir returns an error if dir doesn't exist, isn't a directory or can't be listed.
+func checkBackingDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", errBackingDirMissing, dir)
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", errBackingDirUnreadable, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", errBackingDirNotDir, dir)
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBackingDirUnreadable, err)
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("%w: %v", errBackingDirUnreadable, err)
+	}
+	return nil
+}
+
+// checkMountDir returns an error if dir can't be mounted on: it doesn't exist, isn't a directory,
+// or, unless force is set, isn't empty.
+func checkMountDir(dir string, force bool) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", errMountDirMissing, dir)
+	} else if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", errMountDirNotDir, dir)
+	}
+	if force {
+		return nil
+	}
+	if err := checkMountDirEmpty(dir); err != nil {
+		return fmt.Errorf("%w; pass --force to mount over it anyway", err)
+	}
+	return nil
+}
+
+// checkSecureMode returns an error if secure mode can't move the backing directory away.
+func checkSecureMode() error {
+	if os.Geteuid() != 0 {
+		return errSecureModeNotRoot
+	}
+	return nil
+}
+
+// mountChecks makes the checks needed to mount backingDir on mountDir. In secure mode with
+// backing-dir as mount-dir, the mount point is created after moving the contents away, so it isn't
+// checked.
+func mountChecks(backingDir, mountDir string, secureMode, force bool) []preMountCheck {
+	checks := []preMountCheck{{"backing-dir " + backingDir, checkBackingDir(backingDir)}}
+	if secureMode {
+		checks = append(checks, preMountCheck{"secure-mode", checkSecureMode()})
+	}
+	if !(secureMode && backingDir == mountDir) {
+		checks = append(checks, preMountCheck{"mount-dir " + mountDir, checkMountDir(mountDir, force)})
+	}
+	return checks
+}
+
+// reportDryRun prints the outcome of each check and returns the status to exit with: 0 if every
+// check passed, or 1 otherwise.
+func reportDryRun(checks []preMountCheck) int {
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			fmt.Printf("FAIL %s: %v\n", c.name, c.err)
+			failed++
+		} else {
+			fmt.Printf("ok   %s\n", c.name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("Dry run: %d of %d checks failed, not mounting\n", failed, len(checks))
+		return 1
+	}
+	fmt.Printf("Dry run: all %d checks passed, not mounting\n", len(checks))
+	return 0
+}
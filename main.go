@@ -15,17 +15,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"slowfs/slowfs"
 	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/metrics"
 	"slowfs/slowfs/scheduler"
 	"slowfs/slowfs/units"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -43,12 +56,50 @@ func getDirectoryOwner(dirPath string) (uint32, uint32, error) {
 	return stat.Uid, stat.Gid, nil
 }
 
+// backingInode returns the inode of the file at path, or 0 if it can't be found, in which case the
+// scheduler tracks the file by path.
+func backingInode(path string) uint64 {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0
+	}
+	return stat.Ino
+}
+
+// maxListedEntries bounds how many entries of a non-empty mount directory are listed.
+const maxListedEntries = 10
+
+// checkMountDirEmpty returns an error listing what is in mountPath if it is not empty, since
+// mounting over it would hide its contents. A missing directory is left for the mount to report.
+func checkMountDirEmpty(mountPath string) error {
+	dir, err := os.Open(mountPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(maxListedEntries + 1)
+	if err == io.EOF || len(names) == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	listed := strings.Join(names, ", ")
+	if len(names) > maxListedEntries {
+		listed = strings.Join(names[:maxListedEntries], ", ") + ", ..."
+	}
+	return fmt.Errorf("%w: %s (contains %s)", errMountDirNotEmpty, mountPath, listed)
+}
+
 // moveToSecureLocation moves the backing directory to a secure location
 // and returns the new path
 func moveToSecureLocation(originalPath string) (string, error) {
 	// Check if we're running as root
-	if os.Geteuid() != 0 {
-		return "", fmt.Errorf("secure mode requires root privileges")
+	if err := checkSecureMode(); err != nil {
+		return "", err
 	}
 
 	// Create secure directory if it doesn't exist
@@ -124,25 +175,365 @@ func forceUnmount(mountPath string) error {
 	return nil
 }
 
+// parseInitialDirty parses a comma separated list of path=size pairs, giving how much unflushed
+// data each file should start out with in the write back cache.
+func parseInitialDirty(spec string) (map[string]units.NumBytes, error) {
+	dirty := make(map[string]units.NumBytes)
+	for _, entry := range strings.Split(spec, ",") {
+		pathAndSize := strings.SplitN(entry, "=", 2)
+		if len(pathAndSize) != 2 {
+			return nil, fmt.Errorf("want path=size, got %q", entry)
+		}
+		size, err := units.ParseNumBytesFromString(pathAndSize[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", pathAndSize[0], err)
+		}
+		// Paths are relative to the mount, as the scheduler sees them.
+		dirty[strings.TrimPrefix(filepath.Clean(pathAndSize[0]), "/")] += size
+	}
+	return dirty, nil
+}
+
+// eventQueueSize bounds how many events can wait to be posted. Events beyond it are dropped, since
+// the scheduler can't wait for a slow receiver.
+const eventQueueSize = 100
+
+// postEvents returns an event handler which POSTs each event as JSON to url in the background,
+// and a function which stops posting once queued events have been sent.
+func postEvents(url string) (func(scheduler.Event), func()) {
+	events := make(chan scheduler.Event, eventQueueSize)
+	done := make(chan struct{})
+	client := &http.Client{Timeout: 5 * time.Second}
+	go func() {
+		defer close(done)
+		for ev := range events {
+			body, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("event %s: %s", ev.Type, err)
+				continue
+			}
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("posting event %s: %s", ev.Type, err)
+				continue
+			}
+			resp.Body.Close()
+		}
+	}()
+
+	handler := func(ev scheduler.Event) {
+		select {
+		case events <- ev:
+		default:
+			log.Printf("event queue full, dropping event %s", ev.Type)
+		}
+	}
+	stop := func() {
+		close(events)
+		<-done
+	}
+	return handler, stop
+}
+
+// runSummary is the end of run summary written by --summary-json, and the live stats served by
+// --stats-addr.
+type runSummary struct {
+	Ops                      map[string]uint64         `json:"ops"`
+	BytesRead                int64                     `json:"bytes_read"`
+	BytesWritten             int64                     `json:"bytes_written"`
+	DirtyBytes               int64                     `json:"dirty_bytes"`
+	PeakDirtyBytes           int64                     `json:"peak_dirty_bytes"`
+	BacklogNs                int64                     `json:"backlog_ns"`
+	LatencyNs                map[string]latencySummary `json:"latency_ns"`
+	ReadLatencyTargetMisses  uint64                    `json:"read_latency_target_misses"`
+	WriteLatencyTargetMisses uint64                    `json:"write_latency_target_misses"`
+	TotalInjectedDelayNs     int64                     `json:"total_injected_delay_ns"`
+	Underruns                uint64                    `json:"underruns"`
+}
+
+type latencySummary struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+// writeSummaryJSON writes a summary of the run so far to the file at path.
+func writeSummaryJSON(path string, s *scheduler.Scheduler, slowFs *fuselayer.SlowFs) error {
+	data, err := json.MarshalIndent(summarize(s, slowFs), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// serveStats serves a summary of the run so far as JSON over HTTP at addr, returning the server
+// so it can be shut down.
+func serveStats(addr string, s *scheduler.Scheduler, slowFs *fuselayer.SlowFs) (*http.Server, error) {
+	return serveHTTP(addr, "/stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summarize(s, slowFs)); err != nil {
+			log.Printf("serving stats: %s", err)
+		}
+	}))
+}
+
+// serveHTTP serves handler at path over HTTP at addr in the background, returning the server so
+// it can be shut down.
+func serveHTTP(addr, path string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("http server on %s: %s", addr, err)
+		}
+	}()
+	return server, nil
+}
+
+// shutdownHTTP returns a function which shuts server down once, however many times it's called.
+func shutdownHTTP(server *http.Server) func() {
+	var shutdownOnce sync.Once
+	return func() {
+		shutdownOnce.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down http server: %v", err)
+			}
+		})
+	}
+}
+
+// summarize returns a summary of the run so far.
+func summarize(s *scheduler.Scheduler, slowFs *fuselayer.SlowFs) runSummary {
+	stats := s.Stats()
+	readMisses, writeMisses := s.LatencyTargetMisses()
+	summary := runSummary{
+		Ops:                      stats.Ops,
+		BytesRead:                int64(stats.BytesRead),
+		BytesWritten:             int64(stats.BytesWritten),
+		DirtyBytes:               int64(stats.DirtyBytes),
+		PeakDirtyBytes:           int64(stats.PeakDirtyBytes),
+		BacklogNs:                int64(stats.Backlog),
+		LatencyNs:                make(map[string]latencySummary, len(stats.Latency)),
+		ReadLatencyTargetMisses:  readMisses,
+		WriteLatencyTargetMisses: writeMisses,
+		TotalInjectedDelayNs:     int64(slowFs.TotalInjectedDelay()),
+		Underruns:                slowFs.Underruns(),
+	}
+	for op, l := range stats.Latency {
+		summary.LatencyNs[op] = latencySummary{int64(l.P50), int64(l.P90), int64(l.P99)}
+	}
+	return summary
+}
+
+// parseSeeds parses the global random seed, which is 0 if empty, and a comma separated list of
+// subsystem=seed overrides.
+func parseSeeds(seedSpec, overrideSpec string) (int64, map[string]int64, error) {
+	var seed int64
+	if seedSpec != "" {
+		var err error
+		seed, err = strconv.ParseInt(seedSpec, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("random-seed: %s", err)
+		}
+	}
+	overrides := make(map[string]int64)
+	if overrideSpec == "" {
+		return seed, overrides, nil
+	}
+	for _, entry := range strings.Split(overrideSpec, ",") {
+		nameAndSeed := strings.SplitN(entry, "=", 2)
+		if len(nameAndSeed) != 2 {
+			return 0, nil, fmt.Errorf("subsystem-seeds: want subsystem=seed, got %q", entry)
+		}
+		s, err := strconv.ParseInt(strings.TrimSpace(nameAndSeed[1]), 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("subsystem-seeds: %s: %s", nameAndSeed[0], err)
+		}
+		overrides[strings.TrimSpace(nameAndSeed[0])] = s
+	}
+	return seed, overrides, nil
+}
+
+// labelFlag collects key=value labels from a flag which can be repeated.
+type labelFlag map[string]string
+
+func (l labelFlag) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + l[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelFlag) Set(value string) error {
+	keyAndValue := strings.SplitN(value, "=", 2)
+	if len(keyAndValue) != 2 || keyAndValue[0] == "" {
+		return fmt.Errorf("want key=value, got %q", value)
+	}
+	l[keyAndValue[0]] = keyAndValue[1]
+	return nil
+}
+
+// applyRunConfig sets flags from a JSON object in the file at path, mapping flag names to values.
+// Flags which were given on the command line are left alone, so they override the file.
+func applyRunConfig(path string, flags *flag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "run-config" || flags.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %s", name)
+		}
+		if setOnCommandLine[name] {
+			continue
+		}
+
+		var value string
+		switch v := values[name].(type) {
+		case string:
+			value = v
+		case bool:
+			value = strconv.FormatBool(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("%s: want string, bool or number, got %v", name, v)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// loadConfigs adds the device configs in the file at path to configs. If path is a directory,
+// every *.json, *.yaml and *.yml file in it is loaded. Config names must be unique across all
+// files.
+func loadConfigs(path string, configs map[string]*slowfs.DeviceConfig) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read config file %s: %s", path, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return fmt.Errorf("couldn't list config directory %s: %s", path, err)
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+
+	// Remember where each config came from so duplicates can be reported properly.
+	sources := make(map[string]string)
+	for name := range configs {
+		sources[name] = "built-in configs"
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("couldn't read config file %s: %s", file, err)
+		}
+		parse := slowfs.ParseDeviceConfigsFromJSON
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+			parse = slowfs.ParseDeviceConfigsFromYAML
+		}
+		dcs, err := parse(data)
+		if err != nil {
+			return fmt.Errorf("couldn't parse config file %s: %s", file, err)
+		}
+		for _, dc := range dcs {
+			if source, ok := sources[dc.Name]; ok {
+				if source == file {
+					return fmt.Errorf("duplicate device config with name '%s' in %s", dc.Name, file)
+				}
+				return fmt.Errorf("duplicate device config with name '%s' in %s and %s", dc.Name, source, file)
+			}
+			configs[dc.Name] = dc
+			sources[dc.Name] = file
+		}
+	}
+	return nil
+}
+
+// printMountSettings prints the mount options and the settings negotiated with the kernel, which
+// are known once Mount has returned.
+func printMountSettings(server *fuse.Server, mountOpts *fuse.MountOptions) {
+	kernel := server.KernelSettings()
+	fmt.Printf("Mount options: allow_other=%t options=%s max_write=%d max_readahead=%d max_background=%d\n",
+		mountOpts.AllowOther, strings.Join(mountOpts.Options, ","), mountOpts.MaxWrite,
+		mountOpts.MaxReadAhead, mountOpts.MaxBackground)
+	fmt.Printf("Kernel settings: protocol=%d.%d max_readahead=%d capabilities=0x%x\n",
+		kernel.Major, kernel.Minor, kernel.MaxReadAhead, kernel.Flags64())
+}
+
+// printOpenFiles prints the given open files along with their unflushed data.
+func printOpenFiles(openFiles []fuselayer.OpenFile) {
+	fmt.Printf("%d open file(s):\n", len(openFiles))
+	for _, f := range openFiles {
+		fmt.Printf("  %s (%s dirty)\n", f.Path, f.DirtyBytes)
+	}
+}
+
+// printFileStats prints the access statistics of the n most delayed files.
+func printFileStats(files []scheduler.FileStats, n int) {
+	files = files[:min(n, len(files))]
+	fmt.Printf("%d most delayed file(s):\n", len(files))
+	for _, f := range files {
+		fmt.Printf("  %s: %s delay, %d ops, %d reads (%s), %d writes (%s)\n",
+			f.Path, f.Delay, f.Ops, f.Reads, f.BytesRead, f.Writes, f.BytesWritten)
+	}
+}
+
 // cleanup handles cleanup operations when the program exits
-func cleanup(server *fuse.Server, securePath, originalPath, mountPath string, enableSecureMode bool) {
+func cleanup(server *fuse.Server, securePath, originalPath, mountPath string, enableSecureMode bool, beforeUnmount, afterUnmount []func()) {
 	fmt.Println("Cleaning up...")
+
+	for _, f := range beforeUnmount {
+		f()
+	}
 	
 	// Unmount filesystem with retry mechanism
 	if server != nil {
-		err := server.Unmount()
-		if err != nil {
-			log.Printf("Normal unmount failed: %v", err)
-			
-			// Try force unmount
-			if forceErr := forceUnmount(mountPath); forceErr != nil {
-				log.Printf("ERROR: Force unmount also failed: %v", forceErr)
-			} else {
-				log.Printf("Filesystem forcefully unmounted")
-			}
-		} else {
-			fmt.Println("Filesystem unmounted successfully")
-		}
+		unmount(server, mountPath)
+	}
+
+	for _, f := range afterUnmount {
+		f()
 	}
 
 	// Restore directory if in secure mode
@@ -160,18 +551,77 @@ func cleanup(server *fuse.Server, securePath, originalPath, mountPath string, en
 	}
 }
 
-func main() {
-	configs := map[string]*slowfs.DeviceConfig{
+// builtinConfigs returns the device configs available without --config-file, by name.
+func builtinConfigs() map[string]*slowfs.DeviceConfig {
+	return map[string]*slowfs.DeviceConfig{
 		slowfs.HDD7200RpmDeviceConfig.Name: &slowfs.HDD7200RpmDeviceConfig,
+		slowfs.NetworkDeviceConfig.Name:    &slowfs.NetworkDeviceConfig,
+	}
+}
+
+// cloneConfig returns a copy of config whose fields flags can override without changing config.
+func cloneConfig(config *slowfs.DeviceConfig) *slowfs.DeviceConfig {
+	c := *config
+	c.Triggers = slices.Clone(config.Triggers)
+	c.PathLatencies = slices.Clone(config.PathLatencies)
+	c.PathConfigs = maps.Clone(config.PathConfigs)
+	c.MetadataOpTimes = maps.Clone(config.MetadataOpTimes)
+	return &c
+}
+
+// resolvePathConfigs looks up the configs named by the PathConfigs of config in configs, returning
+// them by path prefix.
+func resolvePathConfigs(config *slowfs.DeviceConfig, configs map[string]*slowfs.DeviceConfig) (map[string]*slowfs.DeviceConfig, error) {
+	pathConfigs := make(map[string]*slowfs.DeviceConfig, len(config.PathConfigs))
+	for prefix, name := range config.PathConfigs {
+		pathConfig, ok := configs[name]
+		if !ok {
+			return nil, fmt.Errorf("path config %s: unknown config %s", prefix, name)
+		}
+		if len(pathConfig.PathConfigs) != 0 {
+			return nil, fmt.Errorf("path config %s: config %s has path configs of its own", prefix, name)
+		}
+		if err := pathConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("path config %s: error validating config %s: %s", prefix, name, err)
+		}
+		pathConfigs[prefix] = pathConfig
+	}
+	return pathConfigs, nil
+}
+
+func main() {
+	configs := builtinConfigs()
+
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		runRepl(os.Args[2:], configs)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:], configs)
+		return
 	}
 
 	backingDir := flag.String("backing-dir", "", "directory to use as storage")
 	mountDir := flag.String("mount-dir", "", "directory to mount at")
 	secureMode := flag.Bool("secure-mode", false, "enable secure mode (moves backing directory to prevent bypass)")
+	statFsScale := flag.Float64("statfs-scale", 0, "multiply the size and free space reported by statfs by this factor (e.g. 0.1), without enforcing it")
+	maxReadahead := flag.String("max-readahead", "", "cap on how far ahead the kernel reads (e.g. 4KiB); kernel default if unset")
+	readOnly := flag.Bool("read-only", false, "mount read-only, failing every modification with EROFS without touching backing-dir")
+	attrTimeout := flag.Duration("attr-timeout", 0, "how long the kernel may cache file attributes, serving stats without slowfs modeling them")
+	entryTimeout := flag.Duration("entry-timeout", 0, "how long the kernel may cache name lookups, serving them without slowfs modeling them")
+	maxOpenFiles := flag.Int("max-open-files", 0, "fail opening more than this many files at once with EMFILE; unlimited if 0")
+	writeVisibilityDelay := flag.Duration("write-visibility-delay", 0, "serve the old data to reads until this long after a write, and hide new files until then, like an eventually consistent store")
+	exitOnStdinEOF := flag.Bool("exit-on-stdin-eof", false, "unmount and exit cleanly when stdin is closed, as when a parent process holding a pipe to it dies")
+	force := flag.Bool("force", false, "mount even if mount-dir is not empty, hiding its contents until unmounted")
+	dryRun := flag.Bool("dry-run", false, "check the config, backing-dir and mount-dir as if mounting, print the outcome of each check and exit without mounting")
+	var mounts mountFlag
+	flag.Var(&mounts, "mount", "another filesystem to mount with a scheduler of its own (e.g. backing=/a,mount=/b,config=ssd); can be repeated, and the first stands in for backing-dir and mount-dir if they are not given")
 
-	configFile := flag.String("config-file", "", "path to config file listing device configurations")
-	configName := flag.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm)")
+	configFile := flag.String("config-file", "", "path to config file listing device configurations, or a directory of such files")
+	configName := flag.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, network)")
 	verboseLog := flag.Bool("verbose", false, "enable verbose logging for debugging")
+	debugSeeks := flag.Bool("debug-seeks", false, "log whether each read and write seeks, and why")
+	debugContext := flag.Bool("debug-context", false, "log the uid, gid and pid of the caller of every operation, and the settings negotiated with the kernel")
 
 	// Flags for overriding any subset of the config. These are all strings (even the durations)
 	// because we need to differentiate between the flag not being specified, and being set to the
@@ -182,13 +632,105 @@ func main() {
 	writeBytesPerSecond := flag.String("write-bytes-per-second", "", "")
 	allocateBytesPerSecond := flag.String("allocate-bytes-per-second", "", "")
 	requestReorderMaxDelay := flag.String("request-reorder-max-delay", "", "")
-	fsyncStrategy := flag.String("fsync-strategy", "", "choice of none/no, dumb, writebackcache/wbc")
+	fsyncStrategy := flag.String("fsync-strategy", "", "choice of none/no, dumb, writebackcache/wbc, wbc-global")
 	writeStrategy := flag.String("write-strategy", "", "choice of fast, simulate")
 	metadataOpTime := flag.String("metadata-op-time", "", "duration value (e.g. 10ms)")
+	minFsyncInterval := flag.String("min-fsync-interval", "", "duration value (e.g. 10ms)")
+	transientReadErrorRate := flag.String("transient-read-error-rate", "", "probability between 0 and 1")
+	corruptionProbability := flag.String("corruption-probability", "", "probability between 0 and 1; requires --allow-corruption")
+	corruptionBytes := flag.String("corruption-bytes", "", "number of consecutive bytes flipped in a corrupted read")
+	networkLatency := flag.String("network-latency", "", "duration value (e.g. 1ms)")
+	maxOpDelay := flag.String("max-op-delay", "", "duration value (e.g. 5s)")
+	simulatedCapacity := flag.String("simulated-capacity", "", "size of the device reported by statfs (e.g. 10GiB)")
+	latencyJitter := flag.String("latency-jitter", "", "fraction between 0 and 1 by which op times randomly vary (e.g. 0.1 for ±10%)")
+	transientErrorRecoveryTime := flag.String("transient-error-recovery-time", "", "duration value (e.g. 10ms)")
+	readErrorRate := flag.String("read-error-rate", "", "probability between 0 and 1 that a read fails with EIO")
+	writeErrorRate := flag.String("write-error-rate", "", "probability between 0 and 1 that a write fails with EIO")
+	delayedAllocation := flag.String("delayed-allocation", "", "true or false")
+	atimeMode := flag.String("atime-mode", "", "choice of noatime, relatime, strictatime")
+	coldWritePenalty := flag.String("cold-write-penalty", "", "duration value (e.g. 10ms)")
+	dirtyBackgroundBytes := flag.String("dirty-background-bytes", "", "size value (e.g. 64MiB)")
+	dirtyBytes := flag.String("dirty-bytes", "", "size value (e.g. 256MiB)")
+	writeBackCacheSize := flag.String("write-back-cache-size", "", "size value (e.g. 1GiB)")
+	writeBackHighWaterMark := flag.String("write-back-high-water-mark", "", "size value (e.g. 512MiB)")
+	lyingFsync := flag.String("lying-fsync", "", "true or false")
+	targetReadLatency := flag.String("target-read-latency", "", "duration value (e.g. 10ms)")
+	targetWriteLatency := flag.String("target-write-latency", "", "duration value (e.g. 10ms)")
+	metadataCacheSize := flag.String("metadata-cache-size", "", "number of paths (e.g. 1000)")
+	pathConfig := flag.String("path-config", "", "serve paths under a prefix with a device of their own using another config (e.g. fast=ssd); separate multiple prefixes with ;")
+	pathLatency := flag.String("path-latency", "", "pin how long operations on matching paths take (e.g. path=data/*.db,read=50ms); separate multiple paths with ;")
+	trigger := flag.String("trigger", "", "degrade the device after some operations (e.g. op=write,after=10000,fsync=200ms); separate multiple triggers with ;")
+	blockSize := flag.String("block-size", "", "size value (e.g. 4KiB)")
+	strictAlignment := flag.String("strict-alignment", "", "true or false")
+	blockGroupSize := flag.String("block-group-size", "", "size value (e.g. 128MiB)")
+	blockGroupSeekTime := flag.String("block-group-seek-time", "", "duration value (e.g. 1ms)")
+	flushOnClose := flag.String("flush-on-close", "", "true or false")
+	latencyHistogramFile := flag.String("latency-histogram-file", "", "file of measured latencies to sample operation times from (lines like: read 2ms 40)")
+	metadataPerComponentTime := flag.String("metadata-per-component-time", "", "duration value (e.g. 1ms)")
+	timeToFirstByte := flag.String("time-to-first-byte", "", "duration value (e.g. 200ms)")
+	openDirTime := flag.String("open-dir-time", "", "duration value (e.g. 5ms)")
+	readdirEntryTime := flag.String("readdir-entry-time", "", "duration value (e.g. 10us)")
+	openTime := flag.String("open-time", "", "duration value (e.g. 5ms)")
+	randomReadBytesPerSecond := flag.String("random-read-bytes-per-second", "", "throughput of reads which seek (e.g. 2MiB); defaults to read-bytes-per-second")
+	randomWriteBytesPerSecond := flag.String("random-write-bytes-per-second", "", "throughput of writes which seek (e.g. 2MiB); defaults to write-bytes-per-second")
+	readAheadBytes := flag.String("read-ahead-bytes", "", "how far past each read the device prefetches in spare time (e.g. 128KiB)")
+	rpm := flag.String("rpm", "", "rotational speed of a hard disk (e.g. 7200), adding half a revolution to every read and write")
+	queueDepth := flag.String("queue-depth", "", "number of requests served in parallel (e.g. 4)")
+	maxIOPS := flag.String("max-iops", "", "maximum reads and writes per second (e.g. 10000)")
+	metadataIOPS := flag.String("metadata-iops", "", "maximum metadata operations per second (e.g. 500)")
+	globalFsync := flag.String("global-fsync", "", "true or false")
+	separateMetadataQueue := flag.String("separate-metadata-queue", "", "true or false")
+	writeBackOrder := flag.String("write-back-order", "", "choice of random, oldestfirst, largestfirst, roundrobin")
+	schedulerPolicy := flag.String("scheduler-policy", "", "how reads and writes are reordered: choice of sequential, fifo, scan")
+	traversalProfile := flag.String("traversal-profile", "", "set metadata costs for slow directory walks, applied before other overrides: "+strings.Join(slowfs.TraversalProfiles(), ", "))
+	opTimes := flag.String("op-times", "", "per-operation times (e.g. read=2ms,write=5ms,fsync=50ms,metadata=1ms,rename=20ms)")
+	drainOnExit := flag.Bool("drain-on-exit", false, "on exit, wait for the modeled write back cache to be written back before unmounting")
+	drainTimeout := flag.Duration("drain-timeout", 0, "with --drain-on-exit, the longest to wait for the write back cache to be written back (0 for no limit)")
+	chromeTrace := flag.String("chrome-trace", "", "file to write the modeled timeline to, in Chrome trace event format")
+	traceFile := flag.String("trace-file", "", "file to write a CSV row to for every request scheduled, with its computed delay")
+	allowCorruption := flag.Bool("allow-corruption", false, "allow CorruptionProbability to make reads return corrupted data")
+	allowExtreme := flag.Bool("allow-extreme", false, "only warn about config values outside the sane limits instead of exiting")
+	saneLimits := flag.String("sane-limits", "", "override the sane limits (e.g. min-bandwidth=1KB,max-seek-time=10s,max-metadata-op-time=1s)")
+	instanceName := flag.String("instance-name", "", "name of this mount, added to metrics as the instance label and to log lines")
+	labels := labelFlag{}
+	flag.Var(labels, "label", "key=value label to add to metrics; can be repeated")
+	randomSeed := flag.String("random-seed", "", "seed for the device model's random choices, making runs reproducible")
+	subsystemSeeds := flag.String("subsystem-seeds", "", "seeds for individual random subsystems, overriding random-seed (e.g. errors=7,writeback=1,latency=3)")
+	summaryJSON := flag.String("summary-json", "", "file to write a JSON summary of the run to on exit")
+	fileStatsTop := flag.Int("file-stats-top", 0, "number of files to print access statistics for on exit, most delayed first")
+	statsAddr := flag.String("stats-addr", "", "address (e.g. :8080) to serve the same summary as --summary-json on at /stats while running")
+	eventURL := flag.String("event-url", "", "URL to POST modeled events (e.g. throttling starting) to as JSON")
+	metricsAddr := flag.String("metrics-addr", "", "address (e.g. :9090) to serve Prometheus metrics on at /metrics while running")
+	statsdAddr := flag.String("statsd-addr", "", "host:port of a StatsD server to periodically send metrics to over UDP")
+	statsdPrefix := flag.String("statsd-prefix", "slowfs", "prefix for the names of metrics sent to StatsD")
+	statsdInterval := flag.Duration("statsd-interval", 10*time.Second, "how often to send metrics to StatsD")
+	initialDirty := flag.String("initial-dirty", "", "files to start with unflushed data in the write back cache (e.g. a.txt=4MiB,b/c.txt=1MiB)")
+
+	runConfig := flag.String("run-config", "", "JSON file setting any of the other flags by name, e.g. {\"backing-dir\": \"/data\", \"secure-mode\": true}; flags given on the command line take precedence")
 	flag.Parse()
 
+	if *runConfig != "" {
+		if err := applyRunConfig(*runConfig, flag.CommandLine); err != nil {
+			log.Fatalf("run config %s: %s", *runConfig, err)
+		}
+	}
+
+	if *instanceName != "" {
+		log.SetPrefix("[" + *instanceName + "] ")
+		labels["instance"] = *instanceName
+	}
+
+	// Without the single mount flags, the first --mount is the main mount.
+	if *backingDir == "" && *mountDir == "" && len(mounts) > 0 {
+		*backingDir, *mountDir = mounts[0].backingDir, mounts[0].mountDir
+		if mounts[0].configName != "" {
+			*configName = mounts[0].configName
+		}
+		mounts = mounts[1:]
+	}
+
 	if *backingDir == "" || *mountDir == "" {
-		log.Fatalf("arguments backing-dir and mount-dir are required.")
+		log.Fatalf("arguments backing-dir and mount-dir, or mount, are required.")
 	}
 
 	var err error
@@ -209,20 +751,20 @@ func main() {
 		log.Fatalf("backing directory may not be the same as mount directory (unless using --secure-mode)")
 	}
 
-	if *configFile != "" {
-		data, err := os.ReadFile(*configFile)
-		if err != nil {
-			log.Fatalf("couldn't read config file %s: %s", *configFile, err)
+	mountDirs := map[string]bool{*mountDir: true}
+	for i := range mounts {
+		if mounts[i], err = absMountSpec(mounts[i]); err != nil {
+			log.Fatalf("flag mount: %s", err)
 		}
-		dcs, err := slowfs.ParseDeviceConfigsFromJSON(data)
-		if err != nil {
-			log.Fatalf("couldn't parse config file %s: %s", *configFile, err)
+		if mountDirs[mounts[i].mountDir] {
+			log.Fatalf("flag mount: %s is mounted on more than once", mounts[i].mountDir)
 		}
-		for _, dc := range dcs {
-			if _, ok := configs[dc.Name]; ok {
-				log.Fatalf("duplicate device config with name '%s'", dc.Name)
-			}
-			configs[dc.Name] = dc
+		mountDirs[mounts[i].mountDir] = true
+	}
+
+	if *configFile != "" {
+		if err := loadConfigs(*configFile, configs); err != nil {
+			log.Fatalf("%s", err)
 		}
 	}
 
@@ -231,77 +773,506 @@ func main() {
 	if !ok {
 		log.Fatalf("unknown config %s", *configName)
 	}
+	// The flags are applied again to a fresh copy when reloading on SIGHUP, so leave the config
+	// they start from untouched.
+	config = cloneConfig(config)
 
-	flagsHadError := false
+	// applyConfigFlags overrides fields of config with the flags which set them, logging those
+	// which are invalid and returning whether there were any.
+	applyConfigFlags := func(config *slowfs.DeviceConfig) bool {
+		var err error
+		flagsHadError := false
 
-	if *seekWindow != "" {
-		config.SeekWindow, err = units.ParseNumBytesFromString(*seekWindow)
-		if err != nil {
-			log.Printf("flag seek-window: %s", err)
-			flagsHadError = true
+		if *traversalProfile != "" {
+			if err := config.ApplyTraversalProfile(*traversalProfile); err != nil {
+				log.Printf("flag traversal-profile: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *seekTime != "" {
-		config.SeekTime, err = time.ParseDuration(*seekTime)
-		if err != nil {
-			log.Printf("flag seek-time: %s", err)
-			flagsHadError = true
+		if *seekWindow != "" {
+			config.SeekWindow, err = units.ParseNumBytesFromString(*seekWindow)
+			if err != nil {
+				log.Printf("flag seek-window: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *readBytesPerSecond != "" {
-		config.ReadBytesPerSecond, err = units.ParseNumBytesFromString(*readBytesPerSecond)
-		if err != nil {
-			log.Printf("flag read-bytes-per-second: %s", err)
-			flagsHadError = true
+		if *seekTime != "" {
+			config.SeekTime, err = time.ParseDuration(*seekTime)
+			if err != nil {
+				log.Printf("flag seek-time: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *writeBytesPerSecond != "" {
-		config.WriteBytesPerSecond, err = units.ParseNumBytesFromString(*writeBytesPerSecond)
-		if err != nil {
-			log.Printf("flag write-bytes-per-second: %s", err)
-			flagsHadError = true
+		if *readBytesPerSecond != "" {
+			config.ReadBytesPerSecond, err = units.ParseNumBytesFromString(*readBytesPerSecond)
+			if err != nil {
+				log.Printf("flag read-bytes-per-second: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *allocateBytesPerSecond != "" {
-		config.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(*allocateBytesPerSecond)
-		if err != nil {
-			log.Printf("flag allocate-bytes-per-second: %s", err)
-			flagsHadError = true
+		if *writeBytesPerSecond != "" {
+			config.WriteBytesPerSecond, err = units.ParseNumBytesFromString(*writeBytesPerSecond)
+			if err != nil {
+				log.Printf("flag write-bytes-per-second: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *requestReorderMaxDelay != "" {
-		config.RequestReorderMaxDelay, err = time.ParseDuration(*requestReorderMaxDelay)
-		if err != nil {
-			log.Printf("flag request-reorder-max-delay: %s", err)
-			flagsHadError = true
+		if *allocateBytesPerSecond != "" {
+			config.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(*allocateBytesPerSecond)
+			if err != nil {
+				log.Printf("flag allocate-bytes-per-second: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *fsyncStrategy != "" {
-		config.FsyncStrategy, err = slowfs.ParseFsyncStrategyFromString(*fsyncStrategy)
-		if err != nil {
-			log.Printf("flag fsync-strategy: %s", err)
-			flagsHadError = true
+		if *requestReorderMaxDelay != "" {
+			config.RequestReorderMaxDelay, err = time.ParseDuration(*requestReorderMaxDelay)
+			if err != nil {
+				log.Printf("flag request-reorder-max-delay: %s", err)
+				flagsHadError = true
+			}
 		}
-	}
 
-	if *writeStrategy != "" {
-		config.WriteStrategy, err = slowfs.ParseWriteStrategyFromString(*writeStrategy)
-		if err != nil {
-			log.Printf("flag write-strategy: %s", err)
-			flagsHadError = true
+		if *fsyncStrategy != "" {
+			config.FsyncStrategy, err = slowfs.ParseFsyncStrategyFromString(*fsyncStrategy)
+			if err != nil {
+				log.Printf("flag fsync-strategy: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *writeStrategy != "" {
+			config.WriteStrategy, err = slowfs.ParseWriteStrategyFromString(*writeStrategy)
+			if err != nil {
+				log.Printf("flag write-strategy: %s", err)
+				flagsHadError = true
+			}
 		}
+
+		if *metadataOpTime != "" {
+			config.MetadataOpTime, err = time.ParseDuration(*metadataOpTime)
+			if err != nil {
+				log.Printf("flag metadata-op-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *minFsyncInterval != "" {
+			config.MinFsyncInterval, err = time.ParseDuration(*minFsyncInterval)
+			if err != nil {
+				log.Printf("flag min-fsync-interval: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *corruptionProbability != "" {
+			config.CorruptionProbability, err = strconv.ParseFloat(*corruptionProbability, 64)
+			if err != nil {
+				log.Printf("flag corruption-probability: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *corruptionBytes != "" {
+			config.CorruptionBytes, err = strconv.Atoi(*corruptionBytes)
+			if err != nil {
+				log.Printf("flag corruption-bytes: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *networkLatency != "" {
+			config.NetworkLatency, err = time.ParseDuration(*networkLatency)
+			if err != nil {
+				log.Printf("flag network-latency: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *maxOpDelay != "" {
+			config.MaxOpDelay, err = time.ParseDuration(*maxOpDelay)
+			if err != nil {
+				log.Printf("flag max-op-delay: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *simulatedCapacity != "" {
+			config.SimulatedCapacity, err = units.ParseNumBytesFromString(*simulatedCapacity)
+			if err != nil {
+				log.Printf("flag simulated-capacity: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *latencyJitter != "" {
+			config.LatencyJitter, err = strconv.ParseFloat(*latencyJitter, 64)
+			if err != nil {
+				log.Printf("flag latency-jitter: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *transientReadErrorRate != "" {
+			config.TransientReadErrorRate, err = strconv.ParseFloat(*transientReadErrorRate, 64)
+			if err != nil {
+				log.Printf("flag transient-read-error-rate: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *transientErrorRecoveryTime != "" {
+			config.TransientErrorRecoveryTime, err = time.ParseDuration(*transientErrorRecoveryTime)
+			if err != nil {
+				log.Printf("flag transient-error-recovery-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *readErrorRate != "" {
+			config.ReadErrorRate, err = strconv.ParseFloat(*readErrorRate, 64)
+			if err != nil {
+				log.Printf("flag read-error-rate: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *writeErrorRate != "" {
+			config.WriteErrorRate, err = strconv.ParseFloat(*writeErrorRate, 64)
+			if err != nil {
+				log.Printf("flag write-error-rate: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *delayedAllocation != "" {
+			config.DelayedAllocation, err = strconv.ParseBool(*delayedAllocation)
+			if err != nil {
+				log.Printf("flag delayed-allocation: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *atimeMode != "" {
+			config.AtimeMode, err = slowfs.ParseAtimeModeFromString(*atimeMode)
+			if err != nil {
+				log.Printf("flag atime-mode: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *coldWritePenalty != "" {
+			config.ColdWritePenalty, err = time.ParseDuration(*coldWritePenalty)
+			if err != nil {
+				log.Printf("flag cold-write-penalty: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *dirtyBackgroundBytes != "" {
+			config.DirtyBackgroundBytes, err = units.ParseNumBytesFromString(*dirtyBackgroundBytes)
+			if err != nil {
+				log.Printf("flag dirty-background-bytes: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *dirtyBytes != "" {
+			config.DirtyBytes, err = units.ParseNumBytesFromString(*dirtyBytes)
+			if err != nil {
+				log.Printf("flag dirty-bytes: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *writeBackCacheSize != "" {
+			config.WriteBackCacheSize, err = units.ParseNumBytesFromString(*writeBackCacheSize)
+			if err != nil {
+				log.Printf("flag write-back-cache-size: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *writeBackHighWaterMark != "" {
+			config.WriteBackHighWaterMark, err = units.ParseNumBytesFromString(*writeBackHighWaterMark)
+			if err != nil {
+				log.Printf("flag write-back-high-water-mark: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *lyingFsync != "" {
+			config.LyingFsync, err = strconv.ParseBool(*lyingFsync)
+			if err != nil {
+				log.Printf("flag lying-fsync: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *targetReadLatency != "" {
+			config.TargetReadLatency, err = time.ParseDuration(*targetReadLatency)
+			if err != nil {
+				log.Printf("flag target-read-latency: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *targetWriteLatency != "" {
+			config.TargetWriteLatency, err = time.ParseDuration(*targetWriteLatency)
+			if err != nil {
+				log.Printf("flag target-write-latency: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *metadataCacheSize != "" {
+			config.MetadataCacheSize, err = strconv.Atoi(*metadataCacheSize)
+			if err != nil {
+				log.Printf("flag metadata-cache-size: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *pathLatency != "" {
+			for _, spec := range strings.Split(*pathLatency, ";") {
+				pl, err := slowfs.ParsePathLatencyFromString(spec)
+				if err != nil {
+					log.Printf("flag path-latency: %s", err)
+					flagsHadError = true
+					continue
+				}
+				config.PathLatencies = append(config.PathLatencies, pl)
+			}
+		}
+
+		if *trigger != "" {
+			for _, spec := range strings.Split(*trigger, ";") {
+				t, err := slowfs.ParseTriggerFromString(spec)
+				if err != nil {
+					log.Printf("flag trigger: %s", err)
+					flagsHadError = true
+					continue
+				}
+				config.Triggers = append(config.Triggers, t)
+			}
+		}
+
+		if *pathConfig != "" {
+			for _, spec := range strings.Split(*pathConfig, ";") {
+				prefix, name, err := slowfs.ParsePathConfigFromString(spec)
+				if err != nil {
+					log.Printf("flag path-config: %s", err)
+					flagsHadError = true
+					continue
+				}
+				if config.PathConfigs == nil {
+					config.PathConfigs = make(map[string]string)
+				}
+				config.PathConfigs[prefix] = name
+			}
+		}
+
+		if *blockSize != "" {
+			config.BlockSize, err = units.ParseNumBytesFromString(*blockSize)
+			if err != nil {
+				log.Printf("flag block-size: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *strictAlignment != "" {
+			config.StrictAlignment, err = strconv.ParseBool(*strictAlignment)
+			if err != nil {
+				log.Printf("flag strict-alignment: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *blockGroupSize != "" {
+			config.BlockGroupSize, err = units.ParseNumBytesFromString(*blockGroupSize)
+			if err != nil {
+				log.Printf("flag block-group-size: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *blockGroupSeekTime != "" {
+			config.BlockGroupSeekTime, err = time.ParseDuration(*blockGroupSeekTime)
+			if err != nil {
+				log.Printf("flag block-group-seek-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *flushOnClose != "" {
+			config.FlushOnClose, err = strconv.ParseBool(*flushOnClose)
+			if err != nil {
+				log.Printf("flag flush-on-close: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *latencyHistogramFile != "" {
+			config.LatencyHistogramFile = *latencyHistogramFile
+			config.LatencyHistograms, err = slowfs.LoadLatencyHistograms(*latencyHistogramFile)
+			if err != nil {
+				log.Printf("flag latency-histogram-file: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *metadataPerComponentTime != "" {
+			config.MetadataPerComponentTime, err = time.ParseDuration(*metadataPerComponentTime)
+			if err != nil {
+				log.Printf("flag metadata-per-component-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *timeToFirstByte != "" {
+			config.TimeToFirstByte, err = time.ParseDuration(*timeToFirstByte)
+			if err != nil {
+				log.Printf("flag time-to-first-byte: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *openDirTime != "" {
+			config.OpenDirTime, err = time.ParseDuration(*openDirTime)
+			if err != nil {
+				log.Printf("flag open-dir-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *readdirEntryTime != "" {
+			config.ReaddirEntryTime, err = time.ParseDuration(*readdirEntryTime)
+			if err != nil {
+				log.Printf("flag readdir-entry-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *openTime != "" {
+			config.OpenTime, err = time.ParseDuration(*openTime)
+			if err != nil {
+				log.Printf("flag open-time: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *randomReadBytesPerSecond != "" {
+			config.RandomReadBytesPerSecond, err = units.ParseNumBytesFromString(*randomReadBytesPerSecond)
+			if err != nil {
+				log.Printf("flag random-read-bytes-per-second: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *randomWriteBytesPerSecond != "" {
+			config.RandomWriteBytesPerSecond, err = units.ParseNumBytesFromString(*randomWriteBytesPerSecond)
+			if err != nil {
+				log.Printf("flag random-write-bytes-per-second: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *readAheadBytes != "" {
+			config.ReadAheadBytes, err = units.ParseNumBytesFromString(*readAheadBytes)
+			if err != nil {
+				log.Printf("flag read-ahead-bytes: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *rpm != "" {
+			config.RPM, err = strconv.Atoi(*rpm)
+			if err != nil {
+				log.Printf("flag rpm: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *queueDepth != "" {
+			config.QueueDepth, err = strconv.Atoi(*queueDepth)
+			if err != nil {
+				log.Printf("flag queue-depth: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *maxIOPS != "" {
+			config.MaxIOPS, err = strconv.Atoi(*maxIOPS)
+			if err != nil {
+				log.Printf("flag max-iops: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *metadataIOPS != "" {
+			config.MetadataIOPS, err = strconv.Atoi(*metadataIOPS)
+			if err != nil {
+				log.Printf("flag metadata-iops: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *globalFsync != "" {
+			config.GlobalFsync, err = strconv.ParseBool(*globalFsync)
+			if err != nil {
+				log.Printf("flag global-fsync: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *separateMetadataQueue != "" {
+			config.SeparateMetadataQueue, err = strconv.ParseBool(*separateMetadataQueue)
+			if err != nil {
+				log.Printf("flag separate-metadata-queue: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *writeBackOrder != "" {
+			config.WriteBackOrder, err = slowfs.ParseWriteBackOrderFromString(*writeBackOrder)
+			if err != nil {
+				log.Printf("flag write-back-order: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *schedulerPolicy != "" {
+			config.SchedulerPolicy, err = slowfs.ParseSchedulerPolicyFromString(*schedulerPolicy)
+			if err != nil {
+				log.Printf("flag scheduler-policy: %s", err)
+				flagsHadError = true
+			}
+		}
+
+		if *opTimes != "" {
+			err = config.SetOpTimes(*opTimes)
+			if err != nil {
+				log.Printf("flag op-times: %s", err)
+				flagsHadError = true
+			}
+		}
+		return flagsHadError
 	}
+	flagsHadError := applyConfigFlags(config)
 
-	if *metadataOpTime != "" {
-		config.MetadataOpTime, err = time.ParseDuration(*metadataOpTime)
+	var initialDirtyFiles map[string]units.NumBytes
+	if *initialDirty != "" {
+		initialDirtyFiles, err = parseInitialDirty(*initialDirty)
 		if err != nil {
-			log.Printf("flag metadata-op-time: %s", err)
+			log.Printf("flag initial-dirty: %s", err)
+			flagsHadError = true
+		} else if !config.FsyncStrategy.UsesWriteBackCache() {
+			log.Printf("flag initial-dirty: requires fsync strategy %s or %s", slowfs.WriteBackCachedFsync, slowfs.GlobalWriteBackCachedFsync)
 			flagsHadError = true
 		}
 	}
@@ -315,8 +1286,109 @@ func main() {
 		log.Fatalf("error validating config: %s", err)
 	}
 
+	pathConfigs, err := resolvePathConfigs(config, configs)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	limits := slowfs.DefaultSaneLimits
+	if *saneLimits != "" {
+		if err := limits.Set(*saneLimits); err != nil {
+			log.Fatalf("flag sane-limits: %s", err)
+		}
+	}
+	if err := config.CheckSane(limits); err != nil {
+		if !*allowExtreme {
+			log.Fatalf("%s (pass --allow-extreme if this is intended)", err)
+		}
+		log.Printf("warning: %s", err)
+	}
+
+	// Corrupted reads look like a broken device, so make sure they were asked for.
+	if config.CorruptionProbability > 0 {
+		if !*allowCorruption {
+			log.Fatalf("config %s has CorruptionProbability %v, which makes reads return corrupted data (pass --allow-corruption if this is intended)", config.Name, config.CorruptionProbability)
+		}
+		log.Printf("warning: %.4g%% of reads will return corrupted data", config.CorruptionProbability*100)
+	}
+
+	// loadConfig reads the config called name the same way as above, for reloading the config on
+	// SIGHUP and for the configs of --mount. It also returns all the configs which were read.
+	loadConfig := func(name string) (*slowfs.DeviceConfig, map[string]*slowfs.DeviceConfig, error) {
+		configs := builtinConfigs()
+		if *configFile != "" {
+			if err := loadConfigs(*configFile, configs); err != nil {
+				return nil, nil, err
+			}
+		}
+		config, ok := configs[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown config %s", name)
+		}
+		config = cloneConfig(config)
+		if applyConfigFlags(config) {
+			return nil, nil, fmt.Errorf("flags had error(s)")
+		}
+		if err := config.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("error validating config: %s", err)
+		}
+		if err := config.CheckSane(limits); err != nil && !*allowExtreme {
+			return nil, nil, fmt.Errorf("%s (pass --allow-extreme if this is intended)", err)
+		}
+		if config.CorruptionProbability > 0 && !*allowCorruption {
+			return nil, nil, fmt.Errorf("config %s has CorruptionProbability %v (pass --allow-corruption if this is intended)", config.Name, config.CorruptionProbability)
+		}
+		return config, configs, nil
+	}
+
 	fmt.Printf("using config: %s\n", config)
-	
+
+	var maxReadaheadBytes units.NumBytes
+	if *maxReadahead != "" {
+		maxReadaheadBytes, err = units.ParseNumBytesFromString(*maxReadahead)
+		if err != nil || maxReadaheadBytes <= 0 {
+			log.Fatalf("flag max-readahead: want a positive size, got %q", *maxReadahead)
+		}
+	}
+
+	if *statFsScale < 0 {
+		log.Fatalf("flag statfs-scale cannot be negative")
+	}
+
+	if *dryRun {
+		checks := []preMountCheck{{"config " + config.Name, nil}}
+		for _, spec := range mounts {
+			name := spec.configName
+			if name == "" {
+				name = *configName
+			}
+			mountConfig, mountConfigs, err := loadConfig(name)
+			if err == nil {
+				_, err = resolvePathConfigs(mountConfig, mountConfigs)
+			}
+			checks = append(checks, preMountCheck{"config " + name + " for " + spec.mountDir, err})
+		}
+		checks = append(checks, mountChecks(*backingDir, *mountDir, *secureMode, *force)...)
+		for _, spec := range mounts {
+			checks = append(checks, mountChecks(spec.backingDir, spec.mountDir, false, *force)...)
+		}
+		os.Exit(reportDryRun(checks))
+	}
+
+	// In secure mode with backing-dir as mount-dir, the contents are moved away before mounting.
+	if !*force && !(*secureMode && *backingDir == *mountDir) {
+		if err := checkMountDirEmpty(*mountDir); err != nil {
+			log.Fatalf("%s; pass --force to mount over it anyway", err)
+		}
+	}
+	if !*force {
+		for _, spec := range mounts {
+			if err := checkMountDirEmpty(spec.mountDir); err != nil {
+				log.Fatalf("%s; pass --force to mount over it anyway", err)
+			}
+		}
+	}
+
 	// Store original backing directory path for cleanup
 	originalBackingDir := *backingDir
 	var secureBackingDir string
@@ -351,8 +1423,153 @@ func main() {
 	}
 	fmt.Printf("Detected backing directory owner: uid=%d, gid=%d\n", uid, gid)
 	
-	scheduler := scheduler.New(config)
-	fs := pathfs.NewPathNodeFs(fuselayer.NewSlowFsWithOwner(*backingDir, scheduler, uid, gid, *verboseLog), nil)
+	// The tracers to record requests with, and what each one writes.
+	var tracers []scheduler.Tracer
+	var traceNames []string
+	if *chromeTrace != "" {
+		f, err := os.Create(*chromeTrace)
+		if err != nil {
+			log.Fatalf("couldn't create chrome trace file %s: %s", *chromeTrace, err)
+		}
+		tracers = append(tracers, scheduler.NewChromeTraceWriter(f))
+		traceNames = append(traceNames, "chrome trace to "+*chromeTrace)
+	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("couldn't create trace file %s: %s", *traceFile, err)
+		}
+		tracers = append(tracers, scheduler.NewCSVTraceWriter(f))
+		traceNames = append(traceNames, "request trace to "+*traceFile)
+	}
+	var tracer scheduler.Tracer
+	if len(tracers) > 0 {
+		tracer = scheduler.MultiTracer(tracers...)
+	}
+
+	scheduler := scheduler.NewWithPathConfigs(config, pathConfigs)
+	if *debugSeeks {
+		scheduler.SetSeekLogging(true)
+	}
+	var beforeUnmount, afterUnmount []func()
+	if *drainOnExit {
+		var drainOnce sync.Once
+		beforeUnmount = append(beforeUnmount, func() {
+			drainOnce.Do(func() {
+				d := scheduler.Drain()
+				if *drainTimeout > 0 && d > *drainTimeout {
+					fmt.Printf("Draining write back cache would take %s, waiting %s\n", d, *drainTimeout)
+					d = *drainTimeout
+				} else {
+					fmt.Printf("Draining write back cache, waiting %s\n", d)
+				}
+				time.Sleep(d)
+			})
+		})
+	}
+	if tracer != nil {
+		scheduler.SetTracer(tracer)
+		var closeOnce sync.Once
+		afterUnmount = append(afterUnmount, func() {
+			closeOnce.Do(func() {
+				scheduler.SetTracer(nil)
+				for i, t := range tracers {
+					if err := t.Close(); err != nil {
+						log.Printf("Error writing %s: %v", traceNames[i], err)
+					} else {
+						fmt.Printf("Wrote %s\n", traceNames[i])
+					}
+				}
+			})
+		})
+	}
+	if *randomSeed != "" || *subsystemSeeds != "" {
+		seed, overrides, err := parseSeeds(*randomSeed, *subsystemSeeds)
+		if err == nil {
+			err = scheduler.SeedRandom(seed, overrides)
+		}
+		if err != nil {
+			log.Fatalf("random seeds: %s", err)
+		}
+		fmt.Printf("Random seed: %d\n", seed)
+	}
+	if *eventURL != "" {
+		handler, stop := postEvents(*eventURL)
+		scheduler.SetEventHandler(handler)
+		var stopOnce sync.Once
+		afterUnmount = append(afterUnmount, func() {
+			stopOnce.Do(func() {
+				scheduler.SetEventHandler(nil)
+				stop()
+			})
+		})
+	}
+	if *statsdAddr != "" {
+		emitter, err := metrics.NewStatsDEmitter(*statsdAddr, *statsdPrefix, labels, *statsdInterval, scheduler)
+		if err != nil {
+			log.Fatalf("couldn't send metrics to statsd at %s: %s", *statsdAddr, err)
+		}
+		var closeOnce sync.Once
+		afterUnmount = append(afterUnmount, func() {
+			closeOnce.Do(func() { emitter.Close() })
+		})
+	}
+	for path, numBytes := range initialDirtyFiles {
+		inode := backingInode(filepath.Join(*backingDir, path))
+		if err := scheduler.MarkDirty(path, inode, numBytes); err != nil {
+			log.Fatalf("failed to mark %s as dirty: %v", path, err)
+		}
+		fmt.Printf("Write back cache: %s starts with %s dirty\n", path, scheduler.DirtyBytes(path, inode))
+	}
+	var alignment units.NumBytes
+	if config.StrictAlignment {
+		alignment = config.BlockSize
+	}
+	fsOpts := fuselayer.Options{
+		Uid:                  uid,
+		Gid:                  gid,
+		VerboseLog:           *verboseLog,
+		DebugContext:         *debugContext,
+		Alignment:            alignment,
+		StatFsScale:          *statFsScale,
+		ReadOnly:             *readOnly,
+		MaxOpenFiles:         *maxOpenFiles,
+		WriteVisibilityDelay: *writeVisibilityDelay,
+	}
+	slowFs := fuselayer.NewSlowFsWithOptions(*backingDir, scheduler, fsOpts)
+	fs := pathfs.NewPathNodeFs(slowFs, nil)
+	afterUnmount = append(afterUnmount, func() {
+		fmt.Printf("Total injected delay: %s\n", slowFs.TotalInjectedDelay())
+		fmt.Printf("Operations slower than modeled: %d\n", slowFs.Underruns())
+	})
+	if *summaryJSON != "" {
+		afterUnmount = append(afterUnmount, func() {
+			if err := writeSummaryJSON(*summaryJSON, scheduler, slowFs); err != nil {
+				log.Printf("Error writing summary: %v", err)
+			} else {
+				fmt.Printf("Wrote summary to %s\n", *summaryJSON)
+			}
+		})
+	}
+	if *fileStatsTop > 0 {
+		afterUnmount = append(afterUnmount, func() {
+			printFileStats(scheduler.FileStats(), *fileStatsTop)
+		})
+	}
+	if *statsAddr != "" {
+		statsServer, err := serveStats(*statsAddr, scheduler, slowFs)
+		if err != nil {
+			log.Fatalf("couldn't serve stats on %s: %s", *statsAddr, err)
+		}
+		afterUnmount = append(afterUnmount, shutdownHTTP(statsServer))
+	}
+	if *metricsAddr != "" {
+		metricsServer, err := serveHTTP(*metricsAddr, "/metrics", metrics.PrometheusHandler(labels, scheduler))
+		if err != nil {
+			log.Fatalf("couldn't serve metrics on %s: %s", *metricsAddr, err)
+		}
+		afterUnmount = append(afterUnmount, shutdownHTTP(metricsServer))
+	}
 	
 	// Create mount options with proper uid/gid mapping
 	mountOpts := &fuse.MountOptions{
@@ -360,33 +1577,143 @@ func main() {
 		Options: []string{
 			"default_permissions",
 		},
+		// The kernel's readahead reads are indistinguishable from the application's, so they
+		// are charged in full. Capping readahead limits how much unrequested data is charged.
+		MaxReadAhead: int(maxReadaheadBytes),
+	}
+	if *readOnly {
+		mountOpts.Options = append(mountOpts.Options, "ro")
 	}
 	
-	nodefsOpts := &nodefs.Options{}
-	
-	server, _, err := nodefs.Mount(*mountDir, fs.Root(), mountOpts, nodefsOpts)
-	if err != nil {
+	// Anything the kernel caches is served without reaching slowfs, hiding its modeled latency.
+	nodefsOpts := &nodefs.Options{
+		AttrTimeout:  *attrTimeout,
+		EntryTimeout: *entryTimeout,
+	}
+
+	// Each --mount gets a scheduler of its own. The flags for stats, metrics, tracing and signals
+	// other than SIGINT and SIGTERM only apply to the main mount.
+	var extraServers []*fuse.Server
+	unmountExtras := func() {
+		for i, server := range extraServers {
+			unmount(server, mounts[i].mountDir)
+		}
+	}
+	// abortMount undoes what has been done so far when mounting fails.
+	abortMount := func() {
+		unmountExtras()
 		// If mount fails and we're in secure mode, restore the directory
 		if *secureMode && secureBackingDir != "" {
 			if restoreErr := restoreFromSecureLocation(secureBackingDir, originalBackingDir); restoreErr != nil {
 				log.Printf("Failed to restore directory after mount error: %v", restoreErr)
 			}
 		}
+	}
+	for _, spec := range mounts {
+		name := spec.configName
+		if name == "" {
+			name = *configName
+		}
+		mountConfig, mountConfigs, err := loadConfig(name)
+		var mountPathConfigs map[string]*slowfs.DeviceConfig
+		if err == nil {
+			mountPathConfigs, err = resolvePathConfigs(mountConfig, mountConfigs)
+		}
+		var server *fuse.Server
+		if err == nil {
+			server, err = mountExtra(spec, mountConfig, mountPathConfigs, fsOpts, mountOpts, nodefsOpts)
+		}
+		if err != nil {
+			abortMount()
+			log.Fatalf("mount %s: %s", spec.mountDir, err)
+		}
+		extraServers = append(extraServers, server)
+	}
+	if len(extraServers) > 0 {
+		var unmountOnce sync.Once
+		beforeUnmount = append(beforeUnmount, func() {
+			unmountOnce.Do(unmountExtras)
+		})
+	}
+
+	server, _, err := nodefs.Mount(*mountDir, fs.Root(), mountOpts, nodefsOpts)
+	if err != nil {
+		abortMount()
 		log.Fatalf("%v", err)
 	}
 
 	fmt.Printf("Mounted %s at %s with uid=%d, gid=%d\n", *backingDir, *mountDir, uid, gid)
+	if *debugContext {
+		printMountSettings(server, mountOpts)
+	}
 	log.Printf("SlowFS started: backing=%s mount=%s config=%s secure=%v", *backingDir, *mountDir, *configName, *secureMode)
 	
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	
+	// List open files on SIGUSR1, like lsof for the mount.
+	dumpChan := make(chan os.Signal, 1)
+	signal.Notify(dumpChan, syscall.SIGUSR1)
+	go func() {
+		for range dumpChan {
+			printOpenFiles(slowFs.OpenFiles())
+			fmt.Printf("Total injected delay: %s\n", slowFs.TotalInjectedDelay())
+			fmt.Printf("Operations slower than modeled: %d\n", slowFs.Underruns())
+		}
+	}()
+
+	// Simulate unplugging and reattaching the device on SIGUSR2.
+	unplugChan := make(chan os.Signal, 1)
+	signal.Notify(unplugChan, syscall.SIGUSR2)
+	go func() {
+		for range unplugChan {
+			if slowFs.Detached() {
+				slowFs.Reattach()
+				log.Printf("Device reattached")
+			} else {
+				slowFs.Detach()
+				log.Printf("Device detached, all operations fail with EIO until the next SIGUSR2")
+			}
+		}
+	}()
+
+	// Reload the device config on SIGHUP, so it can be tuned without remounting.
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			newConfig, _, err := loadConfig(*configName)
+			if err == nil {
+				err = scheduler.UpdateConfig(newConfig)
+			}
+			if err != nil {
+				log.Printf("Config reload rejected, still using the previous config: %s", err)
+				continue
+			}
+			log.Printf("Config reloaded: %s", newConfig)
+		}
+	}()
+
+	// Shut down the same way when stdin closes, so a mount doesn't outlive the parent process
+	// which started it.
+	stdinClosed := make(chan struct{})
+	if *exitOnStdinEOF {
+		go func() {
+			io.Copy(io.Discard, os.Stdin)
+			close(stdinClosed)
+		}()
+	}
+
 	// Handle cleanup in a separate goroutine
 	go func() {
-		sig := <-sigChan
-		log.Printf("Received signal %v, initiating shutdown...", sig)
-		cleanup(server, secureBackingDir, originalBackingDir, *mountDir, *secureMode)
+		select {
+		case sig := <-sigChan:
+			log.Printf("Received signal %v, initiating shutdown...", sig)
+		case <-stdinClosed:
+			log.Printf("Stdin closed, initiating shutdown...")
+		}
+		cleanup(server, secureBackingDir, originalBackingDir, *mountDir, *secureMode, beforeUnmount, afterUnmount)
 		log.Printf("SlowFS shutdown completed")
 		os.Exit(0)
 	}()
@@ -395,5 +1722,5 @@ func main() {
 	server.Serve()
 	
 	// If we reach here, server.Serve() returned, so clean up
-	cleanup(server, secureBackingDir, originalBackingDir, *mountDir, *secureMode)
+	cleanup(server, secureBackingDir, originalBackingDir, *mountDir, *secureMode, beforeUnmount, afterUnmount)
 }
@@ -0,0 +1,136 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/scheduler"
+	"strings"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/nodefs"
+	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
+)
+
+// mountSpec describes a filesystem to mount, given by --mount.
+type mountSpec struct {
+	backingDir string
+	mountDir   string
+	// The name of the config to use, or empty for --config-name.
+	configName string
+}
+
+// mountFlag collects mount specs like backing=/a,mount=/b,config=ssd from a flag which can be
+// repeated.
+type mountFlag []mountSpec
+
+func (m *mountFlag) String() string {
+	specs := make([]string, len(*m))
+	for i, spec := range *m {
+		specs[i] = fmt.Sprintf("backing=%s,mount=%s", spec.backingDir, spec.mountDir)
+		if spec.configName != "" {
+			specs[i] += ",config=" + spec.configName
+		}
+	}
+	return strings.Join(specs, " ")
+}
+
+func (m *mountFlag) Set(value string) error {
+	var spec mountSpec
+	for _, pair := range strings.Split(value, ",") {
+		keyAndValue := strings.SplitN(pair, "=", 2)
+		if len(keyAndValue) != 2 {
+			return fmt.Errorf("want key=value, got %q", pair)
+		}
+		switch keyAndValue[0] {
+		case "backing":
+			spec.backingDir = keyAndValue[1]
+		case "mount":
+			spec.mountDir = keyAndValue[1]
+		case "config":
+			spec.configName = keyAndValue[1]
+		default:
+			return fmt.Errorf("unknown key %q, want backing, mount or config", keyAndValue[0])
+		}
+	}
+	if spec.backingDir == "" || spec.mountDir == "" {
+		return fmt.Errorf("both backing and mount are required, got %q", value)
+	}
+	*m = append(*m, spec)
+	return nil
+}
+
+// mountExtra mounts the backing directory of spec, with a scheduler of its own using config and
+// pathConfigs, and starts serving it. opts are used for the filesystem, apart from its owner,
+// which is taken from the backing directory, and its alignment, which is taken from config.
+func mountExtra(spec mountSpec, config *slowfs.DeviceConfig, pathConfigs map[string]*slowfs.DeviceConfig, opts fuselayer.Options, mountOpts *fuse.MountOptions, nodefsOpts *nodefs.Options) (*fuse.Server, error) {
+	uid, gid, err := getDirectoryOwner(spec.backingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backing directory owner of %s: %v", spec.backingDir, err)
+	}
+	opts.Uid, opts.Gid = uid, gid
+	opts.Alignment = 0
+	if config.StrictAlignment {
+		opts.Alignment = config.BlockSize
+	}
+
+	slowFs := fuselayer.NewSlowFsWithOptions(spec.backingDir, scheduler.NewWithPathConfigs(config, pathConfigs), opts)
+	fs := pathfs.NewPathNodeFs(slowFs, nil)
+	server, _, err := nodefs.Mount(spec.mountDir, fs.Root(), mountOpts, nodefsOpts)
+	if err != nil {
+		return nil, err
+	}
+	go server.Serve()
+	if err := server.WaitMount(); err != nil {
+		unmount(server, spec.mountDir)
+		return nil, err
+	}
+	fmt.Printf("Mounted %s at %s with uid=%d, gid=%d, config=%s\n", spec.backingDir, spec.mountDir, uid, gid, config.Name)
+	return server, nil
+}
+
+// absMountSpec returns spec with absolute paths, checking that they are usable.
+func absMountSpec(spec mountSpec) (mountSpec, error) {
+	var err error
+	if spec.backingDir, err = filepath.Abs(spec.backingDir); err != nil {
+		return spec, fmt.Errorf("invalid backing directory: %v", err)
+	}
+	if spec.mountDir, err = filepath.Abs(spec.mountDir); err != nil {
+		return spec, fmt.Errorf("invalid mount directory: %v", err)
+	}
+	if spec.backingDir == spec.mountDir {
+		return spec, fmt.Errorf("backing directory %s may not be the same as mount directory", spec.backingDir)
+	}
+	return spec, nil
+}
+
+// unmount unmounts server from mountPath, forcing it if a normal unmount fails.
+func unmount(server *fuse.Server, mountPath string) {
+	err := server.Unmount()
+	if err == nil {
+		fmt.Printf("Filesystem at %s unmounted successfully\n", mountPath)
+		return
+	}
+	log.Printf("Normal unmount of %s failed: %v", mountPath, err)
+	if forceErr := forceUnmount(mountPath); forceErr != nil {
+		log.Printf("ERROR: Force unmount also failed: %v", forceErr)
+	} else {
+		log.Printf("Filesystem forcefully unmounted")
+	}
+}
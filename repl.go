@@ -0,0 +1,184 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const replHelp = `commands:
+  read PATH OFFSET SIZE    read SIZE bytes of PATH at OFFSET (e.g. read /foo 0 4k)
+  write PATH OFFSET SIZE   write SIZE bytes of PATH at OFFSET
+  seek PATH OFFSET         move to OFFSET in PATH, as a zero byte read
+  fsync PATH               fsync PATH
+  close PATH               close PATH
+  open PATH                open PATH
+  stat PATH                stat PATH
+  wait DURATION            let the device idle for DURATION (e.g. wait 500ms)
+  state                    show the device state
+  help                     show this help
+  quit                     exit`
+
+// runRepl implements "slowfs repl": it reads requests from stdin, one per line, and prints how
+// long the chosen device config takes to serve each one, without mounting anything.
+func runRepl(args []string, configs map[string]*slowfs.DeviceConfig) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	configFile := flags.String("config-file", "", "path to config file listing device configurations, or a directory of such files")
+	configName := flags.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, network)")
+	flags.Parse(args)
+
+	if *configFile != "" {
+		if err := loadConfigs(*configFile, configs); err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+	config, ok := configs[*configName]
+	if !ok {
+		log.Fatalf("unknown config %s", *configName)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("invalid config %s: %s", *configName, err)
+	}
+
+	fmt.Printf("modeling %s; type help for commands\n", config.Name)
+	repl(os.Stdin, os.Stdout, scheduler.NewModel(config))
+}
+
+// repl runs commands read from in against m, writing results to out, until in ends or the quit
+// command.
+func repl(in io.Reader, out io.Writer, m *scheduler.Model) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "quit", "exit":
+			return
+		case "help":
+			fmt.Fprintln(out, replHelp)
+		case "state":
+			printModelState(out, m.State())
+		case "wait":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: wait DURATION")
+				continue
+			}
+			d, err := time.ParseDuration(fields[1])
+			if err != nil || d < 0 {
+				fmt.Fprintf(out, "invalid duration %q\n", fields[1])
+				continue
+			}
+			m.Wait(d)
+		default:
+			req, err := parseReplRequest(fields)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			opTime, err := m.Run(req)
+			if err != nil {
+				fmt.Fprintf(out, "%s took %s and failed: %s\n", req.Type, opTime, err)
+			} else {
+				fmt.Fprintf(out, "%s took %s\n", req.Type, opTime)
+			}
+			printModelState(out, m.State())
+		}
+	}
+}
+
+// parseReplRequest turns a request command like "read /foo 0 4k" into a Request.
+func parseReplRequest(fields []string) (*scheduler.Request, error) {
+	types := map[string]scheduler.RequestType{
+		"read":  scheduler.ReadRequest,
+		"write": scheduler.WriteRequest,
+		"seek":  scheduler.ReadRequest,
+		"fsync": scheduler.FsyncRequest,
+		"close": scheduler.CloseRequest,
+		"open":  scheduler.OpenRequest,
+		"stat":  scheduler.StatRequest,
+	}
+	usage := map[string]string{
+		"read":  "read PATH OFFSET SIZE",
+		"write": "write PATH OFFSET SIZE",
+		"seek":  "seek PATH OFFSET",
+	}
+
+	typ, ok := types[fields[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q; type help for commands", fields[0])
+	}
+	req := &scheduler.Request{Type: typ}
+
+	numArgs := 1
+	if u, ok := usage[fields[0]]; ok {
+		numArgs = len(strings.Fields(u)) - 1
+	}
+	if len(fields)-1 != numArgs {
+		if u, ok := usage[fields[0]]; ok {
+			return nil, fmt.Errorf("usage: %s", u)
+		}
+		return nil, fmt.Errorf("usage: %s PATH", fields[0])
+	}
+	req.Path = fields[1]
+
+	var err error
+	if numArgs >= 2 {
+		if req.Start, err = parseReplSize(fields[2]); err != nil {
+			return nil, fmt.Errorf("invalid offset %q: %s", fields[2], err)
+		}
+	}
+	if numArgs >= 3 {
+		if req.Size, err = parseReplSize(fields[3]); err != nil {
+			return nil, fmt.Errorf("invalid size %q: %s", fields[3], err)
+		}
+	}
+	return req, nil
+}
+
+// parseReplSize parses a size like the config does, but also accepts a plain number of bytes and
+// the shorthand suffixes k, m, g and t for KiB, MiB, GiB and TiB, which are quicker to type.
+func parseReplSize(s string) (units.NumBytes, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return units.NumBytes(n), nil
+	}
+	if strings.ContainsAny(s[len(s)-1:], "kmgtKMGT") {
+		s += "iB"
+	}
+	return units.ParseNumBytesFromString(s)
+}
+
+func printModelState(out io.Writer, state scheduler.ModelState) {
+	fmt.Fprintf(out, "  now=%s busyUntil=%s dirty=%s position=%s@%s\n",
+		state.Now, state.BusyUntil, state.DirtyBytes, state.LastAccessedFile, state.FirstUnseenByte)
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"strings"
+)
+
+// runReplay implements "slowfs replay": it runs the requests in a trace written by --trace-file
+// through each of the chosen device configs, without mounting anything, and prints the total
+// time each takes.
+func runReplay(args []string, configs map[string]*slowfs.DeviceConfig) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configFile := flags.String("config-file", "", "path to config file listing device configurations, or a directory of such files")
+	configNames := flags.String("config-name", "hdd7200rpm", "comma separated configs to replay the trace against (built-ins: hdd7200rpm)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: slowfs replay [flags] TRACE_FILE")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *configFile != "" {
+		if err := loadConfigs(*configFile, configs); err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+	for _, name := range strings.Split(*configNames, ",") {
+		config, ok := configs[name]
+		if !ok {
+			log.Fatalf("unknown config %s", name)
+		}
+		if err := config.Validate(); err != nil {
+			log.Fatalf("invalid config %s: %s", name, err)
+		}
+
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("couldn't open trace: %s", err)
+		}
+		total, err := scheduler.ReplayTrace(f, config)
+		f.Close()
+		if err != nil {
+			log.Fatalf("couldn't replay %s: %s", flags.Arg(0), err)
+		}
+		fmt.Printf("%s: %s\n", name, total)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"log"
 	"slowfs/slowfs/units"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -37,6 +39,11 @@ const (
 	// IO time. When fsync is called on a file, how much unwritten data remaining for that file
 	// determines how long the fsync takes.
 	WriteBackCachedFsync
+	// GlobalWriteBackCachedFsync simulates a write back cache like WriteBackCachedFsync, but an
+	// fsync writes back the unwritten data of every file, so its cost depends on all dirty data on
+	// the device rather than only its own file's. It is shorthand for WriteBackCachedFsync with
+	// DeviceConfig.GlobalFsync set, and behaves the same.
+	GlobalWriteBackCachedFsync
 )
 
 func (f FsyncStrategy) String() string {
@@ -47,6 +54,8 @@ func (f FsyncStrategy) String() string {
 		return "DumbFsync"
 	case WriteBackCachedFsync:
 		return "WriteBackCachedFsync"
+	case GlobalWriteBackCachedFsync:
+		return "GlobalWriteBackCachedFsync"
 	default:
 		return "unknown fsync strategy"
 	}
@@ -63,11 +72,18 @@ func ParseFsyncStrategyFromString(s string) (FsyncStrategy, error) {
 		return DumbFsync, nil
 	case "writebackcachedfsync", "writebackcache", "wbc":
 		return WriteBackCachedFsync, nil
+	case "globalwritebackcachedfsync", "globalwritebackcache", "wbc-global":
+		return GlobalWriteBackCachedFsync, nil
 	default:
 		return 0, fmt.Errorf("unknown fsync strategy %s", s)
 	}
 }
 
+// UsesWriteBackCache reports whether f simulates a write back cache.
+func (f FsyncStrategy) UsesWriteBackCache() bool {
+	return f == WriteBackCachedFsync || f == GlobalWriteBackCachedFsync
+}
+
 // WriteStrategy indicates which strategy to use for write simulation.
 type WriteStrategy int
 
@@ -106,6 +122,139 @@ func ParseWriteStrategyFromString(s string) (WriteStrategy, error) {
 	}
 }
 
+// AtimeMode indicates when reads update a file's access time, which costs a metadata write.
+type AtimeMode int
+
+const (
+	// NoAtime means reads never update access time.
+	NoAtime AtimeMode = iota
+	// RelAtime means reads only update access time if it is older than the last modification, or
+	// more than a day old.
+	RelAtime
+	// StrictAtime means every read updates access time.
+	StrictAtime
+)
+
+func (a AtimeMode) String() string {
+	switch a {
+	case NoAtime:
+		return "NoAtime"
+	case RelAtime:
+		return "RelAtime"
+	case StrictAtime:
+		return "StrictAtime"
+	default:
+		return "unknown atime mode"
+	}
+}
+
+// ParseAtimeModeFromString parses an AtimeMode from the given string. This function is case
+// insensitive, and accepts both the mount option names (e.g. relatime) and shorter synonyms
+// (e.g. rel).
+func ParseAtimeModeFromString(s string) (AtimeMode, error) {
+	switch strings.ToLower(s) {
+	case "noatime", "no", "none":
+		return NoAtime, nil
+	case "relatime", "rel":
+		return RelAtime, nil
+	case "strictatime", "strict":
+		return StrictAtime, nil
+	default:
+		return 0, fmt.Errorf("unknown atime mode %s", s)
+	}
+}
+
+// WriteBackOrder indicates which files the write back cache writes back first in spare time, which
+// decides whose data would survive a crash.
+type WriteBackOrder int
+
+const (
+	// RandomWriteBack means files are written back in a random order.
+	RandomWriteBack WriteBackOrder = iota
+	// OldestFirstWriteBack means the file which has been dirty longest is written back first.
+	OldestFirstWriteBack
+	// LargestFirstWriteBack means the file with the most dirty data is written back first.
+	LargestFirstWriteBack
+	// RoundRobinWriteBack means files take turns, each stretch of spare time starting with the
+	// file after the one last written back.
+	RoundRobinWriteBack
+)
+
+func (o WriteBackOrder) String() string {
+	switch o {
+	case RandomWriteBack:
+		return "Random"
+	case OldestFirstWriteBack:
+		return "OldestFirst"
+	case LargestFirstWriteBack:
+		return "LargestFirst"
+	case RoundRobinWriteBack:
+		return "RoundRobin"
+	default:
+		return "unknown write back order"
+	}
+}
+
+// ParseWriteBackOrderFromString parses a WriteBackOrder from the given string. This function is
+// case insensitive, and accepts shorter synonyms (e.g. oldest).
+func ParseWriteBackOrderFromString(s string) (WriteBackOrder, error) {
+	switch strings.ToLower(s) {
+	case "random":
+		return RandomWriteBack, nil
+	case "oldestfirst", "oldest":
+		return OldestFirstWriteBack, nil
+	case "largestfirst", "largest":
+		return LargestFirstWriteBack, nil
+	case "roundrobin", "rr":
+		return RoundRobinWriteBack, nil
+	default:
+		return 0, fmt.Errorf("unknown write back order %s", s)
+	}
+}
+
+// SchedulerPolicy indicates how reads and writes made within RequestReorderMaxDelay of each other
+// are reordered before the device serves them.
+type SchedulerPolicy int
+
+const (
+	// SequentialSchedulerPolicy moves a request next to one it would make a sequential access with,
+	// and otherwise leaves requests in the order they were made.
+	SequentialSchedulerPolicy SchedulerPolicy = iota
+	// FIFOSchedulerPolicy serves requests in the order they were made.
+	FIFOSchedulerPolicy
+	// SCANSchedulerPolicy serves requests like an elevator, sweeping from the device's current
+	// position through the waiting requests in order of file and offset, then sweeping back.
+	SCANSchedulerPolicy
+)
+
+func (p SchedulerPolicy) String() string {
+	switch p {
+	case SequentialSchedulerPolicy:
+		return "Sequential"
+	case FIFOSchedulerPolicy:
+		return "FIFO"
+	case SCANSchedulerPolicy:
+		return "SCAN"
+	default:
+		return "unknown scheduler policy"
+	}
+}
+
+// ParseSchedulerPolicyFromString parses a SchedulerPolicy from the given string. This function is
+// case insensitive.
+func ParseSchedulerPolicyFromString(s string) (SchedulerPolicy, error) {
+	switch strings.ToLower(s) {
+	case "sequential":
+		return SequentialSchedulerPolicy, nil
+	case "fifo":
+		return FIFOSchedulerPolicy, nil
+	case "scan", "elevator":
+		return SCANSchedulerPolicy, nil
+	default:
+		return 0, fmt.Errorf("unknown scheduler policy %s", s)
+	}
+}
+
 // DeviceConfig is used to describe how a physical medium acts (e.g. rotational hard drive).
 type DeviceConfig struct {
 	// Name is the name of this configuration. This is used for selecting on the command line which
@@ -141,10 +290,227 @@ type DeviceConfig struct {
 
 	// MetadataOpTime denotes how long metadata operations (like chmod, chown, etc) should take.
 	MetadataOpTime time.Duration
+
+	// MinFsyncInterval denotes the minimum time between the completion of one fsync and the start
+	// of the next. Fsyncs arriving sooner are delayed until the interval has elapsed, which models
+	// storage that limits how often it can make data durable. Optional.
+	MinFsyncInterval time.Duration
+
+	// TransientReadErrorRate is the probability (between 0 and 1) that a read fails with EIO. If
+	// the same read is retried shortly afterwards it succeeds, after an extra
+	// TransientErrorRecoveryTime modeling the drive's internal retry. Optional.
+	TransientReadErrorRate float64
+
+	// TransientErrorRecoveryTime denotes how much longer a retried read takes after a transient
+	// error. Optional.
+	TransientErrorRecoveryTime time.Duration
+
+	// ReadErrorRate and WriteErrorRate are the probabilities (between 0 and 1) that a read or
+	// write fails with EIO, as on flaky hardware. Unlike TransientReadErrorRate, retrying doesn't
+	// help. Failed operations still take their modeled time. Optional.
+	ReadErrorRate  float64
+	WriteErrorRate float64
+
+	// DelayedAllocation models filesystems which allocate blocks at write back time rather than
+	// when fallocate is called. The cost of allocating is paid when the file is fsynced, and since
+	// files get laid out contiguously, skipping ahead within a file doesn't count as a seek.
+	// Optional.
+	DelayedAllocation bool
+
+	// AtimeMode denotes when reads update access time. Updating access time costs MetadataOpTime
+	// on top of the read. Optional.
+	AtimeMode AtimeMode
+
+	// ReadOpTime, WriteOpTime and FsyncOpTime denote fixed per-operation overheads, added on top
+	// of the modeled cost of reads, writes and fsyncs respectively. Optional.
+	ReadOpTime  time.Duration
+	WriteOpTime time.Duration
+	FsyncOpTime time.Duration
+
+	// ColdWritePenalty denotes how much longer a write takes when it touches part of a file that
+	// has never been written, compared to overwriting. This models the allocation and
+	// copy-on-write work thin-provisioned and copy-on-write storage does on first write. Optional.
+	ColdWritePenalty time.Duration
+
+	// DirtyBackgroundBytes and DirtyBytes model Linux's dirty page thresholds when using the write
+	// back cache. Spare time is only spent writing back data while more than DirtyBackgroundBytes
+	// are dirty. Once a write would take the cache past DirtyBytes, the writer waits for the bytes
+	// over the limit to be written back, so writes slow down gradually rather than hitting a cliff.
+	// Optional.
+	DirtyBackgroundBytes units.NumBytes
+	DirtyBytes           units.NumBytes
+
+	// WriteBackCacheSize and WriteBackHighWaterMark model a drive's own write cache saturating
+	// under sustained writes when using the write back cache. Writes stay fast while less than
+	// WriteBackHighWaterMark is dirty. Past it, part of each write waits to be written back, in
+	// proportion to how far the cache is between the high water mark and WriteBackCacheSize, so
+	// once the cache is full writes go no faster than the device can write. Optional.
+	WriteBackCacheSize     units.NumBytes
+	WriteBackHighWaterMark units.NumBytes
+
+	// LyingFsync models devices whose fsync returns before data is durable. With the write back
+	// cache, fsync only costs FsyncOpTime and the file's data stays dirty until it is written back
+	// in spare time, so it would be lost in a crash until then. Optional.
+	LyingFsync bool
+
+	// TargetReadLatency and TargetWriteLatency pin the latency of reads and writes for test
+	// determinism. Requests which would finish sooner are delayed until the target, which doesn't
+	// occupy the modeled device. Requests taking longer are counted and logged as missing the
+	// target. Optional.
+	TargetReadLatency  time.Duration
+	TargetWriteLatency time.Duration
+
+	// MetadataCacheSize denotes how many paths the modeled dentry and inode cache holds. Repeated
+	// stats of a cached path are free, while paths which haven't been looked up recently cost
+	// MetadataOpTime. Renaming, removing or changing the attributes of a path drops it from the
+	// cache. Optional.
+	MetadataCacheSize int
+
+	// Triggers degrade the device after a number of operations have run. Optional.
+	Triggers []Trigger
+
+	// BlockSize denotes the device's block size. With StrictAlignment, reads and writes whose
+	// offset or size isn't a multiple of it fail with EINVAL, as they would with O_DIRECT on a real
+	// block device. Optional.
+	BlockSize       units.NumBytes
+	StrictAlignment bool
+
+	// BlockGroupSize denotes the size of the filesystem's block groups, as on ext filesystems.
+	// Sequential access which crosses into the next block group pays BlockGroupSeekTime, or
+	// SeekTime if that is not set. Optional.
+	BlockGroupSize     units.NumBytes
+	BlockGroupSeekTime time.Duration
+
+	// FlushOnClose denotes whether closing a file writes back its dirty data first, as with
+	// filesystems or mount options which sync on close. Otherwise the data stays in the write back
+	// cache. Only has an effect with the WriteBackCachedFsync strategy. Optional.
+	FlushOnClose bool
+
+	// LatencyHistogramFile names a file of measured latencies to sample operation times from,
+	// in the format read by ParseLatencyHistograms. Operations with a histogram take a sampled
+	// time instead of the modeled one, while others are modeled as usual. Loading the config
+	// loads the file into LatencyHistograms. Optional.
+	LatencyHistogramFile string
+	LatencyHistograms    map[string]*LatencyHistogram
+
+	// MetadataPerComponentTime denotes how much longer a metadata operation takes for each
+	// component of its path, modeling the directory lookups needed to resolve it. Optional.
+	MetadataPerComponentTime time.Duration
+
+	// TimeToFirstByte denotes how long a read which starts a new stream, by switching files or
+	// seeking, waits before data starts flowing, as with object stores or tape. It is charged in
+	// addition to SeekTime. Optional.
+	TimeToFirstByte time.Duration
+
+	// OpenDirTime denotes how long it takes to start listing a directory. If not set, listing a
+	// directory takes as long as other metadata operations. Optional.
+	OpenDirTime time.Duration
+
+	// ReaddirEntryTime denotes how much longer listing a directory takes for each entry in it, so
+	// listing huge directories on slow media costs more than listing small ones. Optional.
+	ReaddirEntryTime time.Duration
+
+	// OpenTime denotes how long opening a file takes, which on a real disk may include a seek to
+	// fetch a cold inode. If not set, opening a file takes as long as other metadata operations.
+	// Optional.
+	OpenTime time.Duration
+
+	// RandomReadBytesPerSecond and RandomWriteBytesPerSecond denote the throughput of reads and
+	// writes which seek, which on a hard disk is far lower than sequential throughput. They
+	// default to ReadBytesPerSecond and WriteBytesPerSecond. Optional.
+	RandomReadBytesPerSecond  units.NumBytes
+	RandomWriteBytesPerSecond units.NumBytes
+
+	// ReadAheadBytes denotes how far past the end of each read the device prefetches in spare
+	// time. Reads of prefetched data take only MetadataOpTime. Optional.
+	ReadAheadBytes units.NumBytes
+
+	// RPM denotes how fast a hard disk spins. Every read and write waits on average half a
+	// revolution for its data to come under the head, even without seeking. Optional.
+	RPM int
+
+	// QueueDepth denotes how many requests the device serves in parallel, like an NVMe drive
+	// with several requests in flight. Each request is served as soon as any of them is free,
+	// except fsyncs, which wait for all of them. Optional.
+	QueueDepth int
+
+	// MaxIOPS caps how many reads and writes complete in any one second, however small they are,
+	// as devices have a limit on operations as well as bandwidth. Optional.
+	MaxIOPS int
+
+	// MetadataIOPS caps how many metadata operations (lookups, opens, directory listings and
+	// other metadata changes) complete per second, independently of data I/O, modeling a
+	// metadata server bottleneck. Optional.
+	MetadataIOPS int
+
+	// GlobalFsync denotes whether an fsync writes back all dirty data on the device rather than
+	// just its file's, as when fsync flushes a shared journal (e.g. ext3 with data=ordered). Only
+	// has an effect with the WriteBackCachedFsync strategy, which then behaves the same as the
+	// GlobalWriteBackCachedFsync strategy. Optional.
+	GlobalFsync bool
+
+	// SeparateMetadataQueue denotes whether metadata operations (like stat and listing directories)
+	// are served separately from reads and writes, as from a separate cache or channel. They then
+	// queue only behind each other, rather than behind data I/O. Optional.
+	SeparateMetadataQueue bool
+
+	// WriteBackOrder denotes which files the write back cache writes back first in spare time.
+	// Optional, files are written back in a random order by default.
+	WriteBackOrder WriteBackOrder
+
+	// PathLatencies pin how long operations on particular paths take, in place of the modeled
+	// time. The first one matching a request's path and operation applies. Optional.
+	PathLatencies []PathLatency
+
+	// PathConfigs maps path prefixes, relative to the mount point, to the names of other configs
+	// whose devices serve the paths under them instead, e.g. {"fast": "ssd"} to put fast/ on an SSD
+	// of its own. Each prefix gets its own device, and the longest matching prefix applies. The
+	// configs named cannot have PathConfigs themselves. Optional.
+	PathConfigs map[string]string
+
+	// CorruptionProbability is the probability (between 0 and 1) that a read succeeds but returns
+	// silently corrupted data, with CorruptionBytes bytes flipped, as only a checksum would catch.
+	// The backing files are left alone. Optional.
+	CorruptionProbability float64
+
+	// CorruptionBytes is how many consecutive bytes a corrupted read has flipped, e.g. 512 for a
+	// whole bad sector, capped at the size of the read. Optional, defaults to 1.
+	CorruptionBytes int
+
+	// LatencyJitter is the fraction by which each request's time randomly varies either way, e.g.
+	// 0.1 for ±10%, modeling the variance from controller queues and background tasks. Optional.
+	LatencyJitter float64
+
+	// NetworkLatency is the round trip time every request pays on top of the rest of its time, as
+	// with NFS or an object store. Unlike SeekTime, metadata operations and sequential I/O pay it
+	// too. Optional.
+	NetworkLatency time.Duration
+
+	// MetadataOpTimes maps the names of metadata operations, like "rename" or "getattr", to how
+	// long they take in place of MetadataOpTime, as a rename or unlink usually costs more than a
+	// stat. OpenTime and OpenDirTime still take precedence for opens and directory listings.
+	// Optional.
+	MetadataOpTimes map[string]time.Duration
+
+	// SchedulerPolicy denotes how reads and writes made within RequestReorderMaxDelay of each
+	// other are reordered. Optional, requests are only moved to make sequential accesses by default.
+	SchedulerPolicy SchedulerPolicy
+
+	// MaxOpDelay caps how long any single operation takes, including waiting for the device, so a
+	// misconfigured device can't stall the application under test for minutes. The device is done
+	// with a capped operation once the cap has passed. Optional, operations aren't capped by
+	// default.
+	MaxOpDelay time.Duration
+
+	// SimulatedCapacity denotes the size of the device. When set, statfs reports it as the size of
+	// the filesystem, with the bytes used tracked by the scheduler taken off its free space,
+	// instead of the backing filesystem's numbers. Optional, the backing filesystem's size and
+	// free space are passed through by default.
+	SimulatedCapacity units.NumBytes
 }
 
 func (dc *DeviceConfig) String() string {
-	return fmt.Sprintf(`%s:
+	s := fmt.Sprintf(`%s:
   %-22s %s
   %-22s %s
   %-22s %s
@@ -158,8 +524,85 @@ func (dc *DeviceConfig) String() string {
 		"ReadBytesPerSecond", dc.ReadBytesPerSecond, "WriteBytesPerSecond", dc.WriteBytesPerSecond,
 		"AllocateBytesPerSecond", dc.AllocateBytesPerSecond, "RequestReorderMaxDelay", dc.RequestReorderMaxDelay,
 		"FsyncStrategy", dc.FsyncStrategy, "WriteStrategy", dc.WriteStrategy, "MetadataOpTime", dc.MetadataOpTime)
+
+	// Optional fields are only listed when set, so configs that don't use them print as before.
+	for _, f := range []struct {
+		name  string
+		value interface{}
+		set   bool
+	}{
+		{"MinFsyncInterval", dc.MinFsyncInterval, dc.MinFsyncInterval != 0},
+		{"TransientReadErrorRate", dc.TransientReadErrorRate, dc.TransientReadErrorRate != 0},
+		{"TransientErrorRecoveryTime", dc.TransientErrorRecoveryTime, dc.TransientErrorRecoveryTime != 0},
+		{"ReadErrorRate", dc.ReadErrorRate, dc.ReadErrorRate != 0},
+		{"WriteErrorRate", dc.WriteErrorRate, dc.WriteErrorRate != 0},
+		{"DelayedAllocation", dc.DelayedAllocation, dc.DelayedAllocation},
+		{"AtimeMode", dc.AtimeMode, dc.AtimeMode != NoAtime},
+		{"ReadOpTime", dc.ReadOpTime, dc.ReadOpTime != 0},
+		{"WriteOpTime", dc.WriteOpTime, dc.WriteOpTime != 0},
+		{"FsyncOpTime", dc.FsyncOpTime, dc.FsyncOpTime != 0},
+		{"ColdWritePenalty", dc.ColdWritePenalty, dc.ColdWritePenalty != 0},
+		{"DirtyBackgroundBytes", dc.DirtyBackgroundBytes, dc.DirtyBackgroundBytes != 0},
+		{"DirtyBytes", dc.DirtyBytes, dc.DirtyBytes != 0},
+		{"WriteBackCacheSize", dc.WriteBackCacheSize, dc.WriteBackCacheSize != 0},
+		{"WriteBackHighWaterMark", dc.WriteBackHighWaterMark, dc.WriteBackHighWaterMark != 0},
+		{"LyingFsync", dc.LyingFsync, dc.LyingFsync},
+		{"TargetReadLatency", dc.TargetReadLatency, dc.TargetReadLatency != 0},
+		{"TargetWriteLatency", dc.TargetWriteLatency, dc.TargetWriteLatency != 0},
+		{"MetadataCacheSize", dc.MetadataCacheSize, dc.MetadataCacheSize != 0},
+		{"Triggers", dc.Triggers, len(dc.Triggers) != 0},
+		{"BlockSize", dc.BlockSize, dc.BlockSize != 0},
+		{"StrictAlignment", dc.StrictAlignment, dc.StrictAlignment},
+		{"BlockGroupSize", dc.BlockGroupSize, dc.BlockGroupSize != 0},
+		{"BlockGroupSeekTime", dc.BlockGroupSeekTime, dc.BlockGroupSeekTime != 0},
+		{"FlushOnClose", dc.FlushOnClose, dc.FlushOnClose},
+		{"LatencyHistogramFile", dc.LatencyHistogramFile, dc.LatencyHistogramFile != ""},
+		{"MetadataPerComponentTime", dc.MetadataPerComponentTime, dc.MetadataPerComponentTime != 0},
+		{"TimeToFirstByte", dc.TimeToFirstByte, dc.TimeToFirstByte != 0},
+		{"OpenDirTime", dc.OpenDirTime, dc.OpenDirTime != 0},
+		{"ReaddirEntryTime", dc.ReaddirEntryTime, dc.ReaddirEntryTime != 0},
+		{"OpenTime", dc.OpenTime, dc.OpenTime != 0},
+		{"RandomReadBytesPerSecond", dc.RandomReadBytesPerSecond, dc.RandomReadBytesPerSecond != 0},
+		{"RandomWriteBytesPerSecond", dc.RandomWriteBytesPerSecond, dc.RandomWriteBytesPerSecond != 0},
+		{"ReadAheadBytes", dc.ReadAheadBytes, dc.ReadAheadBytes != 0},
+		{"RPM", dc.RPM, dc.RPM != 0},
+		{"QueueDepth", dc.QueueDepth, dc.QueueDepth != 0},
+		{"MaxIOPS", dc.MaxIOPS, dc.MaxIOPS != 0},
+		{"MetadataIOPS", dc.MetadataIOPS, dc.MetadataIOPS != 0},
+		{"GlobalFsync", dc.GlobalFsync, dc.GlobalFsync},
+		{"SeparateMetadataQueue", dc.SeparateMetadataQueue, dc.SeparateMetadataQueue},
+		{"WriteBackOrder", dc.WriteBackOrder, dc.WriteBackOrder != RandomWriteBack},
+		{"PathLatencies", dc.PathLatencies, len(dc.PathLatencies) != 0},
+		{"PathConfigs", dc.PathConfigs, len(dc.PathConfigs) != 0},
+		{"CorruptionProbability", dc.CorruptionProbability, dc.CorruptionProbability != 0},
+		{"CorruptionBytes", dc.CorruptionBytes, dc.CorruptionBytes != 0},
+		{"LatencyJitter", dc.LatencyJitter, dc.LatencyJitter != 0},
+		{"NetworkLatency", dc.NetworkLatency, dc.NetworkLatency != 0},
+		{"MetadataOpTimes", dc.MetadataOpTimes, len(dc.MetadataOpTimes) != 0},
+		{"SchedulerPolicy", dc.SchedulerPolicy, dc.SchedulerPolicy != SequentialSchedulerPolicy},
+		{"MaxOpDelay", dc.MaxOpDelay, dc.MaxOpDelay != 0},
+		{"SimulatedCapacity", dc.SimulatedCapacity, dc.SimulatedCapacity != 0},
+	} {
+		if f.set {
+			s += fmt.Sprintf("\n  %-22s %v", f.name, f.value)
+		}
+	}
+	return s
 }
 
+// CurrentConfigVersion is the version of the device config schema understood by
+// ParseDeviceConfigsFromJSON. Each config may give the version it was written for in a "Version"
+// field, and configs without one are treated as version 1.
+//
+// Versions:
+//   1: the required fields, plus optional fields which take their zero value when left out, which
+//      means the feature they configure is off.
+//
+// When the meaning of the schema changes, the version is bumped, and configs written for older
+// versions get defaults which keep their old behavior. Configs for versions newer than
+// CurrentConfigVersion are rejected, as they may rely on fields this parser doesn't know.
+const CurrentConfigVersion = 1
+
 func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 	var dc DeviceConfig
 
@@ -176,12 +619,121 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 		"MetadataOpTime":         {},
 	}
 
+	// Fields which may be left out, in which case they keep their zero value.
+	optionalFields := map[string]struct{}{
+		"MinFsyncInterval":           {},
+		"TransientReadErrorRate":     {},
+		"TransientErrorRecoveryTime": {},
+		"ReadErrorRate":              {},
+		"WriteErrorRate":             {},
+		"DelayedAllocation":          {},
+		"AtimeMode":                  {},
+		"ReadOpTime":                 {},
+		"WriteOpTime":                {},
+		"FsyncOpTime":                {},
+		"ColdWritePenalty":           {},
+		"DirtyBackgroundBytes":       {},
+		"DirtyBytes":                 {},
+		"WriteBackCacheSize":         {},
+		"WriteBackHighWaterMark":     {},
+		"LyingFsync":                 {},
+		"TargetReadLatency":          {},
+		"TargetWriteLatency":         {},
+		"MetadataCacheSize":          {},
+		"Triggers":                   {},
+		"BlockSize":                  {},
+		"StrictAlignment":            {},
+		"BlockGroupSize":             {},
+		"BlockGroupSeekTime":         {},
+		"FlushOnClose":               {},
+		"LatencyHistogramFile":       {},
+		"MetadataPerComponentTime":   {},
+		"TimeToFirstByte":            {},
+		"OpenDirTime":                {},
+		"ReaddirEntryTime":           {},
+		"OpenTime":                   {},
+		"RandomReadBytesPerSecond":   {},
+		"RandomWriteBytesPerSecond":  {},
+		"ReadAheadBytes":             {},
+		"RPM":                        {},
+		"QueueDepth":                 {},
+		"MaxIOPS":                    {},
+		"MetadataIOPS":               {},
+		"GlobalFsync":                {},
+		"SeparateMetadataQueue":      {},
+		"WriteBackOrder":             {},
+		"PathLatencies":              {},
+		"PathConfigs":                {},
+		"CorruptionProbability":      {},
+		"CorruptionBytes":            {},
+		"LatencyJitter":              {},
+		"NetworkLatency":             {},
+		"MetadataOpTimes":            {},
+		"SchedulerPolicy":            {},
+		"MaxOpDelay":                 {},
+		"SimulatedCapacity":          {},
+	}
+
+	if v, ok := obj["Version"]; ok {
+		strVal, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("Version: want string type, got %v", v)
+		}
+		version, err := strconv.Atoi(strVal)
+		if err != nil {
+			return nil, fmt.Errorf("Version: %s", err)
+		}
+		if version < 1 || version > CurrentConfigVersion {
+			return nil, fmt.Errorf("Version: unsupported version %d, this version of slowfs supports up to %d", version, CurrentConfigVersion)
+		}
+	}
+
 	for k, v := range obj {
-		if _, ok := missingFields[k]; !ok {
+		if k == "Version" {
+			continue
+		}
+		_, required := missingFields[k]
+		_, optional := optionalFields[k]
+		if !required && !optional {
 			return nil, fmt.Errorf("spurious field %s", k)
 		}
 		delete(missingFields, k)
 
+		// Triggers, PathLatencies, PathConfigs and MetadataOpTimes are the only fields which aren't
+		// plain strings.
+		if k == "Triggers" {
+			triggers, err := parseTriggers(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+			dc.Triggers = triggers
+			continue
+		}
+		if k == "PathLatencies" {
+			pathLatencies, err := parsePathLatencies(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+			dc.PathLatencies = pathLatencies
+			continue
+		}
+		if k == "PathConfigs" {
+			pathConfigs, err := parsePathConfigs(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+			dc.PathConfigs = pathConfigs
+			continue
+		}
+		if k == "MetadataOpTimes" {
+			metadataOpTimes, err := parseMetadataOpTimes(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+			dc.MetadataOpTimes = metadataOpTimes
+			continue
+		}
+
 		strVal, ok := v.(string)
 		if !ok {
 			return nil, fmt.Errorf("%s: want string type, got %v", k, v)
@@ -209,6 +761,101 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 			dc.WriteStrategy, err = ParseWriteStrategyFromString(strVal)
 		case "MetadataOpTime":
 			dc.MetadataOpTime, err = time.ParseDuration(strVal)
+		case "MinFsyncInterval":
+			dc.MinFsyncInterval, err = time.ParseDuration(strVal)
+		case "TransientReadErrorRate":
+			dc.TransientReadErrorRate, err = strconv.ParseFloat(strVal, 64)
+		case "TransientErrorRecoveryTime":
+			dc.TransientErrorRecoveryTime, err = time.ParseDuration(strVal)
+		case "ReadErrorRate":
+			dc.ReadErrorRate, err = strconv.ParseFloat(strVal, 64)
+		case "WriteErrorRate":
+			dc.WriteErrorRate, err = strconv.ParseFloat(strVal, 64)
+		case "DelayedAllocation":
+			dc.DelayedAllocation, err = strconv.ParseBool(strVal)
+		case "AtimeMode":
+			dc.AtimeMode, err = ParseAtimeModeFromString(strVal)
+		case "ReadOpTime":
+			dc.ReadOpTime, err = time.ParseDuration(strVal)
+		case "WriteOpTime":
+			dc.WriteOpTime, err = time.ParseDuration(strVal)
+		case "FsyncOpTime":
+			dc.FsyncOpTime, err = time.ParseDuration(strVal)
+		case "ColdWritePenalty":
+			dc.ColdWritePenalty, err = time.ParseDuration(strVal)
+		case "DirtyBackgroundBytes":
+			dc.DirtyBackgroundBytes, err = units.ParseNumBytesFromString(strVal)
+		case "DirtyBytes":
+			dc.DirtyBytes, err = units.ParseNumBytesFromString(strVal)
+		case "WriteBackCacheSize":
+			dc.WriteBackCacheSize, err = units.ParseNumBytesFromString(strVal)
+		case "WriteBackHighWaterMark":
+			dc.WriteBackHighWaterMark, err = units.ParseNumBytesFromString(strVal)
+		case "LyingFsync":
+			dc.LyingFsync, err = strconv.ParseBool(strVal)
+		case "TargetReadLatency":
+			dc.TargetReadLatency, err = time.ParseDuration(strVal)
+		case "TargetWriteLatency":
+			dc.TargetWriteLatency, err = time.ParseDuration(strVal)
+		case "MetadataCacheSize":
+			dc.MetadataCacheSize, err = strconv.Atoi(strVal)
+		case "BlockSize":
+			dc.BlockSize, err = units.ParseNumBytesFromString(strVal)
+		case "StrictAlignment":
+			dc.StrictAlignment, err = strconv.ParseBool(strVal)
+		case "BlockGroupSize":
+			dc.BlockGroupSize, err = units.ParseNumBytesFromString(strVal)
+		case "BlockGroupSeekTime":
+			dc.BlockGroupSeekTime, err = time.ParseDuration(strVal)
+		case "FlushOnClose":
+			dc.FlushOnClose, err = strconv.ParseBool(strVal)
+		case "LatencyHistogramFile":
+			dc.LatencyHistogramFile = strVal
+			dc.LatencyHistograms, err = LoadLatencyHistograms(strVal)
+		case "MetadataPerComponentTime":
+			dc.MetadataPerComponentTime, err = time.ParseDuration(strVal)
+		case "TimeToFirstByte":
+			dc.TimeToFirstByte, err = time.ParseDuration(strVal)
+		case "OpenDirTime":
+			dc.OpenDirTime, err = time.ParseDuration(strVal)
+		case "ReaddirEntryTime":
+			dc.ReaddirEntryTime, err = time.ParseDuration(strVal)
+		case "OpenTime":
+			dc.OpenTime, err = time.ParseDuration(strVal)
+		case "RandomReadBytesPerSecond":
+			dc.RandomReadBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
+		case "RandomWriteBytesPerSecond":
+			dc.RandomWriteBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
+		case "ReadAheadBytes":
+			dc.ReadAheadBytes, err = units.ParseNumBytesFromString(strVal)
+		case "RPM":
+			dc.RPM, err = strconv.Atoi(strVal)
+		case "QueueDepth":
+			dc.QueueDepth, err = strconv.Atoi(strVal)
+		case "MaxIOPS":
+			dc.MaxIOPS, err = strconv.Atoi(strVal)
+		case "MetadataIOPS":
+			dc.MetadataIOPS, err = strconv.Atoi(strVal)
+		case "GlobalFsync":
+			dc.GlobalFsync, err = strconv.ParseBool(strVal)
+		case "SeparateMetadataQueue":
+			dc.SeparateMetadataQueue, err = strconv.ParseBool(strVal)
+		case "CorruptionProbability":
+			dc.CorruptionProbability, err = strconv.ParseFloat(strVal, 64)
+		case "CorruptionBytes":
+			dc.CorruptionBytes, err = strconv.Atoi(strVal)
+		case "LatencyJitter":
+			dc.LatencyJitter, err = strconv.ParseFloat(strVal, 64)
+		case "NetworkLatency":
+			dc.NetworkLatency, err = time.ParseDuration(strVal)
+		case "WriteBackOrder":
+			dc.WriteBackOrder, err = ParseWriteBackOrderFromString(strVal)
+		case "SchedulerPolicy":
+			dc.SchedulerPolicy, err = ParseSchedulerPolicyFromString(strVal)
+		case "MaxOpDelay":
+			dc.MaxOpDelay, err = time.ParseDuration(strVal)
+		case "SimulatedCapacity":
+			dc.SimulatedCapacity, err = units.ParseNumBytesFromString(strVal)
 		default:
 			panic("bug")
 		}
@@ -242,7 +889,34 @@ func ParseDeviceConfigsFromJSON(data []byte) ([]*DeviceConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseDeviceConfigs(dcObjs)
+}
 
+// ParseDeviceConfigsFromYAML is like ParseDeviceConfigsFromJSON, but for a YAML document holding a
+// sequence of device configs. Fields take the same values as in JSON, e.g. SeekTime: 10ms, so the
+// same configs can be written in either format.
+func ParseDeviceConfigsFromYAML(data []byte) ([]*DeviceConfig, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	seq, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected sequence containing device configs")
+	}
+	dcObjs := make([]map[string]interface{}, 0, len(seq))
+	for _, item := range seq {
+		dcObj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected sequence containing device configs")
+		}
+		dcObjs = append(dcObjs, dcObj)
+	}
+	return parseDeviceConfigs(dcObjs)
+}
+
+// parseDeviceConfigs parses device configs from the objects of a config file.
+func parseDeviceConfigs(dcObjs []map[string]interface{}) ([]*DeviceConfig, error) {
 	dcs := make([]*DeviceConfig, 0, len(dcObjs))
 	for _, dcObj := range dcObjs {
 		dc, err := parseDeviceConfig(dcObj)
@@ -283,8 +957,167 @@ func (dc *DeviceConfig) Validate() error {
 	if dc.MetadataOpTime < 0 {
 		return errors.New("MetadataOpTime cannot be negative.")
 	}
+	if dc.MinFsyncInterval < 0 {
+		return errors.New("MinFsyncInterval cannot be negative.")
+	}
+	if dc.ReadOpTime < 0 {
+		return errors.New("ReadOpTime cannot be negative.")
+	}
+	if dc.WriteOpTime < 0 {
+		return errors.New("WriteOpTime cannot be negative.")
+	}
+	if dc.FsyncOpTime < 0 {
+		return errors.New("FsyncOpTime cannot be negative.")
+	}
+	if dc.ColdWritePenalty < 0 {
+		return errors.New("ColdWritePenalty cannot be negative.")
+	}
+	if dc.DirtyBackgroundBytes < 0 {
+		return errors.New("DirtyBackgroundBytes cannot be negative.")
+	}
+	if dc.DirtyBytes < 0 {
+		return errors.New("DirtyBytes cannot be negative.")
+	}
+	if dc.DirtyBytes > 0 && dc.DirtyBackgroundBytes > dc.DirtyBytes {
+		return errors.New("DirtyBackgroundBytes cannot be greater than DirtyBytes.")
+	}
+	if dc.WriteBackCacheSize < 0 {
+		return errors.New("WriteBackCacheSize cannot be negative.")
+	}
+	if dc.WriteBackHighWaterMark < 0 {
+		return errors.New("WriteBackHighWaterMark cannot be negative.")
+	}
+	if dc.WriteBackHighWaterMark > 0 && dc.WriteBackCacheSize == 0 {
+		return errors.New("WriteBackHighWaterMark needs WriteBackCacheSize to be set.")
+	}
+	if dc.WriteBackCacheSize > 0 && dc.WriteBackHighWaterMark >= dc.WriteBackCacheSize {
+		return errors.New("WriteBackHighWaterMark must be less than WriteBackCacheSize.")
+	}
+	if dc.TargetReadLatency < 0 {
+		return errors.New("TargetReadLatency cannot be negative.")
+	}
+	if dc.TargetWriteLatency < 0 {
+		return errors.New("TargetWriteLatency cannot be negative.")
+	}
+	if dc.MetadataCacheSize < 0 {
+		return errors.New("MetadataCacheSize cannot be negative.")
+	}
+	if dc.BlockSize < 0 {
+		return errors.New("BlockSize cannot be negative.")
+	}
+	if dc.StrictAlignment && dc.BlockSize == 0 {
+		return errors.New("StrictAlignment requires BlockSize.")
+	}
+	if dc.BlockGroupSize < 0 {
+		return errors.New("BlockGroupSize cannot be negative.")
+	}
+	if dc.BlockGroupSeekTime < 0 {
+		return errors.New("BlockGroupSeekTime cannot be negative.")
+	}
+	if dc.MetadataPerComponentTime < 0 {
+		return errors.New("MetadataPerComponentTime cannot be negative.")
+	}
+	if dc.TimeToFirstByte < 0 {
+		return errors.New("TimeToFirstByte cannot be negative.")
+	}
+	if dc.OpenDirTime < 0 {
+		return errors.New("OpenDirTime cannot be negative.")
+	}
+	if dc.ReaddirEntryTime < 0 {
+		return errors.New("ReaddirEntryTime cannot be negative.")
+	}
+	if dc.OpenTime < 0 {
+		return errors.New("OpenTime cannot be negative.")
+	}
+	if dc.RandomReadBytesPerSecond < 0 {
+		return errors.New("RandomReadBytesPerSecond cannot be negative.")
+	}
+	if dc.RandomWriteBytesPerSecond < 0 {
+		return errors.New("RandomWriteBytesPerSecond cannot be negative.")
+	}
+	if dc.ReadAheadBytes < 0 {
+		return errors.New("ReadAheadBytes cannot be negative.")
+	}
+	if dc.RPM < 0 {
+		return errors.New("RPM cannot be negative.")
+	}
+	if dc.QueueDepth < 0 {
+		return errors.New("QueueDepth cannot be negative.")
+	}
+	if dc.MaxIOPS < 0 {
+		return errors.New("MaxIOPS cannot be negative.")
+	}
+	if dc.MetadataIOPS < 0 {
+		return errors.New("MetadataIOPS cannot be negative.")
+	}
+	for op := range dc.LatencyHistograms {
+		if _, ok := dc.opTimes()[op]; !ok {
+			return fmt.Errorf("LatencyHistogramFile: unknown operation %q.", op)
+		}
+	}
+	for _, t := range dc.Triggers {
+		if err := t.validate(dc.opTimes()); err != nil {
+			return err
+		}
+	}
+	for _, pl := range dc.PathLatencies {
+		if err := pl.validate(dc.opTimes()); err != nil {
+			return err
+		}
+	}
+	if err := validatePathConfigs(dc.PathConfigs); err != nil {
+		return err
+	}
+	if err := validateMetadataOpTimes(dc.MetadataOpTimes); err != nil {
+		return err
+	}
+	if dc.TransientReadErrorRate < 0 || dc.TransientReadErrorRate > 1 {
+		return errors.New("TransientReadErrorRate must be between 0 and 1.")
+	}
+	if dc.CorruptionProbability < 0 || dc.CorruptionProbability > 1 {
+		return errors.New("CorruptionProbability must be between 0 and 1.")
+	}
+	if dc.CorruptionBytes < 0 {
+		return errors.New("CorruptionBytes cannot be negative.")
+	}
+	if dc.LatencyJitter < 0 || dc.LatencyJitter > 1 {
+		return errors.New("LatencyJitter must be between 0 and 1.")
+	}
+	if dc.NetworkLatency < 0 {
+		return errors.New("NetworkLatency cannot be negative.")
+	}
+	if dc.MaxOpDelay < 0 {
+		return errors.New("MaxOpDelay cannot be negative.")
+	}
+	if dc.MaxOpDelay > 0 && (dc.TargetReadLatency > dc.MaxOpDelay || dc.TargetWriteLatency > dc.MaxOpDelay) {
+		return errors.New("TargetReadLatency and TargetWriteLatency cannot be more than MaxOpDelay.")
+	}
+	if dc.SimulatedCapacity < 0 {
+		return errors.New("SimulatedCapacity cannot be negative.")
+	}
+	if dc.ReadErrorRate < 0 || dc.ReadErrorRate > 1 {
+		return errors.New("ReadErrorRate must be between 0 and 1.")
+	}
+	if dc.WriteErrorRate < 0 || dc.WriteErrorRate > 1 {
+		return errors.New("WriteErrorRate must be between 0 and 1.")
+	}
+	if dc.TransientErrorRecoveryTime < 0 {
+		return errors.New("TransientErrorRecoveryTime cannot be negative.")
+	}
+
+	if (dc.DirtyBackgroundBytes != 0 || dc.DirtyBytes != 0) && !dc.FsyncStrategy.UsesWriteBackCache() {
+		log.Println("DirtyBackgroundBytes and DirtyBytes only have an effect with the write back cache fsync strategy")
+	}
+
+	if dc.WriteBackCacheSize != 0 && !dc.FsyncStrategy.UsesWriteBackCache() {
+		log.Println("WriteBackCacheSize and WriteBackHighWaterMark only have an effect with the write back cache fsync strategy")
+	}
 
-	if dc.WriteStrategy == SimulateWrite && dc.FsyncStrategy == WriteBackCachedFsync {
+	if dc.LyingFsync && !dc.FsyncStrategy.UsesWriteBackCache() {
+		log.Println("LyingFsync only has an effect with the write back cache fsync strategy")
+	}
+
+	if dc.WriteStrategy == SimulateWrite && dc.FsyncStrategy.UsesWriteBackCache() {
 		log.Println("setting both simulated writes and write back cache is probably not what you want. " +
 			"Write back cache is meant to simulate writes being cached in memory and taking minimal time, " +
 			"then being written back to disk later, either during spare IO time or at an fsync.")
@@ -293,6 +1126,97 @@ func (dc *DeviceConfig) Validate() error {
 	return nil
 }
 
+// PathLatency returns the pinned latency of op, named as in SetOpTimes, on the file at path, from
+// the first of PathLatencies which matches both. It returns false if none do.
+func (dc *DeviceConfig) PathLatency(path, op string) (time.Duration, bool) {
+	for _, pl := range dc.PathLatencies {
+		if d, ok := pl.Latency[op]; ok && pl.Matches(path) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// opTimes maps operation names, as used by SetOpTimes, to the config fields holding their times.
+func (dc *DeviceConfig) opTimes() map[string]*time.Duration {
+	return map[string]*time.Duration{
+		"read":     &dc.ReadOpTime,
+		"write":    &dc.WriteOpTime,
+		"fsync":    &dc.FsyncOpTime,
+		"metadata": &dc.MetadataOpTime,
+	}
+}
+
+// SetOpTimes sets per-operation times from a comma separated list of name=duration pairs, for
+// example "read=2ms,write=5ms,fsync=50ms,metadata=1ms". Names of particular metadata operations,
+// like "rename", set their entries in MetadataOpTimes. Operations not listed are left alone.
+func (dc *DeviceConfig) SetOpTimes(spec string) error {
+	opTimes := dc.opTimes()
+	for _, entry := range strings.Split(spec, ",") {
+		nameAndTime := strings.SplitN(entry, "=", 2)
+		if len(nameAndTime) != 2 {
+			return fmt.Errorf("want name=duration, got %q", entry)
+		}
+		name := strings.ToLower(strings.TrimSpace(nameAndTime[0]))
+		opTime, ok := opTimes[name]
+		_, isMetadataOp := metadataOps[name]
+		if !ok && !isMetadataOp {
+			return fmt.Errorf("unknown operation %q, want one of %s", name, strings.Join(dc.knownOpNames(), ", "))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(nameAndTime[1]))
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if ok {
+			*opTime = d
+			continue
+		}
+		if dc.MetadataOpTimes == nil {
+			dc.MetadataOpTimes = make(map[string]time.Duration)
+		}
+		dc.MetadataOpTimes[name] = d
+	}
+	return nil
+}
+
+// traversalProfiles are named sets of metadata costs for ApplyTraversalProfile, from mildly to
+// painfully slow.
+var traversalProfiles = map[string]struct {
+	metadataOpTime           time.Duration
+	metadataPerComponentTime time.Duration
+	openDirTime              time.Duration
+	readdirEntryTime         time.Duration
+}{
+	"local": {1 * time.Millisecond, 100 * time.Microsecond, 5 * time.Millisecond, 1 * time.Microsecond},
+	"nas":   {5 * time.Millisecond, 1 * time.Millisecond, 50 * time.Millisecond, 20 * time.Microsecond},
+	"wan":   {30 * time.Millisecond, 5 * time.Millisecond, 200 * time.Millisecond, 100 * time.Microsecond},
+}
+
+// TraversalProfiles returns the names of the profiles ApplyTraversalProfile accepts, sorted.
+func TraversalProfiles() []string {
+	names := make([]string, 0, len(traversalProfiles))
+	for name := range traversalProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyTraversalProfile sets MetadataOpTime, MetadataPerComponentTime, OpenDirTime and
+// ReaddirEntryTime together from the named profile, making walking a directory tree (as find, du
+// and rsync do) as slow as on the kind of storage the profile is named after.
+func (dc *DeviceConfig) ApplyTraversalProfile(name string) error {
+	profile, ok := traversalProfiles[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown traversal profile %q, want one of %s", name, strings.Join(TraversalProfiles(), ", "))
+	}
+	dc.MetadataOpTime = profile.metadataOpTime
+	dc.MetadataPerComponentTime = profile.metadataPerComponentTime
+	dc.OpenDirTime = profile.openDirTime
+	dc.ReaddirEntryTime = profile.readdirEntryTime
+	return nil
+}
+
 // WriteTime computes how long writing numBytes will take.
 func (dc *DeviceConfig) WriteTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.WriteBytesPerSecond)
@@ -303,6 +1227,31 @@ func (dc *DeviceConfig) ReadTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.ReadBytesPerSecond)
 }
 
+// RandomReadTime computes how long reading numBytes after a seek will take.
+func (dc *DeviceConfig) RandomReadTime(numBytes units.NumBytes) time.Duration {
+	if dc.RandomReadBytesPerSecond == 0 {
+		return dc.ReadTime(numBytes)
+	}
+	return computeTimeFromThroughput(numBytes, dc.RandomReadBytesPerSecond)
+}
+
+// RandomWriteTime computes how long writing numBytes after a seek will take.
+func (dc *DeviceConfig) RandomWriteTime(numBytes units.NumBytes) time.Duration {
+	if dc.RandomWriteBytesPerSecond == 0 {
+		return dc.WriteTime(numBytes)
+	}
+	return computeTimeFromThroughput(numBytes, dc.RandomWriteBytesPerSecond)
+}
+
+// RotationalLatency returns the average time a read or write waits for the disk to turn to its
+// data, which is half a revolution, or 0 if RPM isn't set.
+func (dc *DeviceConfig) RotationalLatency() time.Duration {
+	if dc.RPM <= 0 {
+		return 0
+	}
+	return 30 * time.Second / time.Duration(dc.RPM)
+}
+
 // AllocateTime computes how long allocating numBytes will take.
 func (dc *DeviceConfig) AllocateTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.AllocateBytesPerSecond)
@@ -347,3 +1296,19 @@ var HDD7200RpmDeviceConfig = DeviceConfig{
 	WriteStrategy:          FastWrite,
 	MetadataOpTime:         10 * time.Millisecond,
 }
+
+// NetworkDeviceConfig is a basic model of storage reached over a gigabit network, like NFS, where
+// every operation pays a round trip.
+var NetworkDeviceConfig = DeviceConfig{
+	Name:                   "network",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     110 * units.Mebibyte,
+	WriteBytesPerSecond:    110 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 110 * units.Mebibyte,
+	RequestReorderMaxDelay: 100 * time.Microsecond,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         100 * time.Microsecond,
+	NetworkLatency:         time.Millisecond,
+}
@@ -101,6 +101,7 @@ func TestFsyncStrategy_String(t *testing.T) {
 		{NoFsync, "NoFsync"},
 		{DumbFsync, "DumbFsync"},
 		{WriteBackCachedFsync, "WriteBackCachedFsync"},
+		{GlobalWriteBackCachedFsync, "GlobalWriteBackCachedFsync"},
 		{12345, "unknown fsync strategy"},
 	}
 
@@ -124,6 +125,8 @@ func TestParseFsyncStrategyFromString(t *testing.T) {
 		{"dumb", DumbFsync, false},
 		{"WriTeBaCkCacHedFsync", WriteBackCachedFsync, false},
 		{"wbc", WriteBackCachedFsync, false},
+		{"GlobalWriteBackCachedFsync", GlobalWriteBackCachedFsync, false},
+		{"wbc-global", GlobalWriteBackCachedFsync, false},
 		{"asdfasdf", 0, true},
 	}
 
@@ -191,6 +194,144 @@ func TestParseWriteStrategyFromString(t *testing.T) {
 	}
 }
 
+func TestAtimeMode_String(t *testing.T) {
+	cases := []struct {
+		atimeMode AtimeMode
+		want      string
+	}{
+		{NoAtime, "NoAtime"},
+		{RelAtime, "RelAtime"},
+		{StrictAtime, "StrictAtime"},
+		{12345, "unknown atime mode"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.atimeMode.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.atimeMode, got, want)
+		}
+	}
+}
+
+func TestParseAtimeModeFromString(t *testing.T) {
+	cases := []struct {
+		strAtimeMode string
+		want         AtimeMode
+		shouldErr    bool
+	}{
+		{"nOaTime", NoAtime, false},
+		{"none", NoAtime, false},
+		{"RelAtime", RelAtime, false},
+		{"rel", RelAtime, false},
+		{"STRICTATIME", StrictAtime, false},
+		{"strict", StrictAtime, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseAtimeModeFromString(c.strAtimeMode)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseAtimeModeFromString(%s) = %s, want %s", c.strAtimeMode, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseAtimeModeFromString(%s) = _, %v, want _, %v", c.strAtimeMode, err, expectedErr)
+		}
+	}
+}
+
+func TestSchedulerPolicy_String(t *testing.T) {
+	cases := []struct {
+		policy SchedulerPolicy
+		want   string
+	}{
+		{SequentialSchedulerPolicy, "Sequential"},
+		{FIFOSchedulerPolicy, "FIFO"},
+		{SCANSchedulerPolicy, "SCAN"},
+		{12345, "unknown scheduler policy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.policy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.policy, got, want)
+		}
+	}
+}
+
+func TestParseSchedulerPolicyFromString(t *testing.T) {
+	cases := []struct {
+		strPolicy string
+		want      SchedulerPolicy
+		shouldErr bool
+	}{
+		{"Sequential", SequentialSchedulerPolicy, false},
+		{"fifo", FIFOSchedulerPolicy, false},
+		{"SCAN", SCANSchedulerPolicy, false},
+		{"elevator", SCANSchedulerPolicy, false},
+		{"look", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseSchedulerPolicyFromString(c.strPolicy)
+		if got != c.want {
+			t.Errorf("ParseSchedulerPolicyFromString(%s) = %s, want %s", c.strPolicy, got, c.want)
+		}
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseSchedulerPolicyFromString(%s) = _, %v, want error: %v", c.strPolicy, err, c.shouldErr)
+		}
+	}
+}
+
+func TestWriteBackOrder_String(t *testing.T) {
+	cases := []struct {
+		order WriteBackOrder
+		want  string
+	}{
+		{RandomWriteBack, "Random"},
+		{OldestFirstWriteBack, "OldestFirst"},
+		{LargestFirstWriteBack, "LargestFirst"},
+		{RoundRobinWriteBack, "RoundRobin"},
+		{12345, "unknown write back order"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.order.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.order, got, want)
+		}
+	}
+}
+
+func TestParseWriteBackOrderFromString(t *testing.T) {
+	cases := []struct {
+		strOrder  string
+		want      WriteBackOrder
+		shouldErr bool
+	}{
+		{"RANDOM", RandomWriteBack, false},
+		{"OldestFirst", OldestFirstWriteBack, false},
+		{"oldest", OldestFirstWriteBack, false},
+		{"largestfirst", LargestFirstWriteBack, false},
+		{"largest", LargestFirstWriteBack, false},
+		{"RoundRobin", RoundRobinWriteBack, false},
+		{"rr", RoundRobinWriteBack, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseWriteBackOrderFromString(c.strOrder)
+		if got != c.want {
+			t.Errorf("ParseWriteBackOrderFromString(%s) = %s, want %s", c.strOrder, got, c.want)
+		}
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseWriteBackOrderFromString(%s) = _, %v, want error: %v", c.strOrder, err, c.shouldErr)
+		}
+	}
+}
+
 func TestParseDeviceConfigsFromJSON(t *testing.T) {
 	cases := []struct {
 		jsonDeviceConfig string
@@ -314,6 +455,147 @@ func TestParseDeviceConfigsFromJSON(t *testing.T) {
 			},
 			false,
 		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "MinFsyncInterval": "20ms"
+			}]`,
+			[]*DeviceConfig{{
+				Name:                   "7200",
+				SeekWindow:             4 * units.Kibibyte,
+				SeekTime:               10 * time.Millisecond,
+				ReadBytesPerSecond:     100 * units.Mebibyte,
+				WriteBytesPerSecond:    123 * units.Kibibyte,
+				AllocateBytesPerSecond: 100 * units.Byte,
+				RequestReorderMaxDelay: 100 * time.Microsecond,
+				FsyncStrategy:          WriteBackCachedFsync,
+				WriteStrategy:          FastWrite,
+				MetadataOpTime:         123 * time.Second,
+				MinFsyncInterval:       20 * time.Millisecond,
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "Triggers": [{"Op": "write", "AfterOps": "10000", "ExtraDelay": {"fsync": "200ms"}}]
+			}]`,
+			[]*DeviceConfig{{
+				Name:                   "7200",
+				SeekWindow:             4 * units.Kibibyte,
+				SeekTime:               10 * time.Millisecond,
+				ReadBytesPerSecond:     100 * units.Mebibyte,
+				WriteBytesPerSecond:    123 * units.Kibibyte,
+				AllocateBytesPerSecond: 100 * units.Byte,
+				RequestReorderMaxDelay: 100 * time.Microsecond,
+				FsyncStrategy:          WriteBackCachedFsync,
+				WriteStrategy:          FastWrite,
+				MetadataOpTime:         123 * time.Second,
+				Triggers: []Trigger{{
+					Op:         "write",
+					AfterOps:   10000,
+					ExtraDelay: map[string]time.Duration{"fsync": 200 * time.Millisecond},
+				}},
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "Triggers": [{"Op": "write", "AfterOps": 10000, "ExtraDelay": {"fsync": "200ms"}}]
+			}]`,
+			nil,
+			true,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "Version": "1"
+			}]`,
+			[]*DeviceConfig{{
+				Name:                   "7200",
+				SeekWindow:             4 * units.Kibibyte,
+				SeekTime:               10 * time.Millisecond,
+				ReadBytesPerSecond:     100 * units.Mebibyte,
+				WriteBytesPerSecond:    123 * units.Kibibyte,
+				AllocateBytesPerSecond: 100 * units.Byte,
+				RequestReorderMaxDelay: 100 * time.Microsecond,
+				FsyncStrategy:          WriteBackCachedFsync,
+				WriteStrategy:          FastWrite,
+				MetadataOpTime:         123 * time.Second,
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "Version": "2"
+			}]`,
+			nil,
+			true,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s",
+			  "Version": "0"
+			}]`,
+			nil,
+			true,
+		},
 	}
 
 	for _, c := range cases {
@@ -404,6 +686,184 @@ func TestDeviceConfig_Validate(t *testing.T) {
 			},
 			true,
 		},
+		{
+			&DeviceConfig{
+				MinFsyncInterval:       -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				MaxOpDelay:             -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				SimulatedCapacity:      -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				MaxOpDelay:             time.Second,
+				TargetReadLatency:      2 * time.Second,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				MaxOpDelay:             time.Second,
+				TargetWriteLatency:     time.Second,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				StrictAlignment:        true,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				BlockSize:              4 * units.Kibibyte,
+				StrictAlignment:        true,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				BlockGroupSize:         -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				LatencyHistograms:      map[string]*LatencyHistogram{"open": {}},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Triggers: []Trigger{{
+					Op:         "write",
+					ExtraDelay: map[string]time.Duration{"fsync": time.Millisecond},
+				}},
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Triggers: []Trigger{{
+					Op:         "rename",
+					ExtraDelay: map[string]time.Duration{"fsync": time.Millisecond},
+				}},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Triggers: []Trigger{{
+					Op:         "write",
+					ExtraDelay: map[string]time.Duration{"fsync": -1},
+				}},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				RPM:                    -1,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				PathConfigs:            map[string]string{"/": "ssd"},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				WriteBackCacheSize:     100 * units.Byte,
+				WriteBackHighWaterMark: 50 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				WriteBackCacheSize:     100 * units.Byte,
+				WriteBackHighWaterMark: 100 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				WriteBackCacheSize:     0,
+				WriteBackHighWaterMark: 50 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				WriteBackCacheSize:     -1,
+				WriteBackHighWaterMark: 0,
+			},
+			true,
+		},
 	}
 
 	for _, c := range cases {
@@ -419,8 +879,85 @@ func TestDeviceConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestDeviceConfig_RotationalLatency(t *testing.T) {
+	cases := []struct {
+		rpm  int
+		want time.Duration
+	}{
+		{0, 0},
+		{7200, 4166666 * time.Nanosecond},
+		{15000, 2 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := &DeviceConfig{RPM: c.rpm}
+		if got := dc.RotationalLatency(); got != c.want {
+			t.Errorf("RotationalLatency() with RPM %d = %s, want %s", c.rpm, got, c.want)
+		}
+	}
+}
+
+func TestDeviceConfig_SetOpTimes(t *testing.T) {
+	cases := []struct {
+		spec      string
+		want      DeviceConfig
+		shouldErr bool
+	}{
+		{
+			"read=2ms,write=5ms,fsync=50ms,metadata=1ms",
+			DeviceConfig{
+				ReadOpTime:     2 * time.Millisecond,
+				WriteOpTime:    5 * time.Millisecond,
+				FsyncOpTime:    50 * time.Millisecond,
+				MetadataOpTime: 1 * time.Millisecond,
+			},
+			false,
+		},
+		{
+			" Read = 3us , fsync=1s",
+			DeviceConfig{
+				ReadOpTime:     3 * time.Microsecond,
+				FsyncOpTime:    1 * time.Second,
+				MetadataOpTime: 10 * time.Millisecond,
+			},
+			false,
+		},
+		{
+			"rename=20ms,metadata=2ms,GetAttr=0s",
+			DeviceConfig{
+				MetadataOpTime: 2 * time.Millisecond,
+				MetadataOpTimes: map[string]time.Duration{
+					"rename":  20 * time.Millisecond,
+					"getattr": 0,
+				},
+			},
+			false,
+		},
+		{"seek=1ms", DeviceConfig{}, true},
+		{"read=fast", DeviceConfig{}, true},
+		{"read", DeviceConfig{}, true},
+		{"read=1ms,", DeviceConfig{}, true},
+	}
+
+	for _, c := range cases {
+		got := DeviceConfig{MetadataOpTime: 10 * time.Millisecond}
+		err := got.SetOpTimes(c.spec)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("SetOpTimes(%q) = nil, want an error", c.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetOpTimes(%q) = %s, want nil", c.spec, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SetOpTimes(%q) gave %s, want %s", c.spec, &got, &c.want)
+		}
+	}
+}
+
 func TestDeviceConfigLiteralsValid(t *testing.T) {
-	cases := []DeviceConfig{HDD7200RpmDeviceConfig}
+	cases := []DeviceConfig{HDD7200RpmDeviceConfig, NetworkDeviceConfig}
 
 	for _, c := range cases {
 		if c.Validate() != nil {
@@ -428,3 +965,201 @@ func TestDeviceConfigLiteralsValid(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTriggerFromString(t *testing.T) {
+	cases := []struct {
+		spec      string
+		want      Trigger
+		shouldErr bool
+	}{
+		{
+			"op=write,after=10000,fsync=200ms",
+			Trigger{
+				Op:         "write",
+				AfterOps:   10000,
+				ExtraDelay: map[string]time.Duration{"fsync": 200 * time.Millisecond},
+			},
+			false,
+		},
+		{
+			" OP = Fsync , after=3, read=1ms, write=2ms",
+			Trigger{
+				Op:       "fsync",
+				AfterOps: 3,
+				ExtraDelay: map[string]time.Duration{
+					"read":  1 * time.Millisecond,
+					"write": 2 * time.Millisecond,
+				},
+			},
+			false,
+		},
+		{"after=10,fsync=1ms", Trigger{}, true},
+		{"op=write,after=-1,fsync=1ms", Trigger{}, true},
+		{"op=write,fsync=soon", Trigger{}, true},
+		{"op=write,fsync", Trigger{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseTriggerFromString(c.spec)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("ParseTriggerFromString(%q) = %v, should error", c.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTriggerFromString(%q) error: %s", c.spec, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseTriggerFromString(%q) = %v, want %v", c.spec, got, c.want)
+		}
+	}
+}
+
+func TestApplyTraversalProfile(t *testing.T) {
+	dc := HDD7200RpmDeviceConfig
+	if err := dc.ApplyTraversalProfile("NAS"); err != nil {
+		t.Fatalf("ApplyTraversalProfile(NAS) = %s, want nil", err)
+	}
+	if got, want := dc.MetadataOpTime, 5*time.Millisecond; got != want {
+		t.Errorf("MetadataOpTime = %s, want %s", got, want)
+	}
+	if got, want := dc.MetadataPerComponentTime, 1*time.Millisecond; got != want {
+		t.Errorf("MetadataPerComponentTime = %s, want %s", got, want)
+	}
+	if got, want := dc.OpenDirTime, 50*time.Millisecond; got != want {
+		t.Errorf("OpenDirTime = %s, want %s", got, want)
+	}
+	if got, want := dc.ReaddirEntryTime, 20*time.Microsecond; got != want {
+		t.Errorf("ReaddirEntryTime = %s, want %s", got, want)
+	}
+	if got, want := dc.SeekTime, HDD7200RpmDeviceConfig.SeekTime; got != want {
+		t.Errorf("SeekTime = %s, want %s unchanged", got, want)
+	}
+
+	if err := dc.ApplyTraversalProfile("nfs"); err == nil {
+		t.Errorf("ApplyTraversalProfile(nfs) = nil, want an error")
+	}
+}
+
+func TestParseDeviceConfigsFromYAML(t *testing.T) {
+	cases := []struct {
+		yamlDeviceConfig string
+		jsonDeviceConfig string
+	}{
+		{
+			`
+- Name: hdd
+  SeekWindow: 4KiB
+  SeekTime: 10ms
+  ReadBytesPerSecond: 100MiB
+  WriteBytesPerSecond: 123KiB
+  AllocateBytesPerSecond: 100B
+  RequestReorderMaxDelay: 100us
+  FsyncStrategy: wbc
+  WriteStrategy: fastwrite
+  MetadataOpTime: 123s
+`,
+			`[{
+			  "Name": "hdd",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s"
+			}]`,
+		},
+		{
+			`# Two configs, one with nested fields.
+---
+- Name: "ssd"
+  SeekWindow: '0B'
+  SeekTime: 0s
+  ReadBytesPerSecond: 500MiB   # sequential
+  WriteBytesPerSecond: 400MiB
+  AllocateBytesPerSecond: 4GiB
+  RequestReorderMaxDelay: 0s
+  FsyncStrategy: dumb
+  WriteStrategy: simulate
+  MetadataOpTime: 50us
+  Version: "1"
+  Triggers:
+  - Op: write
+    AfterOps: "10000"
+    ExtraDelay: {fsync: 200ms}
+  PathLatencies:
+    - {Pattern: "*.log", Latency: {read: 5ms, write: 10ms}}
+  PathConfigs:
+    /slow: hdd
+- Name: hdd
+  SeekWindow: 4KiB
+  SeekTime: 10ms
+  ReadBytesPerSecond: 100MiB
+  WriteBytesPerSecond: 100MiB
+  AllocateBytesPerSecond: 100MiB
+  RequestReorderMaxDelay: 100us
+  FsyncStrategy: wbc
+  WriteStrategy: fastwrite
+  MetadataOpTime: 10ms
+`,
+			`[{
+			  "Name": "ssd",
+			  "SeekWindow": "0B",
+			  "SeekTime": "0s",
+			  "ReadBytesPerSecond": "500MiB",
+			  "WriteBytesPerSecond": "400MiB",
+			  "AllocateBytesPerSecond": "4GiB",
+			  "RequestReorderMaxDelay": "0s",
+			  "FsyncStrategy": "dumb",
+			  "WriteStrategy": "simulate",
+			  "MetadataOpTime": "50us",
+			  "Version": "1",
+			  "Triggers": [{"Op": "write", "AfterOps": "10000", "ExtraDelay": {"fsync": "200ms"}}],
+			  "PathLatencies": [{"Pattern": "*.log", "Latency": {"read": "5ms", "write": "10ms"}}],
+			  "PathConfigs": {"/slow": "hdd"}
+			}, {
+			  "Name": "hdd",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "100MiB",
+			  "AllocateBytesPerSecond": "100MiB",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "10ms"
+			}]`,
+		},
+	}
+
+	for _, c := range cases {
+		want, err := ParseDeviceConfigsFromJSON([]byte(c.jsonDeviceConfig))
+		if err != nil {
+			t.Fatalf("ParseDeviceConfigsFromJSON(%s) error: %s", c.jsonDeviceConfig, err)
+		}
+		got, err := ParseDeviceConfigsFromYAML([]byte(c.yamlDeviceConfig))
+		if err != nil {
+			t.Errorf("ParseDeviceConfigsFromYAML(%s) error: %s", c.yamlDeviceConfig, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseDeviceConfigsFromYAML(%s) = %s, want %s", c.yamlDeviceConfig, got, want)
+		}
+	}
+
+	errCases := []string{
+		"",
+		"Name: hdd",
+		"- hdd",
+		"- Name: hdd\n  Unrecognised: test",
+		"- Name: hdd\n  SeekTime: 10ms\n  SeekTime: 20ms",
+		"- Name: hdd\n  SeekTime: [10ms",
+		"- Name: hdd\n\tSeekTime: 10ms",
+	}
+	for _, c := range errCases {
+		if got, err := ParseDeviceConfigsFromYAML([]byte(c)); err == nil {
+			t.Errorf("ParseDeviceConfigsFromYAML(%q) = %s, should error", c, got)
+		}
+	}
+}
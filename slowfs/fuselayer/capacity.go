@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"slowfs/slowfs/units"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// defaultStatFsBlockSize is the block size simulated capacity is reported in if the backing
+// filesystem doesn't give one.
+const defaultStatFsBlockSize = 4096
+
+// countUsedBytes reports the size of every file already in the backing directory to the
+// scheduler, so that simulated capacity starts out as full as the backing directory is. Files with
+// several hard links are counted once.
+func (sfs *SlowFs) countUsedBytes() {
+	seen := make(map[uint64]bool)
+	err := filepath.WalkDir(sfs.rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			if seen[stat.Ino] {
+				return nil
+			}
+			seen[stat.Ino] = true
+		}
+		name, err := filepath.Rel(sfs.rootPath, path)
+		if err != nil {
+			return err
+		}
+		sfs.scheduler.AddUsedBytes(name, units.NumBytes(info.Size()))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: failed to count the bytes used in %s: %v", sfs.rootPath, err)
+	}
+}
+
+// fileSize returns the size of the file at name in the backing filesystem, or 0 if it doesn't
+// exist.
+func (sfs *SlowFs) fileSize(name string) int64 {
+	attr, status := sfs.FileSystem.GetAttr(name, nil)
+	if status != fuse.OK {
+		return 0
+	}
+	return int64(attr.Size)
+}
+
+// simulateCapacity makes out report a filesystem of capacity bytes with used bytes taken, in
+// out's block size.
+func simulateCapacity(out *fuse.StatfsOut, capacity, used units.NumBytes) {
+	if out.Bsize == 0 {
+		out.Bsize = defaultStatFsBlockSize
+	}
+	blockSize := units.NumBytes(out.Bsize)
+	out.Blocks = uint64(capacity / blockSize)
+	out.Bfree = uint64(max(capacity-used, 0) / blockSize)
+	out.Bavail = out.Bfree
+}
+
+// lacksSpace returns whether the device serving name has a SimulatedCapacity without room for n
+// more bytes. Creating files and directories needs room for at least one.
+func (sfs *SlowFs) lacksSpace(name string, n units.NumBytes) bool {
+	if !sfs.tracksUsage || n <= 0 {
+		return false
+	}
+	return !sfs.scheduler.HasRoom(name, n)
+}
+
+// reserveSpace takes n bytes of the SimulatedCapacity of the device serving name, returning false
+// if there isn't room for them. Bytes that end up unused should be given back with AddUsedBytes.
+func (sfs *SlowFs) reserveSpace(name string, n units.NumBytes) bool {
+	if !sfs.tracksUsage || n <= 0 {
+		return true
+	}
+	return sfs.scheduler.ReserveBytes(name, n)
+}
+
+// unlinkedBytes returns how many bytes removing the file at name frees: its size if it is a
+// regular file with no other links, or 0 otherwise.
+func (sfs *SlowFs) unlinkedBytes(name string) units.NumBytes {
+	if !sfs.tracksUsage {
+		return 0
+	}
+	attr, status := sfs.FileSystem.GetAttr(name, nil)
+	if status != fuse.OK || !attr.IsRegular() || attr.Nlink > 1 {
+		return 0
+	}
+	return units.NumBytes(attr.Size)
+}
+
+// truncatedBytes returns how many bytes opening the file at name with flags frees, which is its
+// size if flags has O_TRUNC.
+func (sfs *SlowFs) truncatedBytes(name string, flags uint32) units.NumBytes {
+	if !sfs.tracksUsage || flags&syscall.O_TRUNC == 0 {
+		return 0
+	}
+	return units.NumBytes(sfs.fileSize(name))
+}
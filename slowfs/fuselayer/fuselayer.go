@@ -19,8 +19,12 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"slowfs/slowfs/scheduler"
 	"slowfs/slowfs/units"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -34,11 +38,33 @@ type slowFile struct {
 
 	path string
 	sfs  *SlowFs
+
+	// Whether the file was opened with O_APPEND.
+	append bool
+
+	// Whether the file was opened with O_DIRECT.
+	direct bool
+
+	// Identifies this handle to the scheduler.
+	handle uint64
+
+	// The backing file's inode, or 0 if unknown, so the scheduler treats hard links as one file.
+	inode uint64
 }
 
 // Read performs a read, and then waits until the scheduled time.
 func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	if !sf.sfs.aligned(off, len(dest)) {
+		if sf.sfs.verboseLog {
+			log.Printf("ERROR: Read not aligned to %s for file=%s offset=%d size=%d",
+				sf.sfs.alignment, sf.path, off, len(dest))
+		}
+		return nil, fuse.EINVAL
+	}
 	r, status := sf.File.Read(dest, off)
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
@@ -57,17 +83,40 @@ func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 	if status != fuse.OK {
 		return nil, status
 	}
+	if sf.sfs.stale.enabled() {
+		buf = buf[:sf.sfs.stale.overlay(sf.path, start, buf, off)]
+	}
 	r = fuse.ReadResultData(buf)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	req := &scheduler.Request{
 		Type:      scheduler.ReadRequest,
 		Timestamp: start,
 		Path:      sf.path,
+		Inode:     sf.inode,
 		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(r.Size()),
-	})
+		Handle:    sf.handle,
+	}
+	opTime, err := sf.sfs.scheduler.ScheduleWithError(req)
+
+	sf.sfs.sleepUntil(start, opTime)
+
+	if err != nil {
+		if sf.sfs.verboseLog {
+			log.Printf("ERROR: Read failed for file=%s offset=%d size=%d error=%s (simulated)",
+				sf.path, off, len(dest), err)
+		}
+		return nil, fuse.ToStatus(err)
+	}
 
-	time.Sleep(opTime - time.Since(start))
+	// Corrupt our copy of the data, leaving the backing file intact.
+	for _, i := range req.CorruptOffsets {
+		buf[i] ^= 0xff
+	}
+	if len(req.CorruptOffsets) > 0 && sf.sfs.verboseLog {
+		log.Printf("CORRUPT: Read of file=%s returned %d bytes flipped from offset %d (simulated)",
+			sf.path, len(req.CorruptOffsets), off+req.CorruptOffsets[0])
+	}
 
 	return r, status
 }
@@ -75,27 +124,86 @@ func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 // Write performs a write, and then waits until the scheduled time.
 func (sf *slowFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return 0, fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return 0, fuse.EROFS
+	}
+	if !sf.sfs.aligned(off, len(data)) {
+		if sf.sfs.verboseLog {
+			log.Printf("ERROR: Write not aligned to %s for file=%s offset=%d size=%d",
+				sf.sfs.alignment, sf.path, off, len(data))
+		}
+		return 0, fuse.EINVAL
+	}
+	var oldData []byte
+	var oldSize int64
+	if sf.sfs.stale.enabled() {
+		off, oldData, oldSize = sf.sfs.readOldData(sf.path, off, len(data), sf.append)
+	} else if sf.sfs.tracksUsage {
+		oldSize = sf.sfs.fileSize(sf.path)
+	}
+	var reserved units.NumBytes
+	if sf.sfs.tracksUsage {
+		end := off + int64(len(data))
+		if sf.append {
+			end = oldSize + int64(len(data))
+		}
+		reserved = units.NumBytes(max(end-oldSize, 0))
+		if !sf.sfs.reserveSpace(sf.path, reserved) {
+			return 0, fuse.Status(syscall.ENOSPC)
+		}
+	}
 	// Unlike Read, Write will immediately execute the syscall.
 	r, status := sf.File.Write(data, off)
 
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
+		if reserved > 0 {
+			sf.sfs.scheduler.AddUsedBytes(sf.path, -reserved)
+		}
 		if sf.sfs.verboseLog {
 			log.Printf("ERROR: Write failed for file=%s offset=%d size=%d status=%s", 
 				sf.path, off, len(data), status)
 		}
 		return r, status
 	}
+	if sf.sfs.stale.enabled() {
+		sf.sfs.stale.recordWrite(sf.path, start, off, oldData, oldSize)
+	}
+	if sf.sfs.tracksUsage {
+		// Give back what a short write didn't use.
+		end := off + int64(r)
+		if sf.append {
+			end = oldSize + int64(r)
+		}
+		if written := units.NumBytes(max(end-oldSize, 0)); written != reserved {
+			sf.sfs.scheduler.AddUsedBytes(sf.path, written-reserved)
+		}
+	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime, err := sf.sfs.scheduler.ScheduleWithError(&scheduler.Request{
 		Type:      scheduler.WriteRequest,
 		Timestamp: start,
 		Path:      sf.path,
+		Inode:     sf.inode,
 		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(r),
+		Append:    sf.append,
+		Direct:    sf.direct,
+		Handle:    sf.handle,
 	})
 
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
+
+	if err != nil {
+		if sf.sfs.verboseLog {
+			log.Printf("ERROR: Write failed for file=%s offset=%d size=%d error=%s (simulated)",
+				sf.path, off, len(data), err)
+		}
+		return 0, fuse.ToStatus(err)
+	}
 
 	return r, status
 }
@@ -104,17 +212,23 @@ func (sf *slowFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 func (sf *slowFile) Release() {
 	start := time.Now()
 	sf.File.Release()
+	sf.sfs.unregisterFile(sf)
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.CloseRequest,
 		Timestamp: start,
 		Path:      sf.path,
+		Inode:     sf.inode,
+		Handle:    sf.handle,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 }
 
 func (sf *slowFile) Fsync(flags int) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
 	r := sf.File.Fsync(flags)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
@@ -125,36 +239,65 @@ func (sf *slowFile) Fsync(flags int) fuse.Status {
 		Type:      scheduler.FsyncRequest,
 		Timestamp: start,
 		Path:      sf.path,
+		Inode:     sf.inode,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) Truncate(size uint64) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return fuse.EROFS
+	}
+	var oldSize int64
+	if sf.sfs.tracksUsage {
+		oldSize = sf.sfs.fileSize(sf.path)
+		if !sf.sfs.reserveSpace(sf.path, units.NumBytes(int64(size)-oldSize)) {
+			return fuse.Status(syscall.ENOSPC)
+		}
+	}
 	r := sf.File.Truncate(size)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
+		if sf.sfs.tracksUsage && int64(size) > oldSize {
+			sf.sfs.scheduler.AddUsedBytes(sf.path, -units.NumBytes(int64(size)-oldSize))
+		}
 		return r
 	}
+	sf.sfs.stale.forget(sf.path)
+	if sf.sfs.tracksUsage && int64(size) < oldSize {
+		sf.sfs.scheduler.AddUsedBytes(sf.path, units.NumBytes(int64(size)-oldSize))
+	}
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "truncate",
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) GetAttr(out *fuse.Attr) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
 	r := sf.File.GetAttr(out)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
+	if sf.sfs.stale.enabled() {
+		out.Size = uint64(sf.sfs.stale.visibleSize(sf.path, start, int64(out.Size)))
+	}
 
 	// Only override if this is the root directory (path is empty or root)
 	if (sf.path == "" || sf.path == "/") && sf.sfs.uid != 0 && sf.sfs.gid != 0 {
@@ -164,16 +307,24 @@ func (sf *slowFile) GetAttr(out *fuse.Attr) fuse.Status {
 	}
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+		Type:      scheduler.StatRequest,
+		Op:        "getattr",
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) Chown(uid uint32, gid uint32) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return fuse.EROFS
+	}
 	r := sf.File.Chown(uid, gid)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
@@ -182,15 +333,23 @@ func (sf *slowFile) Chown(uid uint32, gid uint32) fuse.Status {
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "chown",
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) Chmod(perms uint32) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return fuse.EROFS
+	}
 	r := sf.File.Chmod(perms)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
@@ -199,15 +358,23 @@ func (sf *slowFile) Chmod(perms uint32) fuse.Status {
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "chmod",
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return fuse.EROFS
+	}
 	r := sf.File.Utimens(atime, mtime)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
@@ -216,70 +383,382 @@ func (sf *slowFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "utimens",
 		Timestamp: start,
+		Path:      sf.path,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
 func (sf *slowFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 	start := time.Now()
+	if sf.sfs.Detached() {
+		return fuse.EIO
+	}
+	if sf.sfs.readOnly {
+		return fuse.EROFS
+	}
+	var oldSize int64
+	var reserved units.NumBytes
+	if sf.sfs.tracksUsage {
+		oldSize = sf.sfs.fileSize(sf.path)
+		reserved = units.NumBytes(max(int64(off+size)-oldSize, 0))
+		if !sf.sfs.reserveSpace(sf.path, reserved) {
+			return fuse.Status(syscall.ENOSPC)
+		}
+	}
 	r := sf.File.Allocate(off, size, mode)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
+		if reserved > 0 {
+			sf.sfs.scheduler.AddUsedBytes(sf.path, -reserved)
+		}
 		return r
 	}
+	if sf.sfs.tracksUsage {
+		// With FALLOC_FL_KEEP_SIZE the file doesn't grow, so not all of the reservation is used.
+		if grown := units.NumBytes(max(sf.sfs.fileSize(sf.path)-oldSize, 0)); grown != reserved {
+			sf.sfs.scheduler.AddUsedBytes(sf.path, grown-reserved)
+		}
+	}
 
 	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.AllocateRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Inode:     sf.inode,
+		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(size),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.sleepUntil(start, opTime)
 
 	return r
 }
 
+// ConfigXAttr is a virtual extended attribute on the root of the filesystem, whose value
+// describes the device config in use. It can't be set or removed.
+const ConfigXAttr = "user.slowfs.config"
+
 // SlowFs is a FileSystem whose operations take amounts of time determined by an associated
 // Scheduler.
 type SlowFs struct {
 	pathfs.FileSystem
 
-	scheduler  *scheduler.Scheduler
-	uid        uint32
-	gid        uint32
-	rootPath   string
-	verboseLog bool
+	scheduler    *scheduler.Scheduler
+	uid          uint32
+	gid          uint32
+	rootPath     string
+	verboseLog   bool
+	debugContext bool
+	alignment    units.NumBytes
+	statFsScale  float64
+	readOnly     bool
+	maxOpenFiles int
+
+	// Whether the scheduler simulates the capacity of a device, so needs to be told how many
+	// bytes are stored on it.
+	tracksUsage bool
+
+	// The data files had before writes which are not visible yet.
+	stale *staleData
+
+	// Total time spent sleeping to make operations take as long as they were scheduled to, in
+	// nanoseconds.
+	injectedDelay int64
+
+	// Tracks operations which took longer than scheduled, warning when the host can't keep up.
+	underruns underrunDetector
+
+	// Set while the device is detached, during which every operation fails with EIO.
+	detached int32
+
+	// The last handle number given to a slowFile.
+	lastHandle uint64
+
+	// Files opened through the filesystem which have not been released yet.
+	openFilesMu sync.Mutex
+	openFiles   map[*slowFile]struct{}
+
+	// How many files are open or being opened, counted against maxOpenFiles. Guarded by
+	// openFilesMu.
+	reservedFiles int
+}
+
+// Detach simulates the device being unplugged. Until Reattach is called every operation fails
+// straight away with EIO, without touching the backing directory.
+func (sfs *SlowFs) Detach() {
+	atomic.StoreInt32(&sfs.detached, 1)
+}
+
+// Reattach restores normal operation after Detach.
+func (sfs *SlowFs) Reattach() {
+	atomic.StoreInt32(&sfs.detached, 0)
+}
+
+// Detached returns whether the device is currently detached.
+func (sfs *SlowFs) Detached() bool {
+	return atomic.LoadInt32(&sfs.detached) != 0
+}
+
+// OpenFile describes a file handle which is currently open.
+type OpenFile struct {
+	Path string
+	// How much data written through the handle's file has not been written back yet.
+	DirtyBytes units.NumBytes
+}
+
+// OpenFiles lists the file handles which are currently open, sorted by path. A file opened more
+// than once is listed once per handle.
+func (sfs *SlowFs) OpenFiles() []OpenFile {
+	sfs.openFilesMu.Lock()
+	files := make([]*slowFile, 0, len(sfs.openFiles))
+	for sf := range sfs.openFiles {
+		files = append(files, sf)
+	}
+	sfs.openFilesMu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	openFiles := make([]OpenFile, 0, len(files))
+	for _, sf := range files {
+		openFiles = append(openFiles, OpenFile{
+			Path:       sf.path,
+			DirtyBytes: sfs.scheduler.DirtyBytes(sf.path, sf.inode),
+		})
+	}
+	return openFiles
+}
+
+// newSlowFile wraps file, which was opened at name with the given flags, and records it as open
+// until it is released.
+func (sfs *SlowFs) newSlowFile(file nodefs.File, name string, flags uint32) *slowFile {
+	sf := &slowFile{
+		File:   file,
+		sfs:    sfs,
+		path:   name,
+		append: flags&syscall.O_APPEND != 0,
+		direct: flags&syscall.O_DIRECT != 0,
+		handle: atomic.AddUint64(&sfs.lastHandle, 1),
+	}
+	var attr fuse.Attr
+	if file.GetAttr(&attr) == fuse.OK {
+		sf.inode = attr.Ino
+	}
+	sfs.openFilesMu.Lock()
+	sfs.openFiles[sf] = struct{}{}
+	sfs.openFilesMu.Unlock()
+	return sf
+}
+
+func (sfs *SlowFs) unregisterFile(sf *slowFile) {
+	sfs.openFilesMu.Lock()
+	delete(sfs.openFiles, sf)
+	sfs.openFilesMu.Unlock()
+	sfs.releaseFileSlot()
+}
+
+// reserveFileSlot reserves a slot for a file about to be opened, returning false if MaxOpenFiles
+// files are already open. Each successful call must be matched by releaseFileSlot, which
+// releasing the file does.
+func (sfs *SlowFs) reserveFileSlot() bool {
+	sfs.openFilesMu.Lock()
+	defer sfs.openFilesMu.Unlock()
+	if sfs.maxOpenFiles > 0 && sfs.reservedFiles >= sfs.maxOpenFiles {
+		return false
+	}
+	sfs.reservedFiles++
+	return true
+}
+
+func (sfs *SlowFs) releaseFileSlot() {
+	sfs.openFilesMu.Lock()
+	sfs.reservedFiles--
+	sfs.openFilesMu.Unlock()
+}
+
+// tooManyOpenFiles fails an open of name with EMFILE, after the time the open would have taken.
+func (sfs *SlowFs) tooManyOpenFiles(start time.Time, name string) (nodefs.File, fuse.Status) {
+	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+		Type:      scheduler.OpenRequest,
+		Op:        "open",
+		Timestamp: start,
+		Path:      name,
+	})
+	sfs.sleepUntil(start, opTime)
+	return nil, fuse.Status(syscall.EMFILE)
+}
+
+// readOldData reads the size bytes of name at off which a write is about to replace, along with
+// the file's size, so they can be served until the write is visible. For an append, off is
+// replaced by the end of the file. Data which can't be read is treated as missing.
+func (sfs *SlowFs) readOldData(name string, off int64, size int, appending bool) (int64, []byte, int64) {
+	attr, status := sfs.FileSystem.GetAttr(name, nil)
+	if status != fuse.OK {
+		return off, nil, 0
+	}
+	oldSize := int64(attr.Size)
+	if appending {
+		off = oldSize
+	}
+	if off >= oldSize {
+		return off, nil, oldSize
+	}
+	file, status := sfs.FileSystem.Open(name, syscall.O_RDONLY, nil)
+	if status != fuse.OK {
+		return off, nil, oldSize
+	}
+	defer file.Release()
+	buf := make([]byte, min(int64(size), oldSize-off))
+	r, status := file.Read(buf, off)
+	if status != fuse.OK {
+		return off, nil, oldSize
+	}
+	oldData, _ := r.Bytes(buf)
+	return off, append([]byte(nil), oldData...), oldSize
 }
 
 // NewSlowFs creates a new SlowFs using the specified scheduler at the given directory. The
 // directory must be empty.
 func NewSlowFs(directory string, scheduler *scheduler.Scheduler) *SlowFs {
-	return &SlowFs{
-		FileSystem: pathfs.NewLoopbackFileSystem(directory),
-		scheduler:  scheduler,
-		uid:        0,
-		gid:        0,
-		rootPath:   directory,
-	}
+	return NewSlowFsWithOptions(directory, scheduler, Options{})
 }
 
 // NewSlowFsWithOwner creates a new SlowFs with specific uid/gid
 func NewSlowFsWithOwner(directory string, scheduler *scheduler.Scheduler, uid, gid uint32, verboseLog bool) *SlowFs {
-	return &SlowFs{
-		FileSystem: pathfs.NewLoopbackFileSystem(directory),
-		scheduler:  scheduler,
-		uid:        uid,
-		gid:        gid,
-		rootPath:   directory,
-		verboseLog: verboseLog,
+	return NewSlowFsWithOptions(directory, scheduler, Options{
+		Uid:        uid,
+		Gid:        gid,
+		VerboseLog: verboseLog,
+	})
+}
+
+// Options holds optional settings for a SlowFs.
+type Options struct {
+	// Ownership reported for the root directory. Left alone if either is 0.
+	Uid uint32
+	Gid uint32
+
+	// VerboseLog enables logging of failed operations.
+	VerboseLog bool
+
+	// DebugContext logs the caller of every operation, for debugging permission problems.
+	DebugContext bool
+
+	// If set, reads and writes whose offset or size aren't a multiple of Alignment fail with
+	// EINVAL, like O_DIRECT.
+	Alignment units.NumBytes
+
+	// If set, StatFs reports the backing filesystem's size and free space multiplied by
+	// StatFsScale, making the device look smaller without enforcing a limit. Devices with a
+	// SimulatedCapacity report that instead.
+	StatFsScale float64
+
+	// ReadOnly makes every operation which would modify the filesystem fail with EROFS without
+	// reaching backing, so a read-only backing directory works without ownership fixup errors.
+	ReadOnly bool
+
+	// If set, opening or creating a file while MaxOpenFiles are open fails with EMFILE, as on a
+	// device or driver with a limited number of handles.
+	MaxOpenFiles int
+
+	// If set, data written only becomes visible to reads WriteVisibilityDelay later, and new
+	// files can't be found until then, as on an eventually consistent object store. Until then
+	// reads return the old data.
+	WriteVisibilityDelay time.Duration
+}
+
+// NewSlowFsWithOptions creates a new SlowFs using the specified scheduler at the given directory,
+// configured by opts.
+func NewSlowFsWithOptions(directory string, scheduler *scheduler.Scheduler, opts Options) *SlowFs {
+	return NewSlowFsOnFileSystem(pathfs.NewLoopbackFileSystem(directory), directory, scheduler, opts)
+}
+
+// NewSlowFsOnFileSystem creates a new SlowFs which slows down operations on backing, allowing
+// slowfs to be layered over other filesystems. rootPath is the directory on disk holding
+// backing's files, which is used to give new files the caller's ownership. It may be empty if
+// there is no such directory, in which case ownership is left to backing.
+func NewSlowFsOnFileSystem(backing pathfs.FileSystem, rootPath string, scheduler *scheduler.Scheduler, opts Options) *SlowFs {
+	sfs := &SlowFs{
+		FileSystem:   backing,
+		scheduler:    scheduler,
+		uid:          opts.Uid,
+		gid:          opts.Gid,
+		rootPath:     rootPath,
+		verboseLog:   opts.VerboseLog,
+		debugContext: opts.DebugContext,
+		alignment:    opts.Alignment,
+		statFsScale:  opts.StatFsScale,
+		readOnly:     opts.ReadOnly,
+		maxOpenFiles: opts.MaxOpenFiles,
+		stale:        newStaleData(opts.WriteVisibilityDelay),
+		openFiles:    make(map[*slowFile]struct{}),
+		tracksUsage:  scheduler.SimulatesCapacity(),
+	}
+	if sfs.tracksUsage && rootPath != "" {
+		sfs.countUsedBytes()
+	}
+	return sfs
+}
+
+// sleepUntil sleeps until opTime has passed since start, and records how long it slept.
+func (sfs *SlowFs) sleepUntil(start time.Time, opTime time.Duration) {
+	now := time.Now()
+	elapsed := now.Sub(start)
+	sfs.underruns.record(now, elapsed, opTime)
+	d := opTime - elapsed
+	if d <= 0 {
+		return
 	}
+	time.Sleep(d)
+	atomic.AddInt64(&sfs.injectedDelay, int64(d))
+}
+
+// Underruns returns how many operations took longer than the scheduler decided they should,
+// because the host couldn't keep up.
+func (sfs *SlowFs) Underruns() uint64 {
+	return sfs.underruns.total()
+}
+
+// TotalInjectedDelay returns how long operations have been delayed in total to make them take
+// as long as the scheduler decided.
+func (sfs *SlowFs) TotalInjectedDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&sfs.injectedDelay))
+}
+
+// aligned returns whether an access of size bytes at off meets the alignment requirement.
+func (sfs *SlowFs) aligned(off int64, size int) bool {
+	if sfs.alignment <= 0 {
+		return true
+	}
+	return off%int64(sfs.alignment) == 0 && int64(size)%int64(sfs.alignment) == 0
+}
+
+// logCaller logs who is performing op on name, if DebugContext is set.
+func (sfs *SlowFs) logCaller(op, name string, context *fuse.Context) {
+	if !sfs.debugContext || context == nil {
+		return
+	}
+	log.Printf("CONTEXT: op=%s path=%s uid=%d gid=%d pid=%d",
+		op, name, context.Caller.Uid, context.Caller.Gid, context.Caller.Pid)
 }
 
 // Open opens a file, and then waits until the scheduled time.
 func (sfs *SlowFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	if sfs.readOnly && (flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&(syscall.O_CREAT|syscall.O_TRUNC) != 0) {
+		return nil, fuse.EROFS
+	}
+	sfs.logCaller("OPEN", name, context)
+	if flags&syscall.O_CREAT == 0 && sfs.stale.hidden(name, start) {
+		return nil, fuse.ENOENT
+	}
+	if !sfs.reserveFileSlot() {
+		return sfs.tooManyOpenFiles(start, name)
+	}
 	
 	// Log file access with user context (only in verbose mode)
 	if sfs.verboseLog && context != nil {
@@ -289,22 +768,38 @@ func (sfs *SlowFs) Open(name string, flags uint32, context *fuse.Context) (nodef
 	
 	// Check if this is a create operation
 	fileExists := true
-	if _, err := os.Stat(filepath.Join(sfs.rootPath, name)); os.IsNotExist(err) {
+	if sfs.rootPath != "" {
+		if _, err := os.Stat(filepath.Join(sfs.rootPath, name)); os.IsNotExist(err) {
+			fileExists = false
+		}
+	} else if _, status := sfs.FileSystem.GetAttr(name, nil); status == fuse.ENOENT {
 		fileExists = false
 	}
+	if !fileExists && flags&syscall.O_CREAT != 0 && sfs.lacksSpace(name, 1) {
+		sfs.releaseFileSlot()
+		return nil, fuse.Status(syscall.ENOSPC)
+	}
 	
+	truncated := sfs.truncatedBytes(name, flags)
 	file, status := sfs.FileSystem.Open(name, flags, context)
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
+		sfs.releaseFileSlot()
 		if sfs.verboseLog && context != nil {
 			log.Printf("ERROR: Open failed for uid=%d file=%s status=%s", 
 				context.Caller.Uid, name, status)
 		}
 		return file, status
 	}
+	if truncated > 0 {
+		sfs.scheduler.AddUsedBytes(name, -truncated)
+	}
+	if flags&syscall.O_TRUNC != 0 {
+		sfs.stale.forget(name)
+	}
 
 	// If file was created and we have context, set correct ownership
-	if !fileExists && (flags&syscall.O_CREAT != 0) && context != nil {
+	if !fileExists && (flags&syscall.O_CREAT != 0) && context != nil && sfs.rootPath != "" {
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
 		
@@ -313,30 +808,41 @@ func (sfs *SlowFs) Open(name string, flags uint32, context *fuse.Context) (nodef
 			log.Printf("Warning: failed to set ownership of opened/created file %s: %v", fullPath, err)
 		}
 	}
-
-	slowFile := &slowFile{
-		File: file,
-		sfs:  sfs,
-		path: name,
+	if !fileExists && sfs.stale.enabled() {
+		sfs.stale.recordCreate(name, start)
 	}
 
+	slowFile := sfs.newSlowFile(file, name, flags)
+
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+		Type:      scheduler.OpenRequest,
+		Op:        "open",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return slowFile, status
 }
 
-// GetAttr calls the underlying filesystem then sends a MetadataRequest and
+// GetAttr calls the underlying filesystem then sends a StatRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	sfs.logCaller("GETATTR", name, context)
+	if sfs.stale.hidden(name, start) {
+		return nil, fuse.ENOENT
+	}
 	attr, status := sfs.FileSystem.GetAttr(name, context)
 	if status != fuse.OK {
 		return attr, status
 	}
+	if sfs.stale.enabled() && attr.IsRegular() {
+		attr.Size = uint64(sfs.stale.visibleSize(name, start, int64(attr.Size)))
+	}
 
 	// Only override root directory uid/gid, other files should have correct ownership
 	if name == "" && sfs.uid != 0 && sfs.gid != 0 {
@@ -346,10 +852,12 @@ func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+		Type:      scheduler.StatRequest,
+		Op:        "getattr",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return attr, status
 }
@@ -358,6 +866,13 @@ func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 // waits how long it is told to.
 func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("CHMOD", name, context)
 	status := sfs.FileSystem.Chmod(name, mode, context)
 	if status != fuse.OK {
 		return status
@@ -365,9 +880,11 @@ func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.S
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "chmod",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -376,6 +893,13 @@ func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.S
 // waits how long it is told to.
 func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("CHOWN", name, context)
 	status := sfs.FileSystem.Chown(name, uid, gid, context)
 	if status != fuse.OK {
 		return status
@@ -383,9 +907,11 @@ func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Cont
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "chown",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -394,6 +920,13 @@ func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Cont
 // waits how long it is told to.
 func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("UTIMENS", name, context)
 	status := sfs.FileSystem.Utimens(name, Atime, Mtime, context)
 	if status != fuse.OK {
 		return status
@@ -401,9 +934,11 @@ func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "utimens",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -412,34 +947,63 @@ func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 // waits how long it is told to.
 func (sfs *SlowFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("TRUNCATE", name, context)
+	var oldSize int64
+	if sfs.tracksUsage {
+		oldSize = sfs.fileSize(name)
+		if !sfs.reserveSpace(name, units.NumBytes(int64(size)-oldSize)) {
+			return fuse.Status(syscall.ENOSPC)
+		}
+	}
 	status := sfs.FileSystem.Truncate(name, size, context)
 	if status != fuse.OK {
+		if sfs.tracksUsage && int64(size) > oldSize {
+			sfs.scheduler.AddUsedBytes(name, -units.NumBytes(int64(size)-oldSize))
+		}
 		return status
 	}
+	sfs.stale.forget(name)
+	if sfs.tracksUsage && int64(size) < oldSize {
+		sfs.scheduler.AddUsedBytes(name, units.NumBytes(int64(size)-oldSize))
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "truncate",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
 
-// Access calls the underlying filesystem then sends a MetadataRequest and
+// Access calls the underlying filesystem then sends a StatRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	sfs.logCaller("ACCESS", name, context)
 	status := sfs.FileSystem.Access(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+		Type:      scheduler.StatRequest,
+		Op:        "access",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -448,13 +1012,20 @@ func (sfs *SlowFs) Access(name string, mode uint32, context *fuse.Context) fuse.
 // waits how long it is told to.
 func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("LINK", oldName, context)
 	status := sfs.FileSystem.Link(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
 
 	// Set correct ownership if context is available
-	if context != nil {
+	if context != nil && sfs.rootPath != "" {
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
 		
@@ -466,9 +1037,11 @@ func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) f
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "link",
 		Timestamp: start,
+		Path:      oldName,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -477,6 +1050,16 @@ func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) f
 // waits how long it is told to.
 func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("MKDIR", name, context)
+	if sfs.lacksSpace(name, 1) {
+		return fuse.Status(syscall.ENOSPC)
+	}
 	status := sfs.FileSystem.Mkdir(name, mode, context)
 	if status != fuse.OK {
 		if context != nil {
@@ -487,7 +1070,7 @@ func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 	}
 
 	// Set correct ownership if context is available
-	if context != nil {
+	if context != nil && sfs.rootPath != "" {
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
 		
@@ -499,9 +1082,11 @@ func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "mkdir",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -510,13 +1095,20 @@ func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 // waits how long it is told to.
 func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("MKNOD", name, context)
 	status := sfs.FileSystem.Mknod(name, mode, dev, context)
 	if status != fuse.OK {
 		return status
 	}
 
 	// Set correct ownership if context is available
-	if context != nil {
+	if context != nil && sfs.rootPath != "" {
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
 		
@@ -528,9 +1120,11 @@ func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Con
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "mknod",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -539,16 +1133,41 @@ func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Con
 // waits how long it is told to.
 func (sfs *SlowFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("RENAME", oldName, context)
+	// Renaming over a file frees its space, and moving a file from under one path prefix to
+	// another moves its data from one device to the other.
+	var replaced, moved units.NumBytes
+	if sfs.tracksUsage && oldName != newName {
+		replaced = sfs.unlinkedBytes(newName)
+		if attr, status := sfs.FileSystem.GetAttr(oldName, nil); status == fuse.OK && attr.IsRegular() {
+			moved = units.NumBytes(attr.Size)
+		}
+	}
 	status := sfs.FileSystem.Rename(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
+	sfs.stale.forget(oldName)
+	sfs.stale.forget(newName)
+	if replaced > 0 || moved > 0 {
+		sfs.scheduler.AddUsedBytes(newName, moved-replaced)
+		sfs.scheduler.AddUsedBytes(oldName, -moved)
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "rename",
 		Timestamp: start,
+		Path:      oldName,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.scheduler.RenameFile(oldName, newName)
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -557,6 +1176,13 @@ func (sfs *SlowFs) Rename(oldName string, newName string, context *fuse.Context)
 // waits how long it is told to.
 func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("RMDIR", name, context)
 	status := sfs.FileSystem.Rmdir(name, context)
 	if status != fuse.OK {
 		return status
@@ -564,9 +1190,11 @@ func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "rmdir",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -575,7 +1203,16 @@ func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 // waits how long it is told to.
 func (sfs *SlowFs) Unlink(name string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("UNLINK", name, context)
+	freed := sfs.unlinkedBytes(name)
 	status := sfs.FileSystem.Unlink(name, context)
+	sfs.stale.forget(name)
 	if status != fuse.OK {
 		if context != nil {
 			log.Printf("ERROR: Unlink failed for uid=%d file=%s status=%s", 
@@ -583,20 +1220,40 @@ func (sfs *SlowFs) Unlink(name string, context *fuse.Context) fuse.Status {
 		}
 		return status
 	}
+	if freed > 0 {
+		sfs.scheduler.AddUsedBytes(name, -freed)
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "unlink",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	// After scheduling, since the unlink itself is recorded against the file.
+	sfs.scheduler.ForgetFile(name)
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
 
+// isConfigXAttr returns whether attribute of the file at name is ConfigXAttr.
+func isConfigXAttr(name, attribute string) bool {
+	return name == "" && attribute == ConfigXAttr
+}
+
 // GetXAttr calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// waits how long it is told to. ConfigXAttr on the root is answered straight
+// away instead.
 func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	if isConfigXAttr(name, attribute) {
+		return []byte(sfs.scheduler.Config().String()), fuse.OK
+	}
+	sfs.logCaller("GETXATTR", name, context)
 	data, status := sfs.FileSystem.GetXAttr(name, attribute, context)
 	if status != fuse.OK {
 		return data, status
@@ -604,27 +1261,42 @@ func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "getxattr",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return data, status
 }
 
 // ListXAttr calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// waits how long it is told to. The root also lists ConfigXAttr.
 func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	sfs.logCaller("LISTXATTR", name, context)
 	attributes, status := sfs.FileSystem.ListXAttr(name, context)
+	if name == "" {
+		// The root lists the config attribute even if the backing filesystem has no xattrs.
+		if status != fuse.OK {
+			attributes, status = nil, fuse.OK
+		}
+		attributes = append(attributes, ConfigXAttr)
+	}
 	if status != fuse.OK {
 		return attributes, status
 	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "listxattr",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return attributes, status
 }
@@ -633,6 +1305,16 @@ func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 // waits how long it is told to.
 func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if isConfigXAttr(name, attr) {
+		return fuse.EPERM
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("REMOVEXATTR", name, context)
 	status := sfs.FileSystem.RemoveXAttr(name, attr, context)
 	if status != fuse.OK {
 		return status
@@ -640,9 +1322,11 @@ func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context)
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "removexattr",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -651,6 +1335,16 @@ func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context)
 // waits how long it is told to.
 func (sfs *SlowFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if isConfigXAttr(name, attr) {
+		return fuse.EPERM
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("SETXATTR", name, context)
 	status := sfs.FileSystem.SetXAttr(name, attr, data, flags, context)
 	if status != fuse.OK {
 		return status
@@ -658,9 +1352,11 @@ func (sfs *SlowFs) SetXAttr(name string, attr string, data []byte, flags int, co
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "setxattr",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -669,17 +1365,35 @@ func (sfs *SlowFs) SetXAttr(name string, attr string, data []byte, flags int, co
 // waits how long it is told to.
 func (sfs *SlowFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	if sfs.readOnly {
+		return nil, fuse.EROFS
+	}
+	sfs.logCaller("CREATE", name, context)
+	if sfs.lacksSpace(name, 1) {
+		return nil, fuse.Status(syscall.ENOSPC)
+	}
+	if !sfs.reserveFileSlot() {
+		return sfs.tooManyOpenFiles(start, name)
+	}
+	truncated := sfs.truncatedBytes(name, flags)
 	file, status := sfs.FileSystem.Create(name, flags, mode, context)
 	if status != fuse.OK {
+		sfs.releaseFileSlot()
 		if context != nil {
 			log.Printf("ERROR: Create failed for uid=%d file=%s status=%s", 
 				context.Caller.Uid, name, status)
 		}
 		return file, status
 	}
+	if truncated > 0 {
+		sfs.scheduler.AddUsedBytes(name, -truncated)
+	}
 
 	// Set correct ownership if context is available
-	if context != nil {
+	if context != nil && sfs.rootPath != "" {
 		// Use the FUSE context's uid/gid 
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
@@ -691,30 +1405,47 @@ func (sfs *SlowFs) Create(name string, flags uint32, mode uint32, context *fuse.
 			log.Printf("Warning: failed to set ownership of created file %s: %v", fullPath, err)
 		}
 	}
+	if sfs.stale.enabled() {
+		sfs.stale.recordCreate(name, start)
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "create",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
-	return file, status
+	return sfs.newSlowFile(file, name, flags), status
 }
 
-// OpenDir calls the underlying filesystem then sends a MetadataRequest and
+// OpenDir calls the underlying filesystem then sends an OpenDirRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil, fuse.EIO
+	}
+	sfs.logCaller("OPENDIR", name, context)
 	stream, status := sfs.FileSystem.OpenDir(name, context)
 	if status != fuse.OK {
 		return stream, status
 	}
+	if sfs.stale.enabled() {
+		stream = slices.DeleteFunc(stream, func(e fuse.DirEntry) bool {
+			return sfs.stale.hidden(filepath.Join(name, e.Name), start)
+		})
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.MetadataRequest,
+		Type:      scheduler.OpenDirRequest,
+		Op:        "opendir",
 		Timestamp: start,
+		Path:      name,
+		Size:      units.NumBytes(len(stream)),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return stream, status
 }
@@ -723,13 +1454,20 @@ func (sfs *SlowFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 // waits how long it is told to.
 func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
 	start := time.Now()
+	if sfs.Detached() {
+		return fuse.EIO
+	}
+	if sfs.readOnly {
+		return fuse.EROFS
+	}
+	sfs.logCaller("SYMLINK", linkName, context)
 	status := sfs.FileSystem.Symlink(value, linkName, context)
 	if status != fuse.OK {
 		return status
 	}
 
 	// Set correct ownership if context is available
-	if context != nil {
+	if context != nil && sfs.rootPath != "" {
 		targetUid := context.Caller.Uid
 		targetGid := context.Caller.Gid
 		
@@ -741,9 +1479,11 @@ func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context)
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "symlink",
 		Timestamp: start,
+		Path:      linkName,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return status
 }
@@ -752,6 +1492,10 @@ func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context)
 // waits how long it is told to.
 func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
 	start := time.Now()
+	if sfs.Detached() {
+		return "", fuse.EIO
+	}
+	sfs.logCaller("READLINK", name, context)
 	f, status := sfs.FileSystem.Readlink(name, context)
 	if status != fuse.OK {
 		return f, status
@@ -759,9 +1503,11 @@ func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.St
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "readlink",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return f, status
 }
@@ -770,13 +1516,33 @@ func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.St
 // waits how long it is told to.
 func (sfs *SlowFs) StatFs(name string) *fuse.StatfsOut {
 	start := time.Now()
+	if sfs.Detached() {
+		return nil
+	}
 	out := sfs.FileSystem.StatFs(name)
+	// Like other calls the backing filesystem fails, a failed statfs returns without being
+	// scheduled.
+	if out == nil {
+		if sfs.verboseLog {
+			log.Printf("ERROR: StatFs failed for path=%s", name)
+		}
+		return nil
+	}
+	if capacity, used := sfs.scheduler.Usage(name); capacity > 0 {
+		simulateCapacity(out, capacity, used)
+	} else if sfs.statFsScale > 0 {
+		out.Blocks = uint64(float64(out.Blocks) * sfs.statFsScale)
+		out.Bfree = uint64(float64(out.Bfree) * sfs.statFsScale)
+		out.Bavail = uint64(float64(out.Bavail) * sfs.statFsScale)
+	}
 
 	opTime := sfs.scheduler.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
+		Op:        "statfs",
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.sleepUntil(start, opTime)
 
 	return out
 }
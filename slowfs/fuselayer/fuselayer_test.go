@@ -0,0 +1,529 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/nodefs"
+	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
+)
+
+var instantDeviceConfig = &slowfs.DeviceConfig{
+	ReadBytesPerSecond:     1000 * units.Gibibyte,
+	WriteBytesPerSecond:    1000 * units.Gibibyte,
+	AllocateBytesPerSecond: 1000 * units.Gibibyte,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.FastWrite,
+}
+
+func TestSlowFs_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sfs := NewSlowFsWithOptions(dir, scheduler.New(instantDeviceConfig), Options{ReadOnly: true})
+	ctx := &fuse.Context{}
+	file, status := sfs.Open("file", syscall.O_RDONLY, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Open(file, O_RDONLY) = %s, want OK", status)
+	}
+	defer file.Release()
+	now := time.Now()
+
+	cases := []struct {
+		op string
+		fn func() fuse.Status
+	}{
+		{"Open for writing", func() fuse.Status {
+			_, status := sfs.Open("file", syscall.O_WRONLY, ctx)
+			return status
+		}},
+		{"Open with O_TRUNC", func() fuse.Status {
+			_, status := sfs.Open("file", syscall.O_RDONLY|syscall.O_TRUNC, ctx)
+			return status
+		}},
+		{"Create", func() fuse.Status {
+			_, status := sfs.Create("new", syscall.O_WRONLY, 0644, ctx)
+			return status
+		}},
+		{"Chmod", func() fuse.Status { return sfs.Chmod("file", 0600, ctx) }},
+		{"Chown", func() fuse.Status { return sfs.Chown("file", 0, 0, ctx) }},
+		{"Utimens", func() fuse.Status { return sfs.Utimens("file", &now, &now, ctx) }},
+		{"Truncate", func() fuse.Status { return sfs.Truncate("file", 0, ctx) }},
+		{"Link", func() fuse.Status { return sfs.Link("file", "link", ctx) }},
+		{"Symlink", func() fuse.Status { return sfs.Symlink("file", "symlink", ctx) }},
+		{"Mkdir", func() fuse.Status { return sfs.Mkdir("newdir", 0755, ctx) }},
+		{"Mknod", func() fuse.Status { return sfs.Mknod("fifo", syscall.S_IFIFO|0644, 0, ctx) }},
+		{"Rename", func() fuse.Status { return sfs.Rename("file", "renamed", ctx) }},
+		{"Rmdir", func() fuse.Status { return sfs.Rmdir("dir", ctx) }},
+		{"Unlink", func() fuse.Status { return sfs.Unlink("file", ctx) }},
+		{"SetXAttr", func() fuse.Status { return sfs.SetXAttr("file", "user.test", []byte("x"), 0, ctx) }},
+		{"RemoveXAttr", func() fuse.Status { return sfs.RemoveXAttr("file", "user.test", ctx) }},
+		{"file Write", func() fuse.Status {
+			_, status := file.Write([]byte("new"), 0)
+			return status
+		}},
+		{"file Truncate", func() fuse.Status { return file.Truncate(0) }},
+		{"file Chmod", func() fuse.Status { return file.Chmod(0600) }},
+		{"file Chown", func() fuse.Status { return file.Chown(0, 0) }},
+		{"file Utimens", func() fuse.Status { return file.Utimens(&now, &now) }},
+		{"file Allocate", func() fuse.Status { return file.Allocate(0, 4096, 0) }},
+	}
+
+	for _, c := range cases {
+		if got := c.fn(); got != fuse.EROFS {
+			t.Errorf("%s = %s, want %s", c.op, got, fuse.EROFS)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("backing directory has %d entries after rejected modifications, want 2", len(entries))
+	}
+	info, err := os.Stat(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %s after rejected modifications, want %s", info.Mode().Perm(), os.FileMode(0644))
+	}
+
+	// Reads still work.
+	buf := make([]byte, 4)
+	res, status := file.Read(buf, 0)
+	if status != fuse.OK {
+		t.Fatalf("Read = %s, want OK", status)
+	}
+	if data, _ := res.Bytes(buf); string(data) != "data" {
+		t.Errorf("Read = %q, want %q", data, "data")
+	}
+}
+
+func TestSlowFs_ConfigXAttr(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := *instantDeviceConfig
+	config.Name = "instant"
+	sfs := NewSlowFsWithOptions(dir, scheduler.New(&config), Options{})
+	ctx := &fuse.Context{}
+
+	attributes, status := sfs.ListXAttr("", ctx)
+	if status != fuse.OK {
+		t.Fatalf("ListXAttr(root) = _, %s, want OK", status)
+	}
+	found := false
+	for _, attr := range attributes {
+		found = found || attr == ConfigXAttr
+	}
+	if !found {
+		t.Errorf("ListXAttr(root) = %q, want it to include %s", attributes, ConfigXAttr)
+	}
+	attributes, _ = sfs.ListXAttr("file", ctx)
+	for _, attr := range attributes {
+		if attr == ConfigXAttr {
+			t.Errorf("ListXAttr(file) = %q, want only the root to have %s", attributes, ConfigXAttr)
+		}
+	}
+
+	data, status := sfs.GetXAttr("", ConfigXAttr, ctx)
+	if status != fuse.OK {
+		t.Fatalf("GetXAttr(root, %s) = _, %s, want OK", ConfigXAttr, status)
+	}
+	if got, want := string(data), config.String(); got != want {
+		t.Errorf("GetXAttr(root, %s) = %q, want %q", ConfigXAttr, got, want)
+	}
+	if _, status := sfs.GetXAttr("file", ConfigXAttr, ctx); status == fuse.OK {
+		t.Errorf("GetXAttr(file, %s) = _, OK, want an error", ConfigXAttr)
+	}
+
+	if status := sfs.SetXAttr("", ConfigXAttr, []byte("ssd"), 0, ctx); status != fuse.EPERM {
+		t.Errorf("SetXAttr(root, %s) = %s, want %s", ConfigXAttr, status, fuse.EPERM)
+	}
+	if status := sfs.RemoveXAttr("", ConfigXAttr, ctx); status != fuse.EPERM {
+		t.Errorf("RemoveXAttr(root, %s) = %s, want %s", ConfigXAttr, status, fuse.EPERM)
+	}
+
+	// The attribute follows config reloads.
+	updated := config
+	updated.Name = "updated"
+	if err := sfs.scheduler.UpdateConfig(&updated); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := sfs.GetXAttr("", ConfigXAttr, ctx); string(data) != updated.String() {
+		t.Errorf("GetXAttr(root, %s) after UpdateConfig = %q, want %q", ConfigXAttr, data, updated.String())
+	}
+}
+
+func TestSimulateCapacity(t *testing.T) {
+	cases := []struct {
+		desc           string
+		bsize          uint32
+		capacity, used units.NumBytes
+		wantBsize      uint32
+		wantBlocks     uint64
+		wantFree       uint64
+	}{
+		{"empty", 4096, 40960, 0, 4096, 10, 10},
+		{"partly used blocks count as used", 4096, 40960, 4097, 4096, 10, 8},
+		{"full", 4096, 40960, 40960, 4096, 10, 0},
+		{"over capacity", 4096, 40960, 50000, 4096, 10, 0},
+		{"no block size", 0, 8192, 0, defaultStatFsBlockSize, 2, 2},
+	}
+
+	for _, c := range cases {
+		out := &fuse.StatfsOut{Bsize: c.bsize, Blocks: 1 << 40, Bfree: 1 << 39, Bavail: 1 << 38}
+		simulateCapacity(out, c.capacity, c.used)
+		if out.Bsize != c.wantBsize || out.Blocks != c.wantBlocks || out.Bfree != c.wantFree || out.Bavail != c.wantFree {
+			t.Errorf("%s: simulateCapacity(capacity %d, used %d) gives bsize %d, blocks %d, bfree %d, bavail %d, want %d, %d, %d, %d",
+				c.desc, c.capacity, c.used, out.Bsize, out.Blocks, out.Bfree, out.Bavail, c.wantBsize, c.wantBlocks, c.wantFree, c.wantFree)
+		}
+	}
+}
+
+func TestSlowFs_SimulatedCapacity(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), make([]byte, 8192), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "file"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+
+	// Without a simulated capacity, the backing filesystem's numbers are passed through.
+	backing := pathfs.NewLoopbackFileSystem(dir).StatFs("")
+	out := NewSlowFs(dir, scheduler.New(instantDeviceConfig)).StatFs("")
+	if out == nil || out.Blocks != backing.Blocks || out.Bsize != backing.Bsize {
+		t.Errorf("StatFs(root) without SimulatedCapacity = %+v, want the backing filesystem's %+v", out, backing)
+	}
+
+	config := *instantDeviceConfig
+	config.SimulatedCapacity = 1 * units.Mebibyte
+	sfs := NewSlowFs(dir, scheduler.New(&config))
+	out = sfs.StatFs("")
+	bsize := uint64(out.Bsize)
+	// The file already in the backing directory counts once, despite its second link.
+	if got, want := out.Blocks, uint64(units.Mebibyte)/bsize; got != want {
+		t.Errorf("StatFs(root).Blocks = %d, want %d", got, want)
+	}
+	if got, want := out.Bfree, (uint64(units.Mebibyte)-8192)/bsize; got != want {
+		t.Errorf("StatFs(root).Bfree = %d, want %d", got, want)
+	}
+
+	file, status := sfs.Create("new", syscall.O_WRONLY, 0644, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Create(new) = %s, want OK", status)
+	}
+	defer file.Release()
+	data := make([]byte, 4*bsize)
+	if _, status := file.Write(data, 0); status != fuse.OK {
+		t.Fatalf("Write = %s, want OK", status)
+	}
+	// Overwriting doesn't use more space.
+	if _, status := file.Write(data, 0); status != fuse.OK {
+		t.Fatalf("Write = %s, want OK", status)
+	}
+	if got, want := sfs.StatFs("").Bavail, out.Bavail-4; got != want {
+		t.Errorf("StatFs(root).Bavail after writing 4 blocks = %d, want %d", got, want)
+	}
+}
+
+func TestSlowFs_NoSpace(t *testing.T) {
+	dir := t.TempDir()
+	config := *instantDeviceConfig
+	config.SimulatedCapacity = 8192
+	sfs := NewSlowFs(dir, scheduler.New(&config))
+	ctx := &fuse.Context{}
+	enospc := fuse.Status(syscall.ENOSPC)
+
+	file, status := sfs.Create("a", syscall.O_RDWR, 0644, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Create(a) = %s, want OK", status)
+	}
+	defer file.Release()
+	if _, status := file.Write(make([]byte, 8192), 0); status != fuse.OK {
+		t.Fatalf("Write filling the device = %s, want OK", status)
+	}
+
+	full := []struct {
+		op string
+		fn func() fuse.Status
+	}{
+		{"Write past the end", func() fuse.Status {
+			_, status := file.Write([]byte("x"), 8192)
+			return status
+		}},
+		{"Allocate past the end", func() fuse.Status { return file.Allocate(8192, 1, 0) }},
+		{"Truncate past the end", func() fuse.Status { return file.Truncate(16384) }},
+		{"Truncate by name past the end", func() fuse.Status { return sfs.Truncate("a", 16384, ctx) }},
+		{"Create", func() fuse.Status {
+			_, status := sfs.Create("b", syscall.O_WRONLY, 0644, ctx)
+			return status
+		}},
+		{"Open with O_CREAT", func() fuse.Status {
+			_, status := sfs.Open("b", syscall.O_WRONLY|syscall.O_CREAT, ctx)
+			return status
+		}},
+		{"Mkdir", func() fuse.Status { return sfs.Mkdir("dir", 0755, ctx) }},
+	}
+	for _, c := range full {
+		if got := c.fn(); got != enospc {
+			t.Errorf("%s on a full device = %s, want %s", c.op, got, enospc)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("b exists in the backing directory after failing to create it")
+	}
+
+	// Overwriting needs no more space.
+	if _, status := file.Write([]byte("x"), 0); status != fuse.OK {
+		t.Errorf("Write overwriting data on a full device = %s, want OK", status)
+	}
+
+	// Truncating frees space, which can then be written again.
+	if status := file.Truncate(4096); status != fuse.OK {
+		t.Fatalf("Truncate(4096) = %s, want OK", status)
+	}
+	// Failed writes give back the space they reserved.
+	readOnly, status := sfs.Open("a", syscall.O_RDONLY, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Open(a, O_RDONLY) = %s, want OK", status)
+	}
+	defer readOnly.Release()
+	if _, status := readOnly.Write(make([]byte, 4096), 4096); status == fuse.OK {
+		t.Errorf("Write to a read-only handle = OK, want an error")
+	}
+	if _, status := file.Write(make([]byte, 4096), 4096); status != fuse.OK {
+		t.Errorf("Write after truncating = %s, want OK", status)
+	}
+	if _, status := file.Write([]byte("x"), 8192); status != enospc {
+		t.Errorf("Write past the end after filling the device again = %s, want %s", status, enospc)
+	}
+
+	// Unlinking frees the file's space.
+	if status := sfs.Unlink("a", ctx); status != fuse.OK {
+		t.Fatalf("Unlink(a) = %s, want OK", status)
+	}
+	if status := sfs.Mkdir("dir", 0755, ctx); status != fuse.OK {
+		t.Errorf("Mkdir after unlinking = %s, want OK", status)
+	}
+	other, status := sfs.Create("b", syscall.O_WRONLY, 0644, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Create(b) after unlinking = %s, want OK", status)
+	}
+	defer other.Release()
+	if _, status := other.Write(make([]byte, 8192), 0); status != fuse.OK {
+		t.Errorf("Write filling the device after unlinking = %s, want OK", status)
+	}
+}
+
+func TestSlowFs_NoSpaceWithoutRootPath(t *testing.T) {
+	dir := t.TempDir()
+	config := *instantDeviceConfig
+	config.SimulatedCapacity = 4096
+	sched := scheduler.New(&config)
+	sched.AddUsedBytes("", 4096)
+	sfs := NewSlowFsOnFileSystem(pathfs.NewLoopbackFileSystem(dir), "", sched, Options{})
+	enospc := fuse.Status(syscall.ENOSPC)
+
+	if _, status := sfs.Open("new", syscall.O_WRONLY|syscall.O_CREAT, &fuse.Context{}); status != enospc {
+		t.Errorf("Open(new, O_CREAT) on a full device without a root path = %s, want %s", status, enospc)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Errorf("new exists in the backing directory after failing to create it")
+	}
+}
+
+func TestSlowFs_MetadataOpsUsePathDevices(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "slow"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	slowConfig := *instantDeviceConfig
+	slowConfig.MetadataOpTime = 50 * time.Millisecond
+	sched := scheduler.NewWithPathConfigs(instantDeviceConfig, map[string]*slowfs.DeviceConfig{"slow": &slowConfig})
+	sfs := NewSlowFs(dir, sched)
+	ctx := &fuse.Context{}
+
+	start := time.Now()
+	if status := sfs.Mkdir("slow/dir", 0755, ctx); status != fuse.OK {
+		t.Fatalf("Mkdir(slow/dir) = %s, want OK", status)
+	}
+	if elapsed := time.Since(start); elapsed < slowConfig.MetadataOpTime {
+		t.Errorf("Mkdir(slow/dir) took %s, want at least the slow device's %s", elapsed, slowConfig.MetadataOpTime)
+	}
+
+	start = time.Now()
+	if status := sfs.Mkdir("dir", 0755, ctx); status != fuse.OK {
+		t.Fatalf("Mkdir(dir) = %s, want OK", status)
+	}
+	if elapsed := time.Since(start); elapsed >= slowConfig.MetadataOpTime {
+		t.Errorf("Mkdir(dir) took %s, want it served by the instant device", elapsed)
+	}
+}
+
+func TestSlowFs_MetadataPerComponentTime(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := *instantDeviceConfig
+	config.MetadataPerComponentTime = 20 * time.Millisecond
+	sfs := NewSlowFs(dir, scheduler.New(&config))
+	ctx := &fuse.Context{}
+
+	// Operations other than open pay for each component of their path too.
+	cases := []struct {
+		op string
+		fn func() fuse.Status
+	}{
+		{"Mkdir(a/b/c)", func() fuse.Status { return sfs.Mkdir("a/b/c", 0755, ctx) }},
+		{"Chmod(a/b/c)", func() fuse.Status { return sfs.Chmod("a/b/c", 0700, ctx) }},
+		{"Rmdir(a/b/c)", func() fuse.Status { return sfs.Rmdir("a/b/c", ctx) }},
+	}
+	for _, c := range cases {
+		start := time.Now()
+		if status := c.fn(); status != fuse.OK {
+			t.Fatalf("%s = %s, want OK", c.op, status)
+		}
+		if elapsed, want := time.Since(start), 3*config.MetadataPerComponentTime; elapsed < want {
+			t.Errorf("%s took %s, want at least %s", c.op, elapsed, want)
+		}
+	}
+}
+
+func TestSlowFs_UnlinkForgetsFileStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sched := scheduler.New(instantDeviceConfig)
+	sfs := NewSlowFs(dir, sched)
+	ctx := &fuse.Context{}
+
+	if _, status := sfs.GetAttr("file", ctx); status != fuse.OK {
+		t.Fatalf("GetAttr(file) = %s, want OK", status)
+	}
+	if status := sfs.Unlink("file", ctx); status != fuse.OK {
+		t.Fatalf("Unlink(file) = %s, want OK", status)
+	}
+	for _, st := range sched.FileStats() {
+		if st.Path == "file" {
+			t.Errorf("FileStats() after Unlink(file) includes %+v, want it forgotten", st)
+		}
+	}
+}
+
+func TestSlowFs_RenameMovesFileStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sched := scheduler.New(instantDeviceConfig)
+	sfs := NewSlowFs(dir, sched)
+	ctx := &fuse.Context{}
+
+	if _, status := sfs.GetAttr("old", ctx); status != fuse.OK {
+		t.Fatalf("GetAttr(old) = %s, want OK", status)
+	}
+	if status := sfs.Rename("old", "new", ctx); status != fuse.OK {
+		t.Fatalf("Rename(old, new) = %s, want OK", status)
+	}
+	files := sched.FileStats()
+	if len(files) != 1 || files[0].Path != "new" || files[0].Ops != 2 {
+		t.Errorf("FileStats() after Rename(old, new) = %+v, want the 2 ops on old under new", files)
+	}
+}
+
+func TestSlowFs_MaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sfs := NewSlowFsWithOptions(dir, scheduler.New(instantDeviceConfig), Options{MaxOpenFiles: 2})
+	ctx := &fuse.Context{}
+
+	var open []nodefs.File
+	openFile := func() fuse.Status {
+		file, status := sfs.Open("file", syscall.O_RDONLY, ctx)
+		if status == fuse.OK {
+			open = append(open, file)
+		}
+		return status
+	}
+	createFile := func(name string) func() fuse.Status {
+		return func() fuse.Status {
+			file, status := sfs.Create(name, syscall.O_WRONLY, 0644, ctx)
+			if status == fuse.OK {
+				open = append(open, file)
+			}
+			return status
+		}
+	}
+	releaseFile := func() fuse.Status {
+		open[0].Release()
+		open = open[1:]
+		return fuse.OK
+	}
+	emfile := fuse.Status(syscall.EMFILE)
+
+	// Each step runs in turn, with the files opened by earlier steps still open.
+	cases := []struct {
+		op   string
+		fn   func() fuse.Status
+		want fuse.Status
+	}{
+		{"Open with none open", openFile, fuse.OK},
+		{"Create with one open", createFile("a"), fuse.OK},
+		{"Open at the limit", openFile, emfile},
+		{"Create at the limit", createFile("b"), emfile},
+		{"Release", releaseFile, fuse.OK},
+		{"Open of a missing file", func() fuse.Status {
+			_, status := sfs.Open("missing", syscall.O_RDONLY, ctx)
+			return status
+		}, fuse.ENOENT},
+		{"Open after a release and a failed open", openFile, fuse.OK},
+		{"Open at the limit again", openFile, emfile},
+	}
+	for _, c := range cases {
+		if got := c.fn(); got != c.want {
+			t.Errorf("%s = %s, want %s", c.op, got, c.want)
+		}
+	}
+	for _, file := range open {
+		file.Release()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("Stat(b) after a Create failed with EMFILE = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// underrunWindow is how often underruns are checked for.
+	underrunWindow = 10 * time.Second
+	// underrunMinOps is how many operations a window needs for its underruns to count, so a few
+	// slow operations on an idle mount don't cause a warning.
+	underrunMinOps = 100
+	// underrunWarningInterval limits how often the warning is logged.
+	underrunWarningInterval = time.Minute
+)
+
+// underrunDetector notices when operations consistently take longer for real than the scheduler
+// decided, which means the host rather than the modeled device is the bottleneck.
+type underrunDetector struct {
+	mu sync.Mutex
+
+	// Totals since the mount started.
+	underruns uint64
+
+	// The current window.
+	windowStart     time.Time
+	windowOps       uint64
+	windowUnderruns uint64
+	windowReal      time.Duration
+	windowModeled   time.Duration
+
+	lastWarning time.Time
+}
+
+// record notes that an operation scheduled to take modeled actually took real, and logs a
+// warning if most operations in the window which just ended took longer than modeled, returning
+// whether it did. Operations modeled as instant are ignored, since any real work would look like
+// an underrun.
+func (ud *underrunDetector) record(now time.Time, real, modeled time.Duration) bool {
+	if modeled <= 0 {
+		return false
+	}
+	ud.mu.Lock()
+	defer ud.mu.Unlock()
+
+	if ud.windowStart.IsZero() {
+		ud.windowStart = now
+	}
+	ud.windowOps++
+	ud.windowReal += real
+	ud.windowModeled += modeled
+	if real > modeled {
+		ud.underruns++
+		ud.windowUnderruns++
+	}
+
+	window := now.Sub(ud.windowStart)
+	if window < underrunWindow {
+		return false
+	}
+	warn := ud.windowOps >= underrunMinOps && 2*ud.windowUnderruns > ud.windowOps &&
+		now.Sub(ud.lastWarning) >= underrunWarningInterval
+	if warn {
+		ud.lastWarning = now
+		log.Printf("WARNING: %d of %d operations in the last %s took longer than modeled, so the host "+
+			"is the bottleneck and timings are not accurate. Operations took %.1fx their modeled time, "+
+			"completing at about %.0f ops/s.",
+			ud.windowUnderruns, ud.windowOps, window.Round(time.Second),
+			float64(ud.windowReal)/float64(ud.windowModeled), float64(ud.windowOps)/window.Seconds())
+	}
+	ud.windowStart = now
+	ud.windowOps, ud.windowUnderruns = 0, 0
+	ud.windowReal, ud.windowModeled = 0, 0
+	return warn
+}
+
+// total returns how many operations have taken longer than modeled.
+func (ud *underrunDetector) total() uint64 {
+	ud.mu.Lock()
+	defer ud.mu.Unlock()
+	return ud.underruns
+}
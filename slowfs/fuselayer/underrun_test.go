@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnderrunDetector(t *testing.T) {
+	// window is a window's worth of operations, the first underruns of which take longer than
+	// modeled.
+	type window struct {
+		ops, underruns int
+		instant        bool
+	}
+	cases := []struct {
+		desc      string
+		windows   []window
+		wantWarns []bool
+		wantTotal uint64
+	}{
+		{
+			desc:      "too few operations",
+			windows:   []window{{ops: underrunMinOps / 2, underruns: underrunMinOps / 2}},
+			wantWarns: []bool{false},
+			wantTotal: underrunMinOps / 2,
+		},
+		{
+			desc:      "most operations underrun",
+			windows:   []window{{ops: 200, underruns: 150}},
+			wantWarns: []bool{true},
+			wantTotal: 150,
+		},
+		{
+			desc:      "half of operations underrun",
+			windows:   []window{{ops: 200, underruns: 100}},
+			wantWarns: []bool{false},
+			wantTotal: 100,
+		},
+		{
+			desc:      "operations modeled as instant",
+			windows:   []window{{ops: 200, underruns: 200, instant: true}},
+			wantWarns: []bool{false},
+			wantTotal: 0,
+		},
+		{
+			desc: "warnings rate limited",
+			windows: []window{
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+				{ops: 200, underruns: 150},
+			},
+			wantWarns: []bool{true, false, false, false, false, false, true},
+			wantTotal: 7 * 150,
+		},
+	}
+
+	for _, c := range cases {
+		var ud underrunDetector
+		var warns []bool
+		start := time.Unix(1000, 0)
+		for _, w := range c.windows {
+			modeled := time.Millisecond
+			if w.instant {
+				modeled = 0
+			}
+			// The operations are spread over the window, the last one ending it.
+			warned := false
+			for i := 0; i < w.ops; i++ {
+				now := start.Add(time.Duration(i) * underrunWindow / time.Duration(w.ops-1))
+				real := modeled
+				if i < w.underruns {
+					real = 2 * time.Millisecond
+				}
+				warned = ud.record(now, real, modeled) || warned
+			}
+			warns = append(warns, warned)
+			start = start.Add(underrunWindow)
+		}
+		if !reflect.DeepEqual(warns, c.wantWarns) {
+			t.Errorf("%s: warned after each window %v, want %v", c.desc, warns, c.wantWarns)
+		}
+		if got := ud.total(); got != c.wantTotal {
+			t.Errorf("%s: total() = %d, want %d", c.desc, got, c.wantTotal)
+		}
+	}
+}
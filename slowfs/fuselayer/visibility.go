@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"sync"
+	"time"
+)
+
+// staleData remembers what files looked like before recent writes, so that until the writes
+// become visible, reads can be served the old data, as from an eventually consistent store.
+type staleData struct {
+	// How long after a write it becomes visible.
+	delay time.Duration
+
+	mu    sync.Mutex
+	files map[string]*staleFile
+}
+
+// staleFile holds the writes to one file which are not visible yet, oldest first. Since every
+// write takes the same delay to become visible, they also become visible oldest first.
+type staleFile struct {
+	// Set if the file was created by a write which isn't visible yet.
+	created bool
+
+	writes []staleWrite
+}
+
+// staleWrite is a write which is not visible until visibleAt.
+type staleWrite struct {
+	visibleAt time.Time
+	// The offset of the write, and the data it overwrote, cut short at the old end of the file.
+	off     int64
+	oldData []byte
+	// The size of the file before the write.
+	oldSize int64
+}
+
+func newStaleData(delay time.Duration) *staleData {
+	return &staleData{
+		delay: delay,
+		files: make(map[string]*staleFile),
+	}
+}
+
+// enabled returns whether writes are made visible late.
+func (sd *staleData) enabled() bool {
+	return sd.delay > 0
+}
+
+// recordCreate notes that path was created empty at now, so it is hidden until the creation is
+// visible.
+func (sd *staleData) recordCreate(path string, now time.Time) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.files[path] = &staleFile{
+		created: true,
+		writes:  []staleWrite{{visibleAt: now.Add(sd.delay)}},
+	}
+}
+
+// recordWrite notes that at now, a write at off replaced oldData in path, which was oldSize
+// bytes long.
+func (sd *staleData) recordWrite(path string, now time.Time, off int64, oldData []byte, oldSize int64) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sf := sd.files[path]
+	if sf == nil {
+		sf = &staleFile{}
+		sd.files[path] = sf
+	}
+	sf.writes = append(sf.writes, staleWrite{
+		visibleAt: now.Add(sd.delay),
+		off:       off,
+		oldData:   oldData,
+		oldSize:   oldSize,
+	})
+}
+
+// forget drops what is remembered about path, making all its writes visible, for changes such as
+// renames and truncation which aren't delayed.
+func (sd *staleData) forget(path string) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	delete(sd.files, path)
+}
+
+// pending returns the writes to path which are not visible at now, dropping those which are.
+// Must be called with mu held.
+func (sd *staleData) pending(path string, now time.Time) *staleFile {
+	sf := sd.files[path]
+	if sf == nil {
+		return nil
+	}
+	i := 0
+	for i < len(sf.writes) && !sf.writes[i].visibleAt.After(now) {
+		i++
+	}
+	if i == len(sf.writes) {
+		delete(sd.files, path)
+		return nil
+	}
+	if i > 0 {
+		sf.created = false
+		sf.writes = sf.writes[i:]
+	}
+	return sf
+}
+
+// hidden returns whether path was created by a write which is not visible at now.
+func (sd *staleData) hidden(path string, now time.Time) bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sf := sd.pending(path, now)
+	return sf != nil && sf.created
+}
+
+// visibleSize returns the size of path as seen at now, given its actual size.
+func (sd *staleData) visibleSize(path string, now time.Time, size int64) int64 {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sf := sd.pending(path, now); sf != nil {
+		return sf.writes[0].oldSize
+	}
+	return size
+}
+
+// overlay replaces the data in buf, read at off from path, with what was there before the writes
+// which are not visible at now. It returns how much of buf is visible, which is less than its
+// length if the invisible writes extended the file.
+func (sd *staleData) overlay(path string, now time.Time, buf []byte, off int64) int {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sf := sd.pending(path, now)
+	if sf == nil {
+		return len(buf)
+	}
+	// Newest first, so the data from before the oldest write ends up on top.
+	for i := len(sf.writes) - 1; i >= 0; i-- {
+		w := sf.writes[i]
+		from, to := max(off, w.off), min(off+int64(len(buf)), w.off+int64(len(w.oldData)))
+		if from < to {
+			copy(buf[from-off:to-off], w.oldData[from-w.off:to-w.off])
+		}
+	}
+	return int(min(int64(len(buf)), max(0, sf.writes[0].oldSize-off)))
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"os"
+	"path/filepath"
+	"slowfs/slowfs/scheduler"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestStaleData(t *testing.T) {
+	start := time.Unix(1000, 0)
+	delay := time.Second
+	// The file holds "abcdef" before any of the writes below.
+	actual := []byte("abcdef")
+
+	type write struct {
+		at      time.Duration
+		off     int64
+		oldData string
+		oldSize int64
+	}
+	cases := []struct {
+		desc     string
+		create   bool
+		writes   []write
+		at       time.Duration
+		size     int64
+		wantData string
+		wantSize int64
+		wantHide bool
+	}{
+		{
+			desc:     "no writes",
+			at:       0,
+			size:     6,
+			wantData: "abcdef",
+			wantSize: 6,
+		},
+		{
+			desc:     "overwrite not visible yet",
+			writes:   []write{{0, 2, "xy", 6}},
+			at:       delay / 2,
+			size:     6,
+			wantData: "abxyef",
+			wantSize: 6,
+		},
+		{
+			desc:     "overwrite visible after delay",
+			writes:   []write{{0, 2, "xy", 6}},
+			at:       delay,
+			size:     6,
+			wantData: "abcdef",
+			wantSize: 6,
+		},
+		{
+			desc:     "extension not visible yet",
+			writes:   []write{{0, 4, "", 4}},
+			at:       delay / 2,
+			size:     6,
+			wantData: "abcd",
+			wantSize: 4,
+		},
+		{
+			desc:     "extension visible after delay",
+			writes:   []write{{0, 4, "", 4}},
+			at:       delay,
+			size:     6,
+			wantData: "abcdef",
+			wantSize: 6,
+		},
+		{
+			desc:     "oldest data wins over overlapping writes",
+			writes:   []write{{0, 1, "xy", 6}, {delay / 4, 2, "zw", 6}},
+			at:       delay / 2,
+			size:     6,
+			wantData: "axywef",
+			wantSize: 6,
+		},
+		{
+			desc:     "only later write still pending",
+			writes:   []write{{0, 1, "xy", 6}, {delay / 2, 2, "zw", 6}},
+			at:       delay,
+			size:     6,
+			wantData: "abzwef",
+			wantSize: 6,
+		},
+		{
+			desc:     "create hidden until visible",
+			create:   true,
+			at:       delay / 2,
+			size:     6,
+			wantData: "",
+			wantSize: 0,
+			wantHide: true,
+		},
+		{
+			desc:     "create visible after delay",
+			create:   true,
+			at:       delay,
+			size:     6,
+			wantData: "abcdef",
+			wantSize: 6,
+		},
+		{
+			desc:     "create not hidden once its first write is visible",
+			create:   true,
+			writes:   []write{{delay / 2, 0, "", 0}},
+			at:       delay,
+			size:     6,
+			wantData: "",
+			wantSize: 0,
+		},
+	}
+
+	for _, c := range cases {
+		sd := newStaleData(delay)
+		if c.create {
+			sd.recordCreate("file", start)
+		}
+		for _, w := range c.writes {
+			sd.recordWrite("file", start.Add(w.at), w.off, []byte(w.oldData), w.oldSize)
+		}
+		now := start.Add(c.at)
+		if got := sd.hidden("file", now); got != c.wantHide {
+			t.Errorf("%s: hidden = %t, want %t", c.desc, got, c.wantHide)
+		}
+		if got := sd.visibleSize("file", now, c.size); got != c.wantSize {
+			t.Errorf("%s: visibleSize = %d, want %d", c.desc, got, c.wantSize)
+		}
+		buf := append([]byte(nil), actual[:c.size]...)
+		if got := string(buf[:sd.overlay("file", now, buf, 0)]); got != c.wantData {
+			t.Errorf("%s: overlay = %q, want %q", c.desc, got, c.wantData)
+		}
+	}
+}
+
+func TestSlowFs_WriteVisibilityDelay(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	sfs := NewSlowFsWithOptions(dir, scheduler.New(instantDeviceConfig), Options{WriteVisibilityDelay: time.Hour})
+
+	file, status := sfs.Open("file", syscall.O_RDWR, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Open(file) = %s, want OK", status)
+	}
+	defer file.Release()
+	if _, status := file.Write([]byte("new data"), 0); status != fuse.OK {
+		t.Fatalf("Write = %s, want OK", status)
+	}
+	readAll := func() string {
+		buf := make([]byte, 16)
+		res, status := file.Read(buf, 0)
+		if status != fuse.OK {
+			t.Fatalf("Read = %s, want OK", status)
+		}
+		data, _ := res.Bytes(buf)
+		return string(data)
+	}
+	if got, want := readAll(), "old"; got != want {
+		t.Errorf("Read after write = %q, want %q", got, want)
+	}
+
+	// Truncating isn't delayed, so the write before it shouldn't reappear afterwards.
+	truncated, status := sfs.Open("file", syscall.O_WRONLY|syscall.O_TRUNC, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Open(file, O_TRUNC) = %s, want OK", status)
+	}
+	truncated.Release()
+	if got, want := readAll(), ""; got != want {
+		t.Errorf("Read after O_TRUNC = %q, want %q", got, want)
+	}
+	attr, status := sfs.GetAttr("file", ctx)
+	if status != fuse.OK {
+		t.Fatalf("GetAttr(file) = %s, want OK", status)
+	}
+	if attr.Size != 0 {
+		t.Errorf("GetAttr(file).Size after O_TRUNC = %d, want 0", attr.Size)
+	}
+
+	created, status := sfs.Create("new", syscall.O_WRONLY, 0644, ctx)
+	if status != fuse.OK {
+		t.Fatalf("Create(new) = %s, want OK", status)
+	}
+	created.Release()
+	if _, status := sfs.GetAttr("new", ctx); status != fuse.ENOENT {
+		t.Errorf("GetAttr(new) before the create is visible = %s, want ENOENT", status)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyHistogram is an empirical distribution of operation latencies, such as one measured on a
+// real device.
+type LatencyHistogram struct {
+	latencies []time.Duration
+	// cumulative[i] is the total count of latencies[0] to latencies[i].
+	cumulative []uint64
+}
+
+// Sample returns the latency at quantile q of the histogram, where q is in [0, 1). Passing a
+// uniformly random q samples from the distribution.
+func (lh *LatencyHistogram) Sample(q float64) time.Duration {
+	total := lh.cumulative[len(lh.cumulative)-1]
+	target := uint64(q * float64(total))
+	i := sort.Search(len(lh.cumulative), func(i int) bool { return lh.cumulative[i] > target })
+	if i == len(lh.latencies) {
+		i--
+	}
+	return lh.latencies[i]
+}
+
+// LoadLatencyHistograms reads latency histograms from the file at path. See
+// ParseLatencyHistograms for the format.
+func LoadLatencyHistograms(path string) (map[string]*LatencyHistogram, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	histograms, err := ParseLatencyHistograms(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return histograms, nil
+}
+
+// ParseLatencyHistograms reads latency histograms, keyed by operation name as in SetOpTimes. Each
+// line holds an operation, a latency and how many times it was measured, e.g. "read 2ms 40".
+// Blank lines and lines starting with # are ignored.
+func ParseLatencyHistograms(r io.Reader) (map[string]*LatencyHistogram, error) {
+	counts := make(map[string]map[time.Duration]uint64)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want operation, latency and count, got %q", lineNum, line)
+		}
+		latency, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		if latency < 0 {
+			return nil, fmt.Errorf("line %d: latency cannot be negative", lineNum)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+
+		op := strings.ToLower(fields[0])
+		if counts[op] == nil {
+			counts[op] = make(map[time.Duration]uint64)
+		}
+		counts[op][latency] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	histograms := make(map[string]*LatencyHistogram, len(counts))
+	for op, opCounts := range counts {
+		lh := &LatencyHistogram{}
+		for latency := range opCounts {
+			lh.latencies = append(lh.latencies, latency)
+		}
+		sort.Slice(lh.latencies, func(i, j int) bool { return lh.latencies[i] < lh.latencies[j] })
+		var total uint64
+		for _, latency := range lh.latencies {
+			total += opCounts[latency]
+			lh.cumulative = append(lh.cumulative, total)
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("%s: histogram is empty", op)
+		}
+		histograms[op] = lh
+	}
+	return histograms, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLatencyHistograms(t *testing.T) {
+	histograms, err := ParseLatencyHistograms(strings.NewReader(`
+# op latency count
+read 1ms 1
+read 10ms 2
+READ 1ms 1
+fsync 50ms 5
+`))
+	if err != nil {
+		t.Fatalf("ParseLatencyHistograms() error: %s", err)
+	}
+	if len(histograms) != 2 {
+		t.Fatalf("ParseLatencyHistograms() got %d histograms, want 2", len(histograms))
+	}
+
+	cases := []struct {
+		op   string
+		q    float64
+		want time.Duration
+	}{
+		{"read", 0, time.Millisecond},
+		{"read", 0.49, time.Millisecond},
+		{"read", 0.5, 10 * time.Millisecond},
+		{"read", 0.99, 10 * time.Millisecond},
+		{"fsync", 0, 50 * time.Millisecond},
+		{"fsync", 0.99, 50 * time.Millisecond},
+	}
+	for _, c := range cases {
+		if got := histograms[c.op].Sample(c.q); got != c.want {
+			t.Errorf("histograms[%s].Sample(%v) = %s, want %s", c.op, c.q, got, c.want)
+		}
+	}
+}
+
+func TestParseLatencyHistograms_Errors(t *testing.T) {
+	for _, in := range []string{
+		"read 1ms",
+		"read soon 1",
+		"read -1ms 1",
+		"read 1ms many",
+		"read 1ms 0",
+	} {
+		if _, err := ParseLatencyHistograms(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseLatencyHistograms(%q) = nil error, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"slowfs/slowfs/units"
+	"strings"
+	"time"
+)
+
+// SaneLimits bounds the config values which are plausible for a real device. Values outside them
+// are usually typos, and tend to make the mount look hung.
+type SaneLimits struct {
+	MinBytesPerSecond units.NumBytes
+	MaxSeekTime       time.Duration
+	MaxMetadataOpTime time.Duration
+}
+
+// DefaultSaneLimits are the limits used unless overridden.
+var DefaultSaneLimits = SaneLimits{
+	MinBytesPerSecond: 1 * units.Kilobyte,
+	MaxSeekTime:       10 * time.Second,
+	MaxMetadataOpTime: 1 * time.Second,
+}
+
+// Set overrides limits from a comma separated list of name=value pairs, for example
+// "min-bandwidth=1B,max-seek-time=1m,max-metadata-op-time=5s". Limits not listed are left alone.
+func (l *SaneLimits) Set(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		nameAndValue := strings.SplitN(entry, "=", 2)
+		if len(nameAndValue) != 2 {
+			return fmt.Errorf("want name=value, got %q", entry)
+		}
+		name := strings.ToLower(strings.TrimSpace(nameAndValue[0]))
+		value := strings.TrimSpace(nameAndValue[1])
+
+		var err error
+		switch name {
+		case "min-bandwidth":
+			l.MinBytesPerSecond, err = units.ParseNumBytesFromString(value)
+		case "max-seek-time":
+			l.MaxSeekTime, err = time.ParseDuration(value)
+		case "max-metadata-op-time":
+			l.MaxMetadataOpTime, err = time.ParseDuration(value)
+		default:
+			return fmt.Errorf("unknown limit %q, want one of max-metadata-op-time, max-seek-time, min-bandwidth", name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// CheckSane returns an error listing every value of dc outside limits, or nil if there are none.
+// Unlike Validate, values it complains about are possible, just unlikely to be intended.
+func (dc *DeviceConfig) CheckSane(limits SaneLimits) error {
+	var problems []string
+	for _, bw := range []struct {
+		name  string
+		value units.NumBytes
+	}{
+		{"ReadBytesPerSecond", dc.ReadBytesPerSecond},
+		{"WriteBytesPerSecond", dc.WriteBytesPerSecond},
+		{"AllocateBytesPerSecond", dc.AllocateBytesPerSecond},
+	} {
+		if bw.value < limits.MinBytesPerSecond {
+			problems = append(problems, fmt.Sprintf("%s %s is below %s", bw.name, bw.value, limits.MinBytesPerSecond))
+		}
+	}
+	if dc.SeekTime > limits.MaxSeekTime {
+		problems = append(problems, fmt.Sprintf("SeekTime %s is above %s", dc.SeekTime, limits.MaxSeekTime))
+	}
+	if dc.MetadataOpTime > limits.MaxMetadataOpTime {
+		problems = append(problems, fmt.Sprintf("MetadataOpTime %s is above %s", dc.MetadataOpTime, limits.MaxMetadataOpTime))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("config has extreme values: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
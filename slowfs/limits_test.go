@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestDeviceConfig_CheckSane(t *testing.T) {
+	sane := DeviceConfig{
+		SeekTime:               10 * time.Millisecond,
+		ReadBytesPerSecond:     100 * units.Mebibyte,
+		WriteBytesPerSecond:    100 * units.Mebibyte,
+		AllocateBytesPerSecond: 1 * units.Gibibyte,
+		MetadataOpTime:         1 * time.Millisecond,
+	}
+
+	slowRead := sane
+	slowRead.ReadBytesPerSecond = 1 * units.Byte
+	slowSeek := sane
+	slowSeek.SeekTime = time.Minute
+	slowMetadata := sane
+	slowMetadata.MetadataOpTime = 2 * time.Second
+
+	cases := []struct {
+		desc      string
+		dc        DeviceConfig
+		limits    SaneLimits
+		shouldErr bool
+	}{
+		{"sane", sane, DefaultSaneLimits, false},
+		{"slow read", slowRead, DefaultSaneLimits, true},
+		{"slow seek", slowSeek, DefaultSaneLimits, true},
+		{"slow metadata", slowMetadata, DefaultSaneLimits, true},
+		{"slow read with lowered limit", slowRead, SaneLimits{MinBytesPerSecond: 1 * units.Byte, MaxSeekTime: time.Second, MaxMetadataOpTime: time.Second}, false},
+	}
+
+	for _, c := range cases {
+		err := c.dc.CheckSane(c.limits)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("fail (%s) CheckSane() = %v, should error: %t", c.desc, err, c.shouldErr)
+		}
+	}
+
+	if err := HDD7200RpmDeviceConfig.CheckSane(DefaultSaneLimits); err != nil {
+		t.Errorf("HDD7200RpmDeviceConfig.CheckSane() = %s, want nil", err)
+	}
+}
+
+func TestSaneLimits_Set(t *testing.T) {
+	limits := DefaultSaneLimits
+	if err := limits.Set("min-bandwidth=1B, max-seek-time=1m"); err != nil {
+		t.Fatalf("Set() error: %s", err)
+	}
+	want := SaneLimits{
+		MinBytesPerSecond: 1 * units.Byte,
+		MaxSeekTime:       time.Minute,
+		MaxMetadataOpTime: DefaultSaneLimits.MaxMetadataOpTime,
+	}
+	if limits != want {
+		t.Errorf("limits after Set() = %+v, want %+v", limits, want)
+	}
+
+	for _, spec := range []string{"bandwidth=1B", "max-seek-time", "max-seek-time=soon"} {
+		if err := limits.Set(spec); err == nil {
+			t.Errorf("Set(%q) = nil, should error", spec)
+		}
+	}
+}
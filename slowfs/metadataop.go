@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metadataOps are the names requests give the metadata operations whose times MetadataOpTimes can
+// set, after the filesystem calls which make them.
+var metadataOps = map[string]struct{}{
+	"access":      {},
+	"chmod":       {},
+	"chown":       {},
+	"create":      {},
+	"getattr":     {},
+	"getxattr":    {},
+	"link":        {},
+	"listxattr":   {},
+	"mkdir":       {},
+	"mknod":       {},
+	"open":        {},
+	"opendir":     {},
+	"readlink":    {},
+	"removexattr": {},
+	"rename":      {},
+	"rmdir":       {},
+	"setxattr":    {},
+	"statfs":      {},
+	"symlink":     {},
+	"truncate":    {},
+	"unlink":      {},
+	"utimens":     {},
+}
+
+// MetadataOpTimeFor returns how long the metadata operation named op takes, before any time per
+// path component: its entry in MetadataOpTimes if it has one, and MetadataOpTime otherwise.
+func (dc *DeviceConfig) MetadataOpTimeFor(op string) time.Duration {
+	if d, ok := dc.MetadataOpTimes[op]; ok {
+		return d
+	}
+	return dc.MetadataOpTime
+}
+
+// validateMetadataOpTimes checks that metadataOpTimes only names known operations, and that none
+// of their times are negative.
+func validateMetadataOpTimes(metadataOpTimes map[string]time.Duration) error {
+	for op, d := range metadataOpTimes {
+		if _, ok := metadataOps[op]; !ok {
+			return fmt.Errorf("MetadataOpTimes: unknown operation %q.", op)
+		}
+		if d < 0 {
+			return errors.New("MetadataOpTimes cannot be negative.")
+		}
+	}
+	return nil
+}
+
+// parseMetadataOpTimes parses the MetadataOpTimes field of a device config, which is an object like
+// {"rename": "5ms", "unlink": "3ms"} mapping operation names to durations.
+func parseMetadataOpTimes(v interface{}) (map[string]time.Duration, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want object type, got %v", v)
+	}
+	metadataOpTimes := make(map[string]time.Duration, len(obj))
+	for op, d := range obj {
+		strVal, ok := d.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: want string type, got %v", op, d)
+		}
+		opTime, err := time.ParseDuration(strVal)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		metadataOpTimes[strings.ToLower(op)] = opTime
+	}
+	return metadataOpTimes, nil
+}
+
+// knownOpNames returns the names SetOpTimes accepts, sorted.
+func (dc *DeviceConfig) knownOpNames() []string {
+	known := make([]string, 0, len(metadataOps)+4)
+	for op := range dc.opTimes() {
+		known = append(known, op)
+	}
+	for op := range metadataOps {
+		known = append(known, op)
+	}
+	sort.Strings(known)
+	return known
+}
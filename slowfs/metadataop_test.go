@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeviceConfig_MetadataOpTimeFor(t *testing.T) {
+	dc := &DeviceConfig{
+		MetadataOpTime:  1 * time.Millisecond,
+		MetadataOpTimes: map[string]time.Duration{"rename": 20 * time.Millisecond, "getattr": 0},
+	}
+	cases := []struct {
+		op   string
+		want time.Duration
+	}{
+		{"rename", 20 * time.Millisecond},
+		{"getattr", 0},
+		{"chmod", 1 * time.Millisecond},
+		{"", 1 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		if got := dc.MetadataOpTimeFor(c.op); got != c.want {
+			t.Errorf("MetadataOpTimeFor(%q) = %s, want %s", c.op, got, c.want)
+		}
+	}
+}
+
+func TestDeviceConfig_MetadataOpTimes(t *testing.T) {
+	cases := []struct {
+		metadataOpTimes string
+		want            map[string]time.Duration
+		shouldErr       bool
+	}{
+		{
+			`{"rename": "20ms", "Unlink": "15ms"}`,
+			map[string]time.Duration{"rename": 20 * time.Millisecond, "unlink": 15 * time.Millisecond},
+			false,
+		},
+		{`{"seek": "20ms"}`, nil, true},
+		{`{"rename": "-1ms"}`, nil, true},
+		{`{"rename": "slow"}`, nil, true},
+		{`{"rename": 20}`, nil, true},
+		{`["rename"]`, nil, true},
+	}
+
+	for _, c := range cases {
+		configs, err := ParseDeviceConfigsFromJSON([]byte(`[{
+		  "Name": "differentiated",
+		  "SeekWindow": "4KiB",
+		  "SeekTime": "10ms",
+		  "ReadBytesPerSecond": "100MiB",
+		  "WriteBytesPerSecond": "100MiB",
+		  "AllocateBytesPerSecond": "100MiB",
+		  "RequestReorderMaxDelay": "100us",
+		  "FsyncStrategy": "wbc",
+		  "WriteStrategy": "fastwrite",
+		  "MetadataOpTime": "1ms",
+		  "MetadataOpTimes": ` + c.metadataOpTimes + `
+		}]`))
+		if err == nil {
+			err = configs[0].Validate()
+		}
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("MetadataOpTimes %s: got a valid config, want an error", c.metadataOpTimes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MetadataOpTimes %s: error: %s", c.metadataOpTimes, err)
+		} else if got := configs[0].MetadataOpTimes; !reflect.DeepEqual(got, c.want) {
+			t.Errorf("MetadataOpTimes %s: got %v, want %v", c.metadataOpTimes, got, c.want)
+		}
+	}
+}
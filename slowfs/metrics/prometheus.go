@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slowfs/slowfs/scheduler"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes stats to w in the Prometheus text exposition format, with labels added
+// to every metric. Metrics per request type are labelled with the type, as used in stats.Ops.
+func WritePrometheus(w io.Writer, labels map[string]string, stats scheduler.Stats) error {
+	var buf bytes.Buffer
+	header := func(name, kind, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	sample := func(name string, extra []string, value string) {
+		fmt.Fprintf(&buf, "%s%s %s\n", name, prometheusLabels(labels, extra...), value)
+	}
+
+	header("slowfs_read_bytes_total", "counter", "Bytes read through the mount.")
+	sample("slowfs_read_bytes_total", nil, strconv.FormatInt(int64(stats.BytesRead), 10))
+	header("slowfs_written_bytes_total", "counter", "Bytes written through the mount.")
+	sample("slowfs_written_bytes_total", nil, strconv.FormatInt(int64(stats.BytesWritten), 10))
+	header("slowfs_dirty_bytes", "gauge", "Bytes in the modeled write back cache.")
+	sample("slowfs_dirty_bytes", nil, strconv.FormatInt(int64(stats.DirtyBytes), 10))
+
+	names := sortedKeys(stats.Ops)
+	header("slowfs_ops_total", "counter", "Operations served, by request type.")
+	for _, name := range names {
+		sample("slowfs_ops_total", []string{"type", name}, strconv.FormatUint(stats.Ops[name], 10))
+	}
+
+	header("slowfs_op_duration_seconds", "histogram", "Modeled time operations took, by request type.")
+	for _, name := range names {
+		h := stats.Durations[name]
+		var cumulative uint64
+		for i, bound := range scheduler.DurationBuckets {
+			if i < len(h.Buckets) {
+				cumulative += h.Buckets[i]
+			}
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			sample("slowfs_op_duration_seconds_bucket", []string{"type", name, "le", le}, strconv.FormatUint(cumulative, 10))
+		}
+		sample("slowfs_op_duration_seconds_bucket", []string{"type", name, "le", "+Inf"}, strconv.FormatUint(h.Count, 10))
+		sample("slowfs_op_duration_seconds_sum", []string{"type", name}, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+		sample("slowfs_op_duration_seconds_count", []string{"type", name}, strconv.FormatUint(h.Count, 10))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// prometheusLabels returns the label set for a sample, made of labels followed by extra name and
+// value pairs, or "" if there are none.
+func prometheusLabels(labels map[string]string, extra ...string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys)+len(extra)/2)
+	for _, k := range keys {
+		pairs = append(pairs, k+`="`+escapeLabelValue(labels[k])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabelValue(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes the backslashes, double quotes and newlines in a Prometheus label value.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// PrometheusHandler serves the current Stats of s, with labels added to every metric, for
+// Prometheus to scrape.
+func PrometheusHandler(labels map[string]string, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := WritePrometheus(w, labels, s.Stats()); err != nil {
+			log.Printf("prometheus: %s", err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	buckets := make([]uint64, len(scheduler.DurationBuckets))
+	buckets[3] = 1 // 1ms
+	buckets[5] = 2 // 5ms
+	stats := scheduler.Stats{
+		Ops:          map[string]uint64{"read": 4},
+		BytesRead:    300,
+		BytesWritten: 20,
+		Durations: map[string]scheduler.DurationHistogram{
+			"read": {Buckets: buckets, Count: 4, Sum: 20 * time.Second},
+		},
+		DirtyBytes: 10,
+	}
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, map[string]string{"instance": "a"}, stats); err != nil {
+		t.Fatalf("WritePrometheus() error: %s", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"# TYPE slowfs_read_bytes_total counter\n",
+		"slowfs_read_bytes_total{instance=\"a\"} 300\n",
+		"slowfs_written_bytes_total{instance=\"a\"} 20\n",
+		"slowfs_dirty_bytes{instance=\"a\"} 10\n",
+		"slowfs_ops_total{instance=\"a\",type=\"read\"} 4\n",
+		"# TYPE slowfs_op_duration_seconds histogram\n",
+		"slowfs_op_duration_seconds_bucket{instance=\"a\",type=\"read\",le=\"0.0005\"} 0\n",
+		"slowfs_op_duration_seconds_bucket{instance=\"a\",type=\"read\",le=\"0.001\"} 1\n",
+		"slowfs_op_duration_seconds_bucket{instance=\"a\",type=\"read\",le=\"0.005\"} 3\n",
+		"slowfs_op_duration_seconds_bucket{instance=\"a\",type=\"read\",le=\"10\"} 3\n",
+		"slowfs_op_duration_seconds_bucket{instance=\"a\",type=\"read\",le=\"+Inf\"} 4\n",
+		"slowfs_op_duration_seconds_sum{instance=\"a\",type=\"read\"} 20\n",
+		"slowfs_op_duration_seconds_count{instance=\"a\",type=\"read\"} 4\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WritePrometheus() wrote:\n%s\nmissing %q", got, want)
+		}
+	}
+}
+
+func TestWritePrometheus_EscapesLabels(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, map[string]string{"path": `a\"b`}, scheduler.Stats{}); err != nil {
+		t.Fatalf("WritePrometheus() error: %s", err)
+	}
+	if want := `slowfs_read_bytes_total{path="a\\\"b"} 0`; !strings.Contains(buf.String(), want) {
+		t.Errorf("WritePrometheus() wrote:\n%s\nmissing %q", buf.String(), want)
+	}
+}
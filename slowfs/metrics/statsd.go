@@ -0,0 +1,134 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports the scheduler's Stats to external monitoring systems.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slowfs/slowfs/scheduler"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteStatsD writes stats to w as StatsD gauges with names starting with prefix, and tagged with
+// labels in the DogStatsD format if there are any. Each request type's metrics are written with a
+// separate call to w, so that when w is a UDP connection no datagram gets too large. Counters are
+// sent as gauges of their running total, so a lost packet doesn't skew them.
+func WriteStatsD(w io.Writer, prefix string, labels map[string]string, stats scheduler.Stats) error {
+	tags := dogStatsDTags(labels)
+	var buf bytes.Buffer
+	gauge := func(name string, value int64) {
+		fmt.Fprintf(&buf, "%s.%s:%d|g%s\n", prefix, name, value, tags)
+	}
+	flush := func() error {
+		_, err := w.Write(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+
+	gauge("bytes_read", int64(stats.BytesRead))
+	gauge("bytes_written", int64(stats.BytesWritten))
+	gauge("dirty_bytes", int64(stats.DirtyBytes))
+	if err := flush(); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(stats.Ops) {
+		gauge("ops."+name, int64(stats.Ops[name]))
+		latency := stats.Latency[name]
+		gauge("latency_ms."+name+".p50", latency.P50.Milliseconds())
+		gauge("latency_ms."+name+".p90", latency.P90.Milliseconds())
+		gauge("latency_ms."+name+".p99", latency.P99.Milliseconds())
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dogStatsDTags returns the suffix tagging a metric with labels, or "" if there are none.
+func dogStatsDTags(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]string, len(keys))
+	for i, k := range keys {
+		tags[i] = k + ":" + labels[k]
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// StatsDEmitter periodically sends a scheduler's Stats to a StatsD server over UDP.
+type StatsDEmitter struct {
+	conn   net.Conn
+	prefix string
+	labels map[string]string
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// NewStatsDEmitter starts sending the Stats of s, tagged with labels, to the StatsD server at addr
+// (host:port) every interval, until Close is called.
+func NewStatsDEmitter(addr, prefix string, labels map[string]string, interval time.Duration, s *scheduler.Scheduler) (*StatsDEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &StatsDEmitter{
+		conn:   conn,
+		prefix: prefix,
+		labels: labels,
+		ticker: time.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-e.ticker.C:
+				if err := WriteStatsD(e.conn, e.prefix, e.labels, s.Stats()); err != nil {
+					log.Printf("statsd: %s", err)
+				}
+			case <-e.done:
+				return
+			}
+		}
+	}()
+	return e, nil
+}
+
+// Close stops sending stats.
+func (e *StatsDEmitter) Close() error {
+	e.ticker.Stop()
+	close(e.done)
+	return e.conn.Close()
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"slowfs/slowfs/scheduler"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStatsD(t *testing.T) {
+	stats := scheduler.Stats{
+		Ops:          map[string]uint64{"write": 2, "read": 3},
+		BytesRead:    300,
+		BytesWritten: 20,
+		Latency: map[string]scheduler.LatencyPercentiles{
+			"read":  {P50: time.Millisecond, P90: 2 * time.Millisecond, P99: 3 * time.Millisecond},
+			"write": {P50: 4 * time.Millisecond, P90: 5 * time.Millisecond, P99: 6 * time.Millisecond},
+		},
+		DirtyBytes: 10,
+	}
+
+	var buf bytes.Buffer
+	if err := WriteStatsD(&buf, "slowfs", nil, stats); err != nil {
+		t.Fatalf("WriteStatsD() error: %s", err)
+	}
+	want := `slowfs.bytes_read:300|g
+slowfs.bytes_written:20|g
+slowfs.dirty_bytes:10|g
+slowfs.ops.read:3|g
+slowfs.latency_ms.read.p50:1|g
+slowfs.latency_ms.read.p90:2|g
+slowfs.latency_ms.read.p99:3|g
+slowfs.ops.write:2|g
+slowfs.latency_ms.write.p50:4|g
+slowfs.latency_ms.write.p90:5|g
+slowfs.latency_ms.write.p99:6|g
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteStatsD() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteStatsD_Labels(t *testing.T) {
+	stats := scheduler.Stats{Ops: map[string]uint64{"read": 1}}
+
+	var buf bytes.Buffer
+	labels := map[string]string{"instance": "a", "disk": "hdd"}
+	if err := WriteStatsD(&buf, "slowfs", labels, stats); err != nil {
+		t.Fatalf("WriteStatsD() error: %s", err)
+	}
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	if want := "slowfs.bytes_read:0|g|#disk:hdd,instance:a"; line != want {
+		t.Errorf("WriteStatsD() first line = %q, want %q", line, want)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PathHasPrefix returns whether p, a path relative to the mount point, is prefix or is under it.
+// Whole path components are compared, so "fast" is a prefix of "fast/a" but not of "faster", and
+// leading and trailing slashes are ignored.
+func PathHasPrefix(p, prefix string) bool {
+	p = strings.Trim(p, "/")
+	prefix = strings.Trim(prefix, "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// validatePathConfigs checks that every prefix in pathConfigs names a directory and maps to a
+// config name.
+func validatePathConfigs(pathConfigs map[string]string) error {
+	for prefix, name := range pathConfigs {
+		if strings.Trim(prefix, "/") == "" {
+			return fmt.Errorf("path config %q: prefix cannot be empty.", prefix)
+		}
+		if name == "" {
+			return fmt.Errorf("path config %q: config name cannot be empty.", prefix)
+		}
+	}
+	return nil
+}
+
+// parsePathConfigs parses the PathConfigs field of a device config, which is an object like
+// {"fast": "ssd", "slow": "hdd7200rpm"} mapping path prefixes to config names.
+func parsePathConfigs(v interface{}) (map[string]string, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want object type, got %v", v)
+	}
+	pathConfigs := make(map[string]string, len(obj))
+	for prefix, name := range obj {
+		strVal, ok := name.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: want string type, got %v", prefix, name)
+		}
+		pathConfigs[prefix] = strVal
+	}
+	return pathConfigs, nil
+}
+
+// ParsePathConfigFromString parses a path config like "fast=ssd", returning the path prefix and
+// the name of the config to use under it.
+func ParsePathConfigFromString(spec string) (prefix, name string, err error) {
+	prefixAndName := strings.SplitN(spec, "=", 2)
+	if len(prefixAndName) != 2 {
+		return "", "", fmt.Errorf("want prefix=config-name, got %q", spec)
+	}
+	prefix = strings.TrimSpace(prefixAndName[0])
+	name = strings.TrimSpace(prefixAndName[1])
+	if strings.Trim(prefix, "/") == "" || name == "" {
+		return "", "", errors.New("path config needs both a prefix and a config name")
+	}
+	return prefix, name, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathHasPrefix(t *testing.T) {
+	cases := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"fast/a", "fast", true},
+		{"/fast/a/b", "fast/", true},
+		{"fast", "/fast", true},
+		{"faster/a", "fast", false},
+		{"slow/fast/a", "fast", false},
+		{"fast/a", "fast/a/b", false},
+	}
+
+	for _, c := range cases {
+		if got := PathHasPrefix(c.path, c.prefix); got != c.want {
+			t.Errorf("PathHasPrefix(%q, %q) = %v, want %v", c.path, c.prefix, got, c.want)
+		}
+	}
+}
+
+func TestParsePathConfigFromString(t *testing.T) {
+	cases := []struct {
+		spec         string
+		prefix, name string
+		shouldErr    bool
+	}{
+		{"fast=ssd", "fast", "ssd", false},
+		{" /slow/ = hdd7200rpm ", "/slow/", "hdd7200rpm", false},
+		{"fast", "", "", true},
+		{"/=ssd", "", "", true},
+		{"fast=", "", "", true},
+	}
+
+	for _, c := range cases {
+		prefix, name, err := ParsePathConfigFromString(c.spec)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("ParsePathConfigFromString(%q) = %q, %q, should error", c.spec, prefix, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePathConfigFromString(%q) error: %s", c.spec, err)
+		} else if prefix != c.prefix || name != c.name {
+			t.Errorf("ParsePathConfigFromString(%q) = %q, %q, want %q, %q", c.spec, prefix, name, c.prefix, c.name)
+		}
+	}
+}
+
+func TestParseDeviceConfigsFromJSON_PathConfigs(t *testing.T) {
+	configs, err := ParseDeviceConfigsFromJSON([]byte(`[{
+	  "Name": "tiered",
+	  "SeekWindow": "4KiB",
+	  "SeekTime": "10ms",
+	  "ReadBytesPerSecond": "100MiB",
+	  "WriteBytesPerSecond": "100MiB",
+	  "AllocateBytesPerSecond": "100MiB",
+	  "RequestReorderMaxDelay": "100us",
+	  "FsyncStrategy": "wbc",
+	  "WriteStrategy": "fastwrite",
+	  "MetadataOpTime": "1ms",
+	  "PathConfigs": {"fast": "ssd", "slow/": "hdd7200rpm"}
+	}]`))
+	if err != nil {
+		t.Fatalf("ParseDeviceConfigsFromJSON error: %s", err)
+	}
+	want := map[string]string{"fast": "ssd", "slow/": "hdd7200rpm"}
+	if got := configs[0].PathConfigs; !reflect.DeepEqual(got, want) {
+		t.Errorf("PathConfigs = %v, want %v", got, want)
+	}
+}
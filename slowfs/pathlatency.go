@@ -0,0 +1,157 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PathLatency pins how long operations on matching paths take, for example making every read of
+// data/index.db take 50ms, to reproduce a single pathological file. Operations are named as in
+// SetOpTimes.
+type PathLatency struct {
+	// Pattern is a path relative to the mount point, or a glob as accepted by path.Match. A
+	// leading / is ignored.
+	Pattern string
+
+	// Latency maps operation names to how long the device spends on them for matching paths,
+	// in place of the modeled time.
+	Latency map[string]time.Duration
+}
+
+func (pl PathLatency) String() string {
+	latencies := make([]string, 0, len(pl.Latency))
+	for op, d := range pl.Latency {
+		latencies = append(latencies, fmt.Sprintf("%s=%s", op, d))
+	}
+	sort.Strings(latencies)
+	return fmt.Sprintf("%s: %s", pl.Pattern, strings.Join(latencies, ","))
+}
+
+// Matches returns whether p, a path relative to the mount point, matches pl's pattern.
+func (pl PathLatency) Matches(p string) bool {
+	matched, err := path.Match(strings.TrimPrefix(pl.Pattern, "/"), strings.TrimPrefix(p, "/"))
+	return err == nil && matched
+}
+
+// validate checks that pl's pattern is well formed, and that it only refers to operations in
+// knownOps.
+func (pl PathLatency) validate(knownOps map[string]*time.Duration) error {
+	if _, err := path.Match(pl.Pattern, ""); err != nil {
+		return fmt.Errorf("path latency %s: bad pattern", pl)
+	}
+	if len(pl.Latency) == 0 {
+		return fmt.Errorf("path latency %s: no latencies", pl)
+	}
+	for op, d := range pl.Latency {
+		if _, ok := knownOps[op]; !ok {
+			return fmt.Errorf("path latency %s: unknown operation %q", pl, op)
+		}
+		if d < 0 {
+			return errors.New("path latencies cannot be negative.")
+		}
+	}
+	return nil
+}
+
+// parsePathLatencies parses the PathLatencies field of a device config, which is an array of
+// objects like {"Pattern": "data/index.db", "Latency": {"read": "50ms"}}.
+func parsePathLatencies(v interface{}) ([]PathLatency, error) {
+	objs, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want array type, got %v", v)
+	}
+
+	pathLatencies := make([]PathLatency, 0, len(objs))
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("want object type, got %v", o)
+		}
+
+		pl := PathLatency{Latency: make(map[string]time.Duration)}
+		for k, v := range obj {
+			var err error
+			switch k {
+			case "Pattern":
+				strVal, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: want string type, got %v", k, v)
+				}
+				pl.Pattern = strVal
+			case "Latency":
+				latencies, ok := v.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: want object type, got %v", k, v)
+				}
+				for op, d := range latencies {
+					strVal, ok := d.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: %s: want string type, got %v", k, op, d)
+					}
+					pl.Latency[strings.ToLower(op)], err = time.ParseDuration(strVal)
+					if err != nil {
+						break
+					}
+				}
+			default:
+				return nil, fmt.Errorf("spurious path latency field %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		if pl.Pattern == "" {
+			return nil, errors.New("path latency missing Pattern")
+		}
+		pathLatencies = append(pathLatencies, pl)
+	}
+	return pathLatencies, nil
+}
+
+// ParsePathLatencyFromString parses a path latency from a comma separated list like
+// "path=data/index.db,read=50ms". Every key other than path names an operation whose latency is
+// pinned.
+func ParsePathLatencyFromString(spec string) (PathLatency, error) {
+	pl := PathLatency{Latency: make(map[string]time.Duration)}
+	for _, entry := range strings.Split(spec, ",") {
+		keyAndValue := strings.SplitN(entry, "=", 2)
+		if len(keyAndValue) != 2 {
+			return PathLatency{}, fmt.Errorf("want key=value, got %q", entry)
+		}
+		key := strings.ToLower(strings.TrimSpace(keyAndValue[0]))
+		value := strings.TrimSpace(keyAndValue[1])
+
+		var err error
+		switch key {
+		case "path":
+			pl.Pattern = value
+		default:
+			pl.Latency[key], err = time.ParseDuration(value)
+		}
+		if err != nil {
+			return PathLatency{}, fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	if pl.Pattern == "" {
+		return PathLatency{}, errors.New("path latency missing path")
+	}
+	return pl, nil
+}
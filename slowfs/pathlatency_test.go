@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePathLatencyFromString(t *testing.T) {
+	cases := []struct {
+		spec      string
+		want      PathLatency
+		shouldErr bool
+	}{
+		{
+			"path=data/index.db,read=50ms",
+			PathLatency{
+				Pattern: "data/index.db",
+				Latency: map[string]time.Duration{"read": 50 * time.Millisecond},
+			},
+			false,
+		},
+		{
+			" PATH = /logs/* , Write=1ms, metadata=2ms",
+			PathLatency{
+				Pattern: "/logs/*",
+				Latency: map[string]time.Duration{
+					"write":    1 * time.Millisecond,
+					"metadata": 2 * time.Millisecond,
+				},
+			},
+			false,
+		},
+		{"read=50ms", PathLatency{}, true},
+		{"path=a,read=soon", PathLatency{}, true},
+		{"path=a,read", PathLatency{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePathLatencyFromString(c.spec)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("ParsePathLatencyFromString(%q) = %v, should error", c.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePathLatencyFromString(%q) error: %s", c.spec, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParsePathLatencyFromString(%q) = %v, want %v", c.spec, got, c.want)
+		}
+	}
+}
+
+func TestDeviceConfig_PathLatency(t *testing.T) {
+	dc := DeviceConfig{PathLatencies: []PathLatency{
+		{Pattern: "/data/index.db", Latency: map[string]time.Duration{"read": 50 * time.Millisecond}},
+		{Pattern: "data/*", Latency: map[string]time.Duration{"read": 5 * time.Millisecond, "write": 10 * time.Millisecond}},
+	}}
+
+	cases := []struct {
+		path   string
+		op     string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"data/index.db", "read", 50 * time.Millisecond, true},
+		{"data/index.db", "write", 10 * time.Millisecond, true},
+		{"data/other", "read", 5 * time.Millisecond, true},
+		{"data/other", "fsync", 0, false},
+		{"data/sub/file", "read", 0, false},
+		{"index.db", "read", 0, false},
+	}
+
+	for _, c := range cases {
+		got, ok := dc.PathLatency(c.path, c.op)
+		if got != c.want || ok != c.wantOk {
+			t.Errorf("PathLatency(%s, %s) = %s, %v, want %s, %v", c.path, c.op, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+func TestParseDeviceConfigsFromJSON_PathLatencies(t *testing.T) {
+	configs, err := ParseDeviceConfigsFromJSON([]byte(`[{
+	  "Name": "hotspot",
+	  "SeekWindow": "4KiB",
+	  "SeekTime": "10ms",
+	  "ReadBytesPerSecond": "100MiB",
+	  "WriteBytesPerSecond": "100MiB",
+	  "AllocateBytesPerSecond": "100MiB",
+	  "RequestReorderMaxDelay": "100us",
+	  "FsyncStrategy": "wbc",
+	  "WriteStrategy": "fastwrite",
+	  "MetadataOpTime": "1ms",
+	  "PathLatencies": [{"Pattern": "data/index.db", "Latency": {"Read": "50ms"}}]
+	}]`))
+	if err != nil {
+		t.Fatalf("ParseDeviceConfigsFromJSON error: %s", err)
+	}
+	want := []PathLatency{{
+		Pattern: "data/index.db",
+		Latency: map[string]time.Duration{"read": 50 * time.Millisecond},
+	}}
+	if got := configs[0].PathLatencies; !reflect.DeepEqual(got, want) {
+		t.Errorf("PathLatencies = %v, want %v", got, want)
+	}
+}
+
+func TestPathLatency_Validate(t *testing.T) {
+	knownOps := (&DeviceConfig{}).opTimes()
+	cases := []struct {
+		pl        PathLatency
+		shouldErr bool
+	}{
+		{PathLatency{Pattern: "data/*", Latency: map[string]time.Duration{"read": time.Millisecond}}, false},
+		{PathLatency{Pattern: "data/[", Latency: map[string]time.Duration{"read": time.Millisecond}}, true},
+		{PathLatency{Pattern: "data/*", Latency: map[string]time.Duration{}}, true},
+		{PathLatency{Pattern: "data/*", Latency: map[string]time.Duration{"rename": time.Millisecond}}, true},
+		{PathLatency{Pattern: "data/*", Latency: map[string]time.Duration{"read": -1}}, true},
+	}
+
+	for _, c := range cases {
+		if err := c.pl.validate(knownOps); c.shouldErr != (err != nil) {
+			t.Errorf("validate(%s) = %v, should error: %v", c.pl, err, c.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Tracer records requests as the scheduler executes them.
+type Tracer interface {
+	// Trace records that req took opTime, failing with err if it is non-nil.
+	Trace(req *Request, opTime time.Duration, err error)
+	// Close flushes anything buffered.
+	Close() error
+}
+
+// chromeTraceEvent is a single event in the Chrome trace event format, as understood by
+// chrome://tracing and Perfetto.
+type chromeTraceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur,omitempty"`
+	Pid       int                    `json:"pid"`
+	Tid       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTraceWriter is a Tracer which writes the modeled timeline as Chrome trace event JSON.
+// Each request becomes a complete event lasting from when it was issued until it finished, and
+// each path gets its own track so the timeline is grouped by file.
+type ChromeTraceWriter struct {
+	w      *bufio.Writer
+	c      io.Closer
+	origin time.Time
+	tids   map[string]int
+	err    error
+}
+
+// NewChromeTraceWriter creates a ChromeTraceWriter writing to w. If w is an io.Closer it is closed
+// by Close.
+func NewChromeTraceWriter(w io.Writer) *ChromeTraceWriter {
+	ctw := &ChromeTraceWriter{
+		w:    bufio.NewWriter(w),
+		tids: make(map[string]int),
+	}
+	ctw.c, _ = w.(io.Closer)
+	return ctw
+}
+
+// Trace records req as a complete event. Timestamps are relative to the first traced request.
+func (ctw *ChromeTraceWriter) Trace(req *Request, opTime time.Duration, err error) {
+	if ctw.origin.IsZero() {
+		ctw.origin = req.Timestamp
+	}
+
+	tid, ok := ctw.tids[req.Path]
+	if !ok {
+		tid = len(ctw.tids) + 1
+		ctw.tids[req.Path] = tid
+		name := req.Path
+		if name == "" {
+			name = "(no path)"
+		}
+		ctw.writeEvent(&chromeTraceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			Pid:   1,
+			Tid:   tid,
+			Args:  map[string]interface{}{"name": name},
+		})
+	}
+
+	args := map[string]interface{}{
+		"path":   req.Path,
+		"offset": int64(req.Start),
+		"size":   int64(req.Size),
+	}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	ctw.writeEvent(&chromeTraceEvent{
+		Name:      req.Type.String(),
+		Category:  "slowfs",
+		Phase:     "X",
+		Timestamp: microseconds(req.Timestamp.Sub(ctw.origin)),
+		Duration:  microseconds(opTime),
+		Pid:       1,
+		Tid:       tid,
+		Args:      args,
+	})
+}
+
+// Close terminates the JSON array and flushes it, returning the first error encountered while
+// writing the trace.
+func (ctw *ChromeTraceWriter) Close() error {
+	if len(ctw.tids) == 0 {
+		ctw.write([]byte("["))
+	}
+	ctw.write([]byte("]\n"))
+	if err := ctw.w.Flush(); ctw.err == nil {
+		ctw.err = err
+	}
+	if ctw.c != nil {
+		if err := ctw.c.Close(); ctw.err == nil {
+			ctw.err = err
+		}
+	}
+	return ctw.err
+}
+
+func (ctw *ChromeTraceWriter) writeEvent(event *chromeTraceEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		if ctw.err == nil {
+			ctw.err = err
+		}
+		return
+	}
+	if len(ctw.tids) == 1 && event.Phase == "M" {
+		ctw.write([]byte("[\n"))
+	} else {
+		ctw.write([]byte(",\n"))
+	}
+	ctw.write(data)
+}
+
+func (ctw *ChromeTraceWriter) write(data []byte) {
+	if _, err := ctw.w.Write(data); err != nil && ctw.err == nil {
+		ctw.err = err
+	}
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
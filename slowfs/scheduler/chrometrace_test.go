@@ -0,0 +1,113 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestChromeTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	ctw := NewChromeTraceWriter(&buf)
+
+	ctw.Trace(&Request{
+		Type:      OpenRequest,
+		Timestamp: startTime.Add(1 * time.Millisecond),
+		Path:      "a",
+	}, 10*time.Millisecond, nil)
+	ctw.Trace(&Request{
+		Type:      ReadRequest,
+		Timestamp: startTime.Add(11 * time.Millisecond),
+		Path:      "b",
+		Start:     100,
+		Size:      200,
+	}, 2500*time.Microsecond, syscall.EIO)
+	ctw.Trace(&Request{
+		Type:      CloseRequest,
+		Timestamp: startTime.Add(14 * time.Millisecond),
+		Path:      "a",
+	}, 10*time.Millisecond, nil)
+	if err := ctw.Close(); err != nil {
+		t.Fatalf("Close() = %s, want nil", err)
+	}
+
+	var events []chromeTraceEvent
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("couldn't parse trace %q: %s", buf.String(), err)
+	}
+
+	expected := []chromeTraceEvent{
+		{Name: "thread_name", Phase: "M", Pid: 1, Tid: 1, Args: map[string]interface{}{"name": "a"}},
+		{Name: "OPEN", Category: "slowfs", Phase: "X", Timestamp: 0, Duration: 10000, Pid: 1, Tid: 1,
+			Args: map[string]interface{}{"path": "a", "offset": 0.0, "size": 0.0}},
+		{Name: "thread_name", Phase: "M", Pid: 1, Tid: 2, Args: map[string]interface{}{"name": "b"}},
+		{Name: "READ", Category: "slowfs", Phase: "X", Timestamp: 10000, Duration: 2500, Pid: 1, Tid: 2,
+			Args: map[string]interface{}{"path": "b", "offset": 100.0, "size": 200.0, "error": "input/output error"}},
+		{Name: "CLOSE", Category: "slowfs", Phase: "X", Timestamp: 13000, Duration: 10000, Pid: 1, Tid: 1,
+			Args: map[string]interface{}{"path": "a", "offset": 0.0, "size": 0.0}},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("trace = %+v, want %+v", events, expected)
+	}
+}
+
+func TestChromeTraceWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	ctw := NewChromeTraceWriter(&buf)
+	if err := ctw.Close(); err != nil {
+		t.Fatalf("Close() = %s, want nil", err)
+	}
+
+	var events []chromeTraceEvent
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("couldn't parse trace %q: %s", buf.String(), err)
+	}
+	if len(events) != 0 {
+		t.Errorf("trace = %+v, want no events", events)
+	}
+}
+
+// recordingTracer remembers the types of the requests it sees.
+type recordingTracer struct {
+	types []RequestType
+}
+
+func (rt *recordingTracer) Trace(req *Request, opTime time.Duration, err error) {
+	rt.types = append(rt.types, req.Type)
+}
+
+func (rt *recordingTracer) Close() error {
+	return nil
+}
+
+func TestScheduler_SetTracer(t *testing.T) {
+	s := New(basicDeviceConfig)
+	rt := &recordingTracer{}
+	s.SetTracer(rt)
+
+	s.Schedule(&Request{Type: MetadataRequest, Timestamp: time.Now(), Path: "a"})
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "a", Size: 10})
+	s.SetTracer(nil)
+	s.Schedule(&Request{Type: CloseRequest, Timestamp: time.Now(), Path: "a"})
+
+	if got, want := rt.types, []RequestType{MetadataRequest, WriteRequest}; !reflect.DeepEqual(got, want) {
+		t.Errorf("traced %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvTraceHeader names the columns of a CSV trace.
+var csvTraceHeader = []string{"time", "type", "path", "offset", "size", "delay_ns", "seek", "error", "op", "direct"}
+
+// CSVTraceWriter is a Tracer which writes one CSV row per request, giving a complete audit trail of
+// what the scheduler did. Rows are buffered until Close.
+type CSVTraceWriter struct {
+	w   *csv.Writer
+	c   io.Closer
+	err error
+}
+
+// NewCSVTraceWriter creates a CSVTraceWriter writing to w, starting with a header row. If w is an
+// io.Closer it is closed by Close.
+func NewCSVTraceWriter(w io.Writer) *CSVTraceWriter {
+	ctw := &CSVTraceWriter{w: csv.NewWriter(w)}
+	ctw.c, _ = w.(io.Closer)
+	ctw.write(csvTraceHeader)
+	return ctw
+}
+
+// Trace writes a row for req, recording when it was issued, what it was, how long it took and
+// whether it was charged a seek. The op column names the operation which made a metadata request,
+// so that replaying it uses the same MetadataOpTimes entry, and the direct column whether a write
+// bypassed the write back cache.
+func (ctw *CSVTraceWriter) Trace(req *Request, opTime time.Duration, err error) {
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	ctw.write([]string{
+		req.Timestamp.Format(time.RFC3339Nano),
+		req.Type.String(),
+		req.Path,
+		strconv.FormatInt(int64(req.Start), 10),
+		strconv.FormatInt(int64(req.Size), 10),
+		strconv.FormatInt(int64(opTime), 10),
+		strconv.FormatBool(req.chargedSeek),
+		errStr,
+		req.Op,
+		strconv.FormatBool(req.Direct),
+	})
+}
+
+// Close flushes the buffered rows, returning the first error encountered while writing the trace.
+func (ctw *CSVTraceWriter) Close() error {
+	ctw.w.Flush()
+	if err := ctw.w.Error(); ctw.err == nil {
+		ctw.err = err
+	}
+	if ctw.c != nil {
+		if err := ctw.c.Close(); ctw.err == nil {
+			ctw.err = err
+		}
+	}
+	return ctw.err
+}
+
+func (ctw *CSVTraceWriter) write(record []string) {
+	if err := ctw.w.Write(record); err != nil && ctw.err == nil {
+		ctw.err = err
+	}
+}
+
+// MultiTracer returns a Tracer which passes every request on to each of tracers in turn.
+func MultiTracer(tracers ...Tracer) Tracer {
+	return multiTracer(tracers)
+}
+
+type multiTracer []Tracer
+
+func (mt multiTracer) Trace(req *Request, opTime time.Duration, err error) {
+	for _, t := range mt {
+		t.Trace(req, opTime, err)
+	}
+}
+
+// Close closes every tracer, returning the first error.
+func (mt multiTracer) Close() error {
+	var firstErr error
+	for _, t := range mt {
+		if err := t.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCSVTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	ctw := NewCSVTraceWriter(&buf)
+
+	ctw.Trace(&Request{
+		Type:      OpenRequest,
+		Op:        "open",
+		Timestamp: startTime.Add(1 * time.Millisecond),
+		Path:      "a",
+	}, 10*time.Millisecond, nil)
+	ctw.Trace(&Request{
+		Type:        ReadRequest,
+		Timestamp:   startTime.Add(11 * time.Millisecond),
+		Path:        "b",
+		Start:       100,
+		Size:        200,
+		Direct:      true,
+		chargedSeek: true,
+	}, 2500*time.Microsecond, syscall.EIO)
+	if buf.Len() != 0 {
+		t.Errorf("trace written before Close: %q", buf.String())
+	}
+	if err := ctw.Close(); err != nil {
+		t.Fatalf("Close() = %s, want nil", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("couldn't parse trace %q: %s", buf.String(), err)
+	}
+	expected := [][]string{
+		csvTraceHeader,
+		{startTime.Add(1 * time.Millisecond).Format(time.RFC3339Nano), "OPEN", "a", "0", "0", "10000000", "false", "", "open", "false"},
+		{startTime.Add(11 * time.Millisecond).Format(time.RFC3339Nano), "READ", "b", "100", "200", "2500000", "true", "input/output error", "", "true"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("trace = %q, want %q", rows, expected)
+	}
+}
+
+func TestScheduler_CSVTrace(t *testing.T) {
+	s := New(basicDeviceConfig)
+	var buf bytes.Buffer
+	ctw := NewCSVTraceWriter(&buf)
+	s.SetTracer(ctw)
+
+	s.Schedule(&Request{Type: ReadRequest, Timestamp: time.Now(), Path: "a", Start: 0, Size: 10})
+	s.Schedule(&Request{Type: ReadRequest, Timestamp: time.Now(), Path: "a", Start: 10, Size: 10})
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "a", Start: 100, Size: 10})
+	s.Schedule(&Request{Type: FsyncRequest, Timestamp: time.Now(), Path: "a"})
+	s.SetTracer(nil)
+	if err := ctw.Close(); err != nil {
+		t.Fatalf("Close() = %s, want nil", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("couldn't parse trace %q: %s", buf.String(), err)
+	}
+	// Leave out the time and delay columns, which depend on the wall clock.
+	var got [][]string
+	for _, row := range rows[1:] {
+		got = append(got, []string{row[1], row[2], row[3], row[4], row[6]})
+	}
+	expected := [][]string{
+		{"READ", "a", "0", "10", "true"},
+		{"READ", "a", "10", "10", "false"},
+		{"WRITE", "a", "100", "10", "true"},
+		{"FSYNC", "a", "0", "0", "false"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("trace = %q, want %q", got, expected)
+	}
+}
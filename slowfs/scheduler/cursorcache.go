@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"container/list"
+	"slowfs/slowfs/units"
+)
+
+// maxCursors is how many file handles' sequential streams are tracked at once. Like the handful of
+// streams the kernel's readahead and a drive's segmented cache can follow, older ones are
+// forgotten.
+const maxCursors = 16
+
+type cursorEntry struct {
+	handle uint64
+	next   units.NumBytes
+}
+
+// cursorCache is an LRU map from file handles to the offset of the first byte after their last
+// access.
+type cursorCache struct {
+	size    int
+	order   *list.List
+	entries map[uint64]*list.Element
+}
+
+func newCursorCache(size int) *cursorCache {
+	return &cursorCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[uint64]*list.Element),
+	}
+}
+
+// get returns the cursor of handle, and whether it is tracked.
+func (cc *cursorCache) get(handle uint64) (units.NumBytes, bool) {
+	e, ok := cc.entries[handle]
+	if !ok {
+		return 0, false
+	}
+	return e.Value.(*cursorEntry).next, true
+}
+
+// set moves the cursor of handle to next and marks it as most recently used, evicting the least
+// recently used cursor if the cache is full.
+func (cc *cursorCache) set(handle uint64, next units.NumBytes) {
+	if e, ok := cc.entries[handle]; ok {
+		e.Value.(*cursorEntry).next = next
+		cc.order.MoveToFront(e)
+		return
+	}
+	if cc.order.Len() >= cc.size {
+		oldest := cc.order.Back()
+		cc.order.Remove(oldest)
+		delete(cc.entries, oldest.Value.(*cursorEntry).handle)
+	}
+	cc.entries[handle] = cc.order.PushFront(&cursorEntry{handle: handle, next: next})
+}
+
+func (cc *cursorCache) forget(handle uint64) {
+	if e, ok := cc.entries[handle]; ok {
+		cc.order.Remove(e)
+		delete(cc.entries, handle)
+	}
+}
+
+// clone returns a copy of cc which can be changed independently.
+func (cc *cursorCache) clone() *cursorCache {
+	c := newCursorCache(cc.size)
+	for e := cc.order.Front(); e != nil; e = e.Next() {
+		entry := *e.Value.(*cursorEntry)
+		c.entries[entry.handle] = c.order.PushBack(&entry)
+	}
+	return c
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestCursorCache(t *testing.T) {
+	cc := newCursorCache(2)
+	cc.set(1, 10)
+	cc.set(2, 20)
+	// Moving 1 again makes 2 the least recently used cursor.
+	cc.set(1, 11)
+	cc.set(3, 30)
+
+	cases := []struct {
+		handle uint64
+		want   units.NumBytes
+		wantOk bool
+	}{{1, 11, true}, {2, 0, false}, {3, 30, true}, {4, 0, false}}
+	for _, c := range cases {
+		if got, ok := cc.get(c.handle); got != c.want || ok != c.wantOk {
+			t.Errorf("get(%d) = %d, %t, want %d, %t", c.handle, got, ok, c.want, c.wantOk)
+		}
+	}
+
+	cc.forget(1)
+	if _, ok := cc.get(1); ok {
+		t.Errorf("get(1) after forget(1) found a cursor")
+	}
+}
+
+func TestCursorCache_Clone(t *testing.T) {
+	cc := newCursorCache(2)
+	cc.set(1, 10)
+	cc.set(2, 20)
+
+	c := cc.clone()
+	c.set(2, 21)
+	c.set(3, 30)
+	if got, _ := cc.get(2); got != 20 {
+		t.Errorf("moving a clone's cursor changed the original's to %d", got)
+	}
+	if _, ok := cc.get(3); ok {
+		t.Errorf("adding a cursor to a clone added it to the original")
+	}
+	// The clone keeps the original's order, so 1 is the one evicted.
+	if _, ok := c.get(1); ok {
+		t.Errorf("clone kept cursor 1, want it evicted")
+	}
+}
@@ -15,13 +15,27 @@
 package scheduler
 
 import (
+	"fmt"
 	"log"
+	"math/rand"
 	"os"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// transientErrorTTL is how long a read that failed with a transient error is remembered. A retry
+// of that read within this time succeeds.
+const transientErrorTTL = 10 * time.Second
+
+// failedRead identifies a read that failed with a transient error.
+type failedRead struct {
+	file   string
+	offset units.NumBytes
+}
+
 // DeviceContext holds the state of the device to determine how long a request should take, taking
 // into account things like seeking and sequentiality. This is after any re-ordering has been
 // applied. Conceptually this is the actual physical medium -- executing a request here affects
@@ -35,14 +49,56 @@ type deviceContext struct {
 	// This is used to determine if reads are sequential or not.
 	firstUnseenByte units.NumBytes
 
-	// Accesses to different files are assumed to be non-sequential reads.
+	// Accesses to different files are assumed to be non-sequential reads. Per-file state here is
+	// keyed as by Request.file, so hard links to the same file share it.
 	lastAccessedFile string
 
+	// How many operations of each name, as used by Triggers, have been executed.
+	opCounts map[string]uint64
+
+	// For recently used file handles, the offset of the first byte after their last access.
+	cursors *cursorCache
+
 	// The device can only execute one request at a time, so record when it is busy until.
 	busyUntil time.Time
 
+	// With a QueueDepth above 1, the device serves that many requests at a time instead, each on
+	// its own lane, so record when each lane is busy until. busyUntil is then when all of them are
+	// free.
+	lanes []time.Time
+
+	// With SeparateMetadataQueue, metadata operations are served separately, so record when
+	// they are busy until too.
+	metadataBusyUntil time.Time
+
+	// When the last fsync completed, used to enforce MinFsyncInterval.
+	lastFsyncEnd time.Time
+
+	// When the last metadata operation counted against MetadataIOPS completed.
+	lastMetadataEnd time.Time
+
+	// When the last MaxIOPS reads and writes completed, oldest first, to enforce MaxIOPS.
+	recentIOEnds []time.Time
+
 	logger *log.Logger
 	verboseLog bool
+
+	// Whether to log the seek decision for every request which may seek.
+	logSeeks bool
+
+	// Sources of randomness for each subsystem which makes random choices.
+	random *randomSources
+
+	// Called with each Event, if set.
+	eventHandler func(Event)
+
+	// Whether the last write was throttled, used to send throttling events.
+	throttling bool
+	// Whether the last write filled the write back cache, used to send cache full events.
+	cacheFull bool
+
+	// The most dirty data the write back cache has held.
+	peakDirtyBytes units.NumBytes
 	
 	// Statistics for periodic logging (30-second window)
 	windowReadBytes  uint64
@@ -51,58 +107,288 @@ type deviceContext struct {
 	windowWrites     uint64
 	lastLogTime      time.Time
 
+	// Reads and writes which took longer than TargetReadLatency and TargetWriteLatency, in the
+	// current window and in total.
+	windowReadTargetMisses  uint64
+	windowWriteTargetMisses uint64
+	readTargetMisses        uint64
+	writeTargetMisses       uint64
+
 	// Holds information about data not yet written back to disk.
 	writeBackCache *writeBackCache
+
+	// Reads which recently failed with a transient error, and when they failed.
+	failedReads map[failedRead]time.Time
+
+	// With delayed allocation, records bytes allocated per file whose cost has not been paid yet.
+	unallocatedBytes map[string]units.NumBytes
+
+	// Modeled access and modification times per file, used to decide when reads update atime.
+	atimes map[string]time.Time
+	mtimes map[string]time.Time
+
+	// Paths whose metadata is cached, if MetadataCacheSize is set.
+	metadataCache *metadataCache
+
+	// What has been prefetched of files being read, if ReadAheadBytes is set.
+	readAheadCache *readAheadCache
+
+	// Parts of each file which have been written, used to charge ColdWritePenalty on first writes.
+	writtenRanges map[string]*rangeSet
+
+	// Bytes of data stored on the device, as reported by AddUsedBytes, for SimulatedCapacity.
+	usedBytes units.NumBytes
 }
 
 // NewDeviceContext creates a new context given a DeviceConfig. DeviceContext will use that
 // configuration to compute how long requests take.
 func newDeviceContext(config *slowfs.DeviceConfig) *deviceContext {
+	random := unseededRandomSources()
 	var writeBackCache *writeBackCache
-	if config.FsyncStrategy == slowfs.WriteBackCachedFsync {
-		writeBackCache = newWriteBackCache(config)
+	if config.FsyncStrategy.UsesWriteBackCache() {
+		writeBackCache = newWriteBackCache(config, random.writeBack)
+	}
+	var metadataCache *metadataCache
+	if config.MetadataCacheSize > 0 {
+		metadataCache = newMetadataCache(config.MetadataCacheSize)
+	}
+	var readAheadCache *readAheadCache
+	if config.ReadAheadBytes > 0 {
+		readAheadCache = newReadAheadCache(config)
+	}
+	var lanes []time.Time
+	if config.QueueDepth > 1 {
+		lanes = make([]time.Time, config.QueueDepth)
 	}
 	return &deviceContext{
 		deviceConfig:   config,
 		logger:         log.New(os.Stderr, "SlowFS: ", log.Ldate|log.Ltime),
 		writeBackCache: writeBackCache,
 		lastLogTime:    time.Now(),
+		failedReads:    make(map[failedRead]time.Time),
+
+		unallocatedBytes: make(map[string]units.NumBytes),
+		atimes:           make(map[string]time.Time),
+		mtimes:           make(map[string]time.Time),
+		writtenRanges:    make(map[string]*rangeSet),
+		cursors:          newCursorCache(maxCursors),
+		opCounts:         make(map[string]uint64),
+		metadataCache:    metadataCache,
+		readAheadCache:   readAheadCache,
+		lanes:            lanes,
+		random:           random,
+	}
+}
+
+// setConfig switches the device to config for the requests executed from now on. State the new
+// config still uses carries over: the write back cache keeps its dirty data if config still has
+// one, and is drained first otherwise, while the metadata cache starts cold if its size changed.
+func (dc *deviceContext) setConfig(config *slowfs.DeviceConfig, now time.Time) {
+	if !config.FsyncStrategy.UsesWriteBackCache() && dc.writeBackCache != nil {
+		dc.drain(now)
+		dc.writeBackCache = nil
+	}
+	dc.deviceConfig = config
+
+	if config.FsyncStrategy.UsesWriteBackCache() {
+		if dc.writeBackCache == nil {
+			dc.writeBackCache = newWriteBackCache(config, dc.random.writeBack)
+		} else {
+			dc.writeBackCache.deviceConfig = config
+		}
+	}
+
+	switch {
+	case config.MetadataCacheSize <= 0:
+		dc.metadataCache = nil
+	case dc.metadataCache == nil || dc.metadataCache.size != config.MetadataCacheSize:
+		dc.metadataCache = newMetadataCache(config.MetadataCacheSize)
+	}
+
+	switch {
+	case config.ReadAheadBytes <= 0:
+		dc.readAheadCache = nil
+	case dc.readAheadCache == nil:
+		dc.readAheadCache = newReadAheadCache(config)
+	default:
+		dc.readAheadCache.deviceConfig = config
+	}
+
+	// Lanes added or removed start out as busy as the whole device, since which requests they
+	// would have been serving is unknown.
+	switch {
+	case config.QueueDepth <= 1:
+		dc.lanes = nil
+	case len(dc.lanes) != config.QueueDepth:
+		dc.lanes = make([]time.Time, config.QueueDepth)
+		dc.occupyAllLanes(dc.busyUntil)
+	}
+
+	if n := len(dc.recentIOEnds); n > config.MaxIOPS {
+		dc.recentIOEnds = dc.recentIOEnds[n-config.MaxIOPS:]
+	}
+}
+
+// setRandomSources replaces the device's sources of randomness, for reproducible runs.
+func (dc *deviceContext) setRandomSources(random *randomSources) {
+	dc.random = random
+	if dc.writeBackCache != nil {
+		dc.writeBackCache.random = random.writeBack
 	}
 }
 
 // ComputeTime computes how long a request should take given the current state of the device.
 // It does not update the context.
 func (dc *deviceContext) computeTime(req *Request) time.Duration {
+	opTime := dc.uncappedTime(req)
+	if dc.deviceConfig.MaxOpDelay > 0 {
+		opTime = min(opTime, dc.deviceConfig.MaxOpDelay)
+	}
+	return opTime
+}
+
+// uncappedTime is computeTime before MaxOpDelay is applied.
+func (dc *deviceContext) uncappedTime(req *Request) time.Duration {
 	requestDuration := time.Duration(0)
 
 	switch req.Type {
 	// Handle metadata requests, plus metadata requests that have been factored out because we
 	// need separate handling for them.
-	case MetadataRequest, CloseRequest:
+	case MetadataRequest:
+		requestDuration = dc.metadataOpTime(req)
+	case OpenDirRequest:
+		requestDuration = dc.deviceConfig.OpenDirTime
+		if requestDuration == 0 {
+			requestDuration = dc.metadataOpTime(req)
+		}
+		requestDuration += time.Duration(req.Size) * dc.deviceConfig.ReaddirEntryTime
+	case OpenRequest:
+		requestDuration = dc.deviceConfig.OpenTime
+		if requestDuration == 0 {
+			requestDuration = dc.metadataOpTime(req)
+		}
+	case CloseRequest:
 		requestDuration = dc.deviceConfig.MetadataOpTime
+		if dc.flushesOnClose() {
+			if dirty := dc.writeBackCache.getUnwrittenBytes(req.file()); dirty > 0 {
+				requestDuration += dc.deviceConfig.SeekTime + dc.deviceConfig.WriteTime(dirty)
+			}
+		}
+		// Delayed allocation not yet paid for by an fsync happens when the file is closed.
+		requestDuration += dc.deviceConfig.AllocateTime(dc.unallocatedBytes[req.file()])
+	case StatRequest:
+		// Cached lookups don't need to go to the device.
+		if !dc.servedFromMetadataCache(req) {
+			requestDuration = dc.metadataOpTime(req)
+		}
 	case AllocateRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.AllocateTime(req.Size)
+		// With delayed allocation the cost is paid when the file is fsynced or closed instead.
+		if !dc.deviceConfig.DelayedAllocation {
+			requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.AllocateTime(req.Size)
+		}
 	case ReadRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.ReadTime(req.Size)
+		if dc.readAheadHit(req) {
+			// Prefetched data is served from the device's cache without touching the disk.
+			requestDuration = dc.deviceConfig.MetadataOpTime
+		} else {
+			requestDuration = dc.computeSeekTime(req)
+			if seek, _ := dc.seekDecision(req); seek {
+				requestDuration += dc.deviceConfig.RandomReadTime(req.Size) + dc.deviceConfig.TimeToFirstByte
+			} else {
+				requestDuration += dc.deviceConfig.ReadTime(req.Size)
+			}
+			requestDuration += dc.deviceConfig.RotationalLatency()
+		}
+		if req.recovering {
+			requestDuration += dc.deviceConfig.TransientErrorRecoveryTime
+		}
+		if dc.needsAtimeUpdate(req) {
+			requestDuration += dc.deviceConfig.MetadataOpTime
+		}
+		requestDuration += dc.deviceConfig.ReadOpTime
 	case WriteRequest:
-		switch dc.deviceConfig.WriteStrategy {
-		case slowfs.FastWrite:
-			// Leave at 0 seconds.
-		case slowfs.SimulateWrite:
-			requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.WriteTime(req.Size)
+		// Fast writes leave the time at 0 seconds.
+		if dc.simulatesWrite(req) {
+			requestDuration = dc.computeSeekTime(req)
+			if seek, _ := dc.seekDecision(req); seek {
+				requestDuration += dc.deviceConfig.RandomWriteTime(req.Size)
+			} else {
+				requestDuration += dc.deviceConfig.WriteTime(req.Size)
+			}
+			requestDuration += dc.deviceConfig.RotationalLatency()
 		}
+		if dc.cachesWrite(req) {
+			// Writers are throttled once the cache holds too much dirty data.
+			requestDuration += dc.deviceConfig.WriteTime(dc.writeBackCache.throttledBytes(req.Size))
+		}
+		if dc.isColdWrite(req) {
+			requestDuration += dc.deviceConfig.ColdWritePenalty
+		}
+		requestDuration += dc.deviceConfig.WriteOpTime
 	case FsyncRequest:
 		switch dc.deviceConfig.FsyncStrategy {
 		case slowfs.DumbFsync:
 			requestDuration = dc.deviceConfig.SeekTime * 10
-		case slowfs.WriteBackCachedFsync:
-			requestDuration = dc.deviceConfig.SeekTime + dc.deviceConfig.WriteTime(dc.writeBackCache.getUnwrittenBytes(req.Path))
+		case slowfs.WriteBackCachedFsync, slowfs.GlobalWriteBackCachedFsync:
+			// A lying fsync returns straight away, leaving the data to background write back.
+			if dc.deviceConfig.LyingFsync {
+				break
+			}
+			if dc.globalFsync() {
+				// Flushing the journal writes back every file's dirty data, not just this one's.
+				requestDuration = dc.writeBackCache.drainTime()
+			} else {
+				requestDuration = dc.deviceConfig.SeekTime + dc.deviceConfig.WriteTime(dc.writeBackCache.getUnwrittenBytes(req.file()))
+			}
+		}
+		if dc.deviceConfig.FsyncStrategy != slowfs.NoFsync {
+			requestDuration += dc.deviceConfig.AllocateTime(dc.unallocatedBytes[req.file()])
 		}
+		requestDuration += dc.deviceConfig.FsyncOpTime
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
+	// Every request makes a round trip to networked storage, whatever else it costs.
+	if !dc.servedFromMetadataCache(req) {
+		requestDuration += dc.deviceConfig.NetworkLatency
+	}
+
+	if lh := dc.deviceConfig.LatencyHistograms[opName(req.Type)]; lh != nil {
+		requestDuration = sampledLatency(req, lh, dc.random.latency)
+	}
+	if d, ok := dc.deviceConfig.PathLatency(req.Path, opName(req.Type)); ok {
+		requestDuration = d
+	}
+	if dc.deviceConfig.LatencyJitter > 0 {
+		requestDuration = time.Duration(float64(requestDuration) * jitterFactor(req, dc.deviceConfig.LatencyJitter, dc.random.jitter))
+	}
+
+	requestDuration += dc.triggeredDelay(req)
 
-	return latestTime(dc.busyUntil, req.Timestamp).Add(requestDuration).Sub(req.Timestamp)
+	busyUntil := dc.busyUntil
+	if dc.separateMetadata(req) {
+		busyUntil = dc.metadataBusyUntil
+	} else if dc.lanes != nil && req.Type != FsyncRequest {
+		// Fsyncs wait for everything in flight, but other requests only need a free lane.
+		_, busyUntil = dc.freeLane()
+	}
+	start := latestTime(busyUntil, req.Timestamp)
+	if req.Type == FsyncRequest && !dc.lastFsyncEnd.IsZero() {
+		// The device can't commit more often than MinFsyncInterval allows.
+		start = latestTime(start, dc.lastFsyncEnd.Add(dc.deviceConfig.MinFsyncInterval))
+	}
+	if dc.limitedByMaxIOPS(req) && len(dc.recentIOEnds) == dc.deviceConfig.MaxIOPS {
+		// MaxIOPS operations completed within the last second, so this one has to wait until a
+		// second after the oldest of them.
+		start = latestTime(start, dc.recentIOEnds[0].Add(time.Second-requestDuration))
+	}
+	if dc.limitedByMetadataIOPS(req) && !dc.lastMetadataEnd.IsZero() {
+		// Each metadata operation completes at least a MetadataIOPS interval after the last one.
+		interval := time.Second / time.Duration(dc.deviceConfig.MetadataIOPS)
+		start = latestTime(start, dc.lastMetadataEnd.Add(interval-requestDuration))
+	}
+
+	return start.Add(requestDuration).Sub(req.Timestamp)
 }
 
 // Execute executes a given request, applying changes to the device context.
@@ -129,6 +415,11 @@ func (dc *deviceContext) execute(req *Request) {
 			
 			dc.logger.Printf("IO Speed: %.1f KB/s read (%d ops), %.1f KB/s write (%d ops)",
 				readKBps, dc.windowReads, writeKBps, dc.windowWrites)
+			if dc.deviceConfig.TargetReadLatency > 0 || dc.deviceConfig.TargetWriteLatency > 0 {
+				dc.logger.Printf("Latency targets missed: %d/%d reads over %s, %d/%d writes over %s",
+					dc.windowReadTargetMisses, dc.windowReads, dc.deviceConfig.TargetReadLatency,
+					dc.windowWriteTargetMisses, dc.windowWrites, dc.deviceConfig.TargetWriteLatency)
+			}
 		}
 		
 		// Reset window counters
@@ -136,61 +427,604 @@ func (dc *deviceContext) execute(req *Request) {
 		dc.windowWrites = 0
 		dc.windowReadBytes = 0
 		dc.windowWriteBytes = 0
+		dc.windowReadTargetMisses = 0
+		dc.windowWriteTargetMisses = 0
 		dc.lastLogTime = time.Now()
 	}
 
-	// Devote spare time to writing back cache.
-	if spareTime > 0 && dc.writeBackCache != nil {
+	// Devote spare time to prefetching, then to writing back cache. Separately served metadata
+	// operations leave the data side alone, so its spare time is used by the next data request
+	// instead.
+	if spareTime > 0 && !dc.separateMetadata(req) {
+		spareTime -= dc.prefetch(spareTime, req.Timestamp)
+	}
+	if spareTime > 0 && dc.writeBackCache != nil && !dc.separateMetadata(req) {
 		dc.writeBackCache.writeBack(spareTime)
 	}
 
-	dc.busyUntil = req.Timestamp.Add(dc.computeTime(req))
+	switch req.Type {
+	case ReadRequest, WriteRequest, AllocateRequest:
+		dc.logSeekDecision(req)
+	}
+
+	opTime := dc.uncappedTime(req)
+	if maxDelay := dc.deviceConfig.MaxOpDelay; maxDelay > 0 && opTime > maxDelay {
+		dc.emit(Event{Time: req.Timestamp, Type: StallEvent, Path: req.Path, Detail: fmt.Sprintf("%s capped to %s", opTime, maxDelay)})
+		opTime = maxDelay
+	}
+	end := req.Timestamp.Add(opTime)
+	if dc.limitedByMetadataIOPS(req) {
+		dc.lastMetadataEnd = end
+	}
+	if dc.limitedByMaxIOPS(req) {
+		if len(dc.recentIOEnds) == dc.deviceConfig.MaxIOPS {
+			dc.recentIOEnds = dc.recentIOEnds[1:]
+		}
+		dc.recentIOEnds = append(dc.recentIOEnds, end)
+	}
+	if dc.separateMetadata(req) {
+		dc.metadataBusyUntil = end
+	} else if dc.lanes != nil && req.Type != FsyncRequest {
+		i, _ := dc.freeLane()
+		dc.lanes[i] = end
+		dc.busyUntil = latestTime(dc.busyUntil, end)
+	} else {
+		dc.occupyAllLanes(end)
+	}
+	op := opName(req.Type)
+	dc.opCounts[op]++
+	for _, t := range dc.deviceConfig.Triggers {
+		// A trigger firing after 0 operations is in effect from the start, so fires on the first.
+		if t.Op == op && dc.opCounts[op] == max(t.AfterOps, 1) {
+			dc.emit(Event{Time: req.Timestamp, Type: TriggerFiredEvent, Path: req.Path, Detail: t.String()})
+		}
+	}
 
 	switch req.Type {
-	case MetadataRequest, AllocateRequest:
+	case MetadataRequest:
+		if dc.metadataCache != nil {
+			dc.invalidateMetadata(req)
+		}
+	case OpenRequest, OpenDirRequest:
 		// Do nothing.
+	case StatRequest:
+		if dc.metadataCache != nil {
+			dc.metadataCache.touch(req.Path)
+		}
+	case AllocateRequest:
+		if dc.deviceConfig.DelayedAllocation {
+			dc.unallocatedBytes[req.file()] += req.Size
+		}
 	case CloseRequest:
-		if dc.writeBackCache != nil {
-			dc.writeBackCache.close(req.Path)
+		if dc.readAheadCache != nil {
+			dc.readAheadCache.forget(req.file())
+		}
+		if dc.flushesOnClose() {
+			dc.writeBackCache.writeBackFile(req.file())
+		} else if dc.writeBackCache != nil {
+			dc.writeBackCache.close(req.file())
 		}
-		if dc.lastAccessedFile == req.Path {
+		// Closing paid for any delayed allocation.
+		delete(dc.unallocatedBytes, req.file())
+		if dc.lastAccessedFile == req.file() {
 			dc.lastAccessedFile = ""
 			dc.firstUnseenByte = 0
 		}
+		dc.cursors.forget(req.Handle)
 	case ReadRequest:
-		dc.lastAccessedFile = req.Path
+		if dc.needsAtimeUpdate(req) {
+			dc.atimes[req.file()] = req.Timestamp
+		}
+		dc.lastAccessedFile = req.file()
 		dc.firstUnseenByte = req.Start + req.Size
+		dc.moveHandleCursor(req)
+		if dc.readAheadCache != nil {
+			// A read of prefetched data leaves the head where prefetching stopped.
+			if dc.readAheadCache.contains(req, 0) {
+				dc.firstUnseenByte = dc.readAheadCache.windows[req.file()].end
+			}
+			dc.readAheadCache.read(req)
+		}
 	case WriteRequest:
-		switch dc.deviceConfig.WriteStrategy {
-		case slowfs.FastWrite:
-			// Fast writes don't affect things here.
-		case slowfs.SimulateWrite:
-			dc.lastAccessedFile = req.Path
+		if dc.readAheadCache != nil {
+			dc.readAheadCache.forget(req.file())
+		}
+		if dc.deviceConfig.AtimeMode == slowfs.RelAtime {
+			dc.mtimes[req.file()] = req.Timestamp
+		}
+		if dc.deviceConfig.ColdWritePenalty > 0 {
+			written, ok := dc.writtenRanges[req.file()]
+			if !ok {
+				written = &rangeSet{}
+				dc.writtenRanges[req.file()] = written
+			}
+			written.add(req.Start, req.Start+req.Size)
+		}
+		// Fast writes don't move the head.
+		if dc.simulatesWrite(req) {
+			dc.lastAccessedFile = req.file()
 			dc.firstUnseenByte = req.Start + req.Size
+			dc.moveHandleCursor(req)
 		}
 
-		if dc.writeBackCache != nil {
-			dc.writeBackCache.write(req.Path, req.Size)
+		if dc.cachesWrite(req) {
+			if size := dc.deviceConfig.WriteBackCacheSize; size > 0 {
+				dirty := dc.writeBackCache.getTotalUnwrittenBytes()
+				if full := dirty+req.Size >= size; full != dc.cacheFull {
+					dc.cacheFull = full
+					if full {
+						dc.emit(Event{Time: req.Timestamp, Type: CacheFullEvent, Path: req.Path, Detail: fmt.Sprintf("%s dirty", dirty)})
+					}
+				}
+			}
+			throttled := dc.writeBackCache.throttledBytes(req.Size)
+			if throttling := throttled > 0; throttling != dc.throttling {
+				dc.throttling = throttling
+				ev := Event{Time: req.Timestamp, Type: ThrottleEndEvent, Path: req.Path}
+				if throttling {
+					ev.Type = ThrottleStartEvent
+					ev.Detail = fmt.Sprintf("%s dirty", dc.writeBackCache.getTotalUnwrittenBytes())
+				}
+				dc.emit(ev)
+			}
+			// Throttled bytes were already written back while the writer waited.
+			dc.writeBackCache.write(req.file(), req.Size-throttled)
+			if dirty := dc.writeBackCache.getTotalUnwrittenBytes(); dirty > dc.peakDirtyBytes {
+				dc.peakDirtyBytes = dirty
+			}
 		}
 	case FsyncRequest:
-		if dc.writeBackCache != nil {
-			dc.writeBackCache.writeBackFile(req.Path)
+		// With a lying fsync the data stays dirty, and would be lost in a crash, until it gets
+		// written back in spare time.
+		if dc.writeBackCache != nil && !dc.deviceConfig.LyingFsync {
+			if dc.globalFsync() {
+				dc.writeBackCache.drain()
+			} else {
+				dc.writeBackCache.writeBackFile(req.file())
+			}
 		}
+		// Fsyncs which do nothing leave the allocation to be paid for on close.
+		if dc.deviceConfig.FsyncStrategy != slowfs.NoFsync {
+			delete(dc.unallocatedBytes, req.file())
+		}
+		dc.lastFsyncEnd = dc.busyUntil
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
 }
 
+// Drain writes back everything in the write back cache, as a clean shutdown would, after using
+// any spare time up to now. It returns when the device will have finished.
+func (dc *deviceContext) drain(now time.Time) time.Time {
+	if spareTime := now.Sub(dc.busyUntil); spareTime > 0 && dc.writeBackCache != nil {
+		dc.writeBackCache.writeBack(spareTime)
+	}
+	busyUntil := latestTime(dc.busyUntil, now)
+	if dc.writeBackCache != nil {
+		busyUntil = busyUntil.Add(dc.writeBackCache.drain())
+	}
+	dc.occupyAllLanes(busyUntil)
+	return dc.busyUntil
+}
+
+// prefetch spends up to spareTime, the spare time until now, reading ahead of the last read, if
+// the head is still where it left off, returning how long it took.
+func (dc *deviceContext) prefetch(spareTime time.Duration, now time.Time) time.Duration {
+	if !dc.prefetching() {
+		return 0
+	}
+	took, end := dc.readAheadCache.prefetch(spareTime, now)
+	dc.firstUnseenByte = end
+	return took
+}
+
+// prefetching returns whether the device reads ahead in spare time.
+func (dc *deviceContext) prefetching() bool {
+	return dc.readAheadCache != nil && dc.readAheadCache.current != "" && dc.readAheadCache.current == dc.lastAccessedFile
+}
+
+// readAheadHit returns whether req only reads data which will have been prefetched by the time
+// it arrives.
+func (dc *deviceContext) readAheadHit(req *Request) bool {
+	if dc.readAheadCache == nil {
+		return false
+	}
+	var spareTime time.Duration
+	if dc.prefetching() && !dc.separateMetadata(req) {
+		spareTime = req.Timestamp.Sub(latestTime(dc.busyUntil, dc.readAheadCache.spentUntil))
+	}
+	return dc.readAheadCache.contains(req, spareTime)
+}
+
+// freeLane returns the lane which is free earliest, and when it is free. Must only be called
+// with a QueueDepth above 1.
+func (dc *deviceContext) freeLane() (int, time.Time) {
+	free := 0
+	for i, busyUntil := range dc.lanes {
+		if busyUntil.Before(dc.lanes[free]) {
+			free = i
+		}
+	}
+	return free, dc.lanes[free]
+}
+
+// occupyAllLanes makes the whole device busy until t, which must be no earlier than busyUntil.
+func (dc *deviceContext) occupyAllLanes(t time.Time) {
+	dc.busyUntil = t
+	for i := range dc.lanes {
+		dc.lanes[i] = t
+	}
+}
+
+// CheckTransientError decides whether a read fails with a transient error, returning EIO if so.
+// A read retrying one which failed within transientErrorTTL always succeeds, and is marked as
+// recovering so it pays TransientErrorRecoveryTime. This must be called once per request, before
+// it is executed.
+func (dc *deviceContext) checkTransientError(req *Request) error {
+	if req.Type != ReadRequest || dc.deviceConfig.TransientReadErrorRate <= 0 {
+		return nil
+	}
+
+	for fr, failedAt := range dc.failedReads {
+		if req.Timestamp.Sub(failedAt) > transientErrorTTL {
+			delete(dc.failedReads, fr)
+		}
+	}
+
+	key := failedRead{req.file(), req.Start}
+	if _, ok := dc.failedReads[key]; ok {
+		delete(dc.failedReads, key)
+		req.recovering = true
+		return nil
+	}
+
+	if dc.random.errors.Float64() < dc.deviceConfig.TransientReadErrorRate {
+		dc.failedReads[key] = req.Timestamp
+		return syscall.EIO
+	}
+	return nil
+}
+
+// CheckInjectedError decides whether req fails with EIO due to ReadErrorRate or WriteErrorRate.
+// Like checkTransientError, this must be called once per request, before it is executed.
+func (dc *deviceContext) checkInjectedError(req *Request) error {
+	rate := 0.0
+	switch req.Type {
+	case ReadRequest:
+		rate = dc.deviceConfig.ReadErrorRate
+	case WriteRequest:
+		rate = dc.deviceConfig.WriteErrorRate
+	}
+	if rate > 0 && dc.random.errors.Float64() < rate {
+		return syscall.EIO
+	}
+	return nil
+}
+
+// CheckErrors decides whether req fails, for any of the reasons the device can fail requests.
+func (dc *deviceContext) checkErrors(req *Request) error {
+	if err := dc.checkTransientError(req); err != nil {
+		return err
+	}
+	return dc.checkInjectedError(req)
+}
+
+// ChooseCorruption decides whether a read which succeeds returns silently corrupted data, setting
+// req.CorruptOffsets if so. Like checkTransientError, this must be called once per request, before
+// it is executed.
+func (dc *deviceContext) chooseCorruption(req *Request) {
+	if req.Type != ReadRequest || req.Size <= 0 || dc.deviceConfig.CorruptionProbability <= 0 {
+		return
+	}
+	if dc.random.corruption.Float64() >= dc.deviceConfig.CorruptionProbability {
+		return
+	}
+	n := min(units.NumBytes(max(dc.deviceConfig.CorruptionBytes, 1)), req.Size)
+	off := dc.random.corruption.Int63n(int64(req.Size-n) + 1)
+	req.CorruptOffsets = make([]int64, n)
+	for i := range req.CorruptOffsets {
+		req.CorruptOffsets[i] = off + int64(i)
+	}
+	detail := fmt.Sprintf("byte %d", req.Start+units.NumBytes(off))
+	if n > 1 {
+		detail = fmt.Sprintf("bytes %d to %d", req.Start+units.NumBytes(off), req.Start+units.NumBytes(off)+n-1)
+	}
+	dc.emit(Event{Time: req.Timestamp, Type: CorruptionEvent, Path: req.Path, Detail: detail})
+}
+
+// ApplyLatencyTarget records whether a request which took opTime missed its latency target, and
+// returns opTime raised to the target so the request never finishes sooner than it. Requests
+// without a target are returned unchanged.
+func (dc *deviceContext) applyLatencyTarget(req *Request, opTime time.Duration) time.Duration {
+	var target time.Duration
+	switch req.Type {
+	case ReadRequest:
+		target = dc.deviceConfig.TargetReadLatency
+	case WriteRequest:
+		target = dc.deviceConfig.TargetWriteLatency
+	}
+	if target <= 0 {
+		return opTime
+	}
+
+	if opTime > target {
+		if req.Type == ReadRequest {
+			dc.windowReadTargetMisses++
+			dc.readTargetMisses++
+		} else {
+			dc.windowWriteTargetMisses++
+			dc.writeTargetMisses++
+		}
+		return opTime
+	}
+	return target
+}
+
+// MetadataOpTime returns how long a metadata operation on req's path takes, including resolving
+// each of its components.
+func (dc *deviceContext) metadataOpTime(req *Request) time.Duration {
+	return dc.deviceConfig.MetadataOpTimeFor(req.Op) + time.Duration(pathDepth(req.Path))*dc.deviceConfig.MetadataPerComponentTime
+}
+
+// PathDepth returns how many components path has, where the root "" has none.
+func pathDepth(path string) int {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// SampledLatency returns req's time sampled from lh. The sample is taken once and kept on req, so
+// computing the time of a request repeatedly gives the same answer.
+func sampledLatency(req *Request, lh *slowfs.LatencyHistogram, random *rand.Rand) time.Duration {
+	if !req.latencySampled {
+		req.latencySample = lh.Sample(random.Float64())
+		req.latencySampled = true
+	}
+	return req.latencySample
+}
+
+// JitterFactor returns the factor, between 1-jitter and 1+jitter, to scale req's time by. Like
+// sampledLatency, it is chosen once and kept on req.
+func jitterFactor(req *Request, jitter float64, random *rand.Rand) float64 {
+	if !req.jittered {
+		req.jitterFactor = 1 + jitter*(2*random.Float64()-1)
+		req.jittered = true
+	}
+	return req.jitterFactor
+}
+
+// SimulatesWrite returns whether a write takes the time to reach the media up-front, which direct
+// writes always do.
+func (dc *deviceContext) simulatesWrite(req *Request) bool {
+	return req.Direct || dc.deviceConfig.WriteStrategy == slowfs.SimulateWrite
+}
+
+// CachesWrite returns whether a write leaves its data dirty in the write back cache. Direct writes
+// bypass it.
+func (dc *deviceContext) cachesWrite(req *Request) bool {
+	return dc.writeBackCache != nil && !req.Direct
+}
+
+// HasRoom returns whether n more bytes fit in the device's SimulatedCapacity, sending a
+// NoSpaceEvent at now for path if they don't.
+func (dc *deviceContext) hasRoom(path string, n units.NumBytes, now time.Time) bool {
+	capacity := dc.deviceConfig.SimulatedCapacity
+	if n <= 0 || capacity <= 0 || dc.usedBytes+n <= capacity {
+		return true
+	}
+	dc.emit(Event{Time: now, Type: NoSpaceEvent, Path: path, Detail: fmt.Sprintf("%s needed, %s free", n, max(capacity-dc.usedBytes, 0))})
+	return false
+}
+
+// GlobalFsync returns whether an fsync writes back every file's dirty data rather than only its
+// own, either because of GlobalFsync or the GlobalWriteBackCachedFsync shorthand for it.
+func (dc *deviceContext) globalFsync() bool {
+	return dc.deviceConfig.GlobalFsync || dc.deviceConfig.FsyncStrategy == slowfs.GlobalWriteBackCachedFsync
+}
+
+// FlushesOnClose returns whether closing a file writes back its dirty data.
+func (dc *deviceContext) flushesOnClose() bool {
+	return dc.deviceConfig.FlushOnClose && dc.writeBackCache != nil
+}
+
+// NeedsAtimeUpdate decides whether a read has to write back an updated access time.
+func (dc *deviceContext) needsAtimeUpdate(req *Request) bool {
+	switch dc.deviceConfig.AtimeMode {
+	case slowfs.StrictAtime:
+		return true
+	case slowfs.RelAtime:
+		atime, ok := dc.atimes[req.file()]
+		return !ok || !atime.After(dc.mtimes[req.file()]) || req.Timestamp.Sub(atime) >= 24*time.Hour
+	default:
+		return false
+	}
+}
+
+// IsColdWrite decides whether a write touches any part of its file that has not been written
+// before. Only tracked when ColdWritePenalty is set.
+func (dc *deviceContext) isColdWrite(req *Request) bool {
+	if dc.deviceConfig.ColdWritePenalty <= 0 {
+		return false
+	}
+	written, ok := dc.writtenRanges[req.file()]
+	return !ok || !written.contains(req.Start, req.Start+req.Size)
+}
+
 func (dc *deviceContext) computeSeekTime(req *Request) time.Duration {
+	if seek, _ := dc.seekDecision(req); seek {
+		return dc.deviceConfig.SeekTime
+	}
+	return dc.blockGroupSeekTime(req)
+}
+
+// ChargesSeek returns whether computeTime charges req for a seek, including crossing block groups.
+func (dc *deviceContext) chargesSeek(req *Request) bool {
+	switch req.Type {
+	case AllocateRequest:
+		return !dc.deviceConfig.DelayedAllocation && dc.computeSeekTime(req) > 0
+	case ReadRequest:
+		return !dc.readAheadHit(req) && dc.computeSeekTime(req) > 0
+	case WriteRequest:
+		return dc.simulatesWrite(req) && dc.computeSeekTime(req) > 0
+	default:
+		return false
+	}
+}
+
+// BlockGroupSeekTime returns the extra time a request which doesn't seek otherwise takes to cross
+// into later block groups. A boundary is crossed by the request which accesses the byte at it.
+func (dc *deviceContext) blockGroupSeekTime(req *Request) time.Duration {
+	groupSize := dc.deviceConfig.BlockGroupSize
+	if groupSize <= 0 {
+		return 0
+	}
+	// Number of block group boundaries, other than the start of the file, before offset.
+	boundariesBefore := func(offset units.NumBytes) int64 {
+		if offset <= 0 {
+			return 0
+		}
+		return int64((offset - 1) / groupSize)
+	}
+	crossed := boundariesBefore(req.Start+req.Size) - boundariesBefore(req.Start)
+
+	seekTime := dc.deviceConfig.BlockGroupSeekTime
+	if seekTime == 0 {
+		seekTime = dc.deviceConfig.SeekTime
+	}
+	return time.Duration(crossed) * seekTime
+}
+
+// SeekDecision decides whether req needs a seek, and explains why.
+func (dc *deviceContext) seekDecision(req *Request) (bool, string) {
 	// Seek if:
 	//   1. We're accessing a different file or an unseen one.
-	//   2. We're looking very far ahead compared to last access.
+	//   2. We're looking very far ahead compared to last access. With delayed allocation files are
+	//      laid out contiguously, so skipping ahead within a file doesn't need a seek.
 	//   3. We're going backwards.
-	if dc.lastAccessedFile != req.Path || dc.firstUnseenByte > req.Start ||
-		req.Start-dc.firstUnseenByte >= dc.deviceConfig.SeekWindow {
-		return dc.deviceConfig.SeekTime
+	// Appends always continue from the end of the file, so they only seek when switching files.
+	appending := req.Type == WriteRequest && req.Append
+	if !appending && dc.continuesHandle(req) {
+		return false, fmt.Sprintf("sequential for handle %d", req.Handle)
+	}
+	if dc.lastAccessedFile != req.file() {
+		return true, fmt.Sprintf("different file (last accessed %q)", dc.lastAccessedFile)
+	}
+	if appending {
+		return false, "append"
+	}
+	if dc.firstUnseenByte > req.Start {
+		return true, fmt.Sprintf("backward (offset %d, first unseen byte %d)", req.Start, dc.firstUnseenByte)
+	}
+	if req.Start-dc.firstUnseenByte >= dc.deviceConfig.SeekWindow && !dc.deviceConfig.DelayedAllocation {
+		return true, fmt.Sprintf("beyond seek window (offset %d, first unseen byte %d, window %s)",
+			req.Start, dc.firstUnseenByte, dc.deviceConfig.SeekWindow)
+	}
+	return false, fmt.Sprintf("sequential (offset %d, first unseen byte %d)", req.Start, dc.firstUnseenByte)
+}
+
+// logSeekDecision logs whether req seeks and why, if seek logging is on.
+func (dc *deviceContext) logSeekDecision(req *Request) {
+	if !dc.logSeeks {
+		return
+	}
+	seek, reason := dc.seekDecision(req)
+	decision := "no seek"
+	if seek {
+		decision = "seek"
+	}
+	dc.logger.Printf("%s %s offset=%d size=%d: %s, %s", req.Type, req.Path, req.Start, req.Size, decision, reason)
+}
+
+// separateMetadata returns whether req is a metadata operation served separately from data I/O.
+func (dc *deviceContext) separateMetadata(req *Request) bool {
+	return dc.deviceConfig.SeparateMetadataQueue && isMetadata(req.Type)
+}
+
+// limitedByMetadataIOPS returns whether req counts against MetadataIOPS. Lookups served from the
+// metadata cache never reach the device, so they don't.
+func (dc *deviceContext) limitedByMetadataIOPS(req *Request) bool {
+	if dc.deviceConfig.MetadataIOPS <= 0 || !isMetadata(req.Type) {
+		return false
+	}
+	return !dc.servedFromMetadataCache(req)
+}
+
+// invalidateMetadata drops what the metadata cache holds for a path which req renames, removes or
+// changes the attributes of, so the next lookup goes to the device.
+func (dc *deviceContext) invalidateMetadata(req *Request) {
+	switch req.Op {
+	case "rename", "rmdir":
+		dc.metadataCache.forget(req.Path, true)
+	case "unlink", "chmod", "chown", "truncate", "utimens":
+		dc.metadataCache.forget(req.Path, false)
+	}
+}
+
+// servedFromMetadataCache returns whether req is a lookup of a path in the metadata cache, which
+// doesn't need to reach the device.
+func (dc *deviceContext) servedFromMetadataCache(req *Request) bool {
+	return req.Type == StatRequest && dc.metadataCache != nil && dc.metadataCache.contains(req.Path)
+}
+
+// limitedByMaxIOPS returns whether req counts against MaxIOPS.
+func (dc *deviceContext) limitedByMaxIOPS(req *Request) bool {
+	return dc.deviceConfig.MaxIOPS > 0 && (req.Type == ReadRequest || req.Type == WriteRequest)
+}
+
+// isMetadata returns whether requests of type rt are metadata operations rather than data I/O.
+func isMetadata(rt RequestType) bool {
+	switch rt {
+	case MetadataRequest, OpenRequest, StatRequest, OpenDirRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// opName returns the name Triggers use for operations of type rt.
+func opName(rt RequestType) string {
+	switch rt {
+	case ReadRequest:
+		return "read"
+	case WriteRequest:
+		return "write"
+	case FsyncRequest:
+		return "fsync"
+	case MetadataRequest, OpenRequest, CloseRequest, StatRequest, OpenDirRequest:
+		return "metadata"
+	default:
+		return ""
+	}
+}
+
+// TriggeredDelay returns how much longer req takes due to Triggers which have fired.
+func (dc *deviceContext) triggeredDelay(req *Request) time.Duration {
+	var delay time.Duration
+	for _, t := range dc.deviceConfig.Triggers {
+		if dc.opCounts[t.Op] >= t.AfterOps {
+			delay += t.ExtraDelay[opName(req.Type)]
+		}
+	}
+	return delay
+}
+
+// ContinuesHandle decides whether a request carries on sequentially from the last access through
+// the same file handle. This lets interleaved sequential streams each avoid a seek, as long as
+// there are few enough of them to be tracked.
+func (dc *deviceContext) continuesHandle(req *Request) bool {
+	if req.Handle == 0 {
+		return false
+	}
+	next, ok := dc.cursors.get(req.Handle)
+	return ok && req.Start >= next && req.Start-next < dc.deviceConfig.SeekWindow
+}
+
+func (dc *deviceContext) moveHandleCursor(req *Request) {
+	if req.Handle != 0 {
+		dc.cursors.set(req.Handle, req.Start+req.Size)
 	}
-	return time.Duration(0)
 }
 
 func latestTime(a, b time.Time) time.Time {
@@ -15,7 +15,11 @@
 package scheduler
 
 import (
+	"fmt"
+	"reflect"
 	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strings"
 	"testing"
 	"time"
 )
@@ -417,15 +421,2253 @@ func TestDeviceContext_ComputeTimeAndExecute(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:         "min fsync interval",
+			deviceConfig: minFsyncIntervalDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 600 * time.Millisecond, // Waits out the interval, then takes 100ms.
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Timestamp: startTime.Add(700 * time.Millisecond),
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(2 * time.Second),
+						Path:      "a",
+					},
+					want: 100 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "delayed allocation paid on close",
+			deviceConfig: delayedAllocationDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      AllocateRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1000,
+					},
+					want: 0 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 1080 * time.Millisecond, // Allocation is paid for here.
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(1080 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "delayed allocation without fsync paid on close",
+			deviceConfig: delayedAllocationNoFsyncDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      AllocateRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1000,
+					},
+					want: 0 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 0 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 1080 * time.Millisecond, // Allocation is paid for here.
+				},
+			},
+		},
+		{
+			desc:         "delayed allocation",
+			deviceConfig: delayedAllocationDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      AllocateRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      1000,
+					},
+					want: 0 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 1100 * time.Millisecond, // Allocation is paid for here.
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(1100 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1200 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1220 * time.Millisecond),
+						Path:      "a",
+						Start:     100,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond, // Skipping ahead is not a seek.
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1230 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "strictatime",
+			deviceConfig: strictAtimeDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+					},
+					want: 90 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "relatime",
+			deviceConfig: relAtimeDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 100 * time.Millisecond, // First access updates atime.
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(101 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(111 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(121 * time.Millisecond),
+						Path:      "a",
+						Start:     3,
+						Size:      1,
+					},
+					want: 90 * time.Millisecond, // Modified since last access.
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(211 * time.Millisecond),
+						Path:      "a",
+						Start:     4,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(25 * time.Hour),
+						Path:      "a",
+						Start:     5,
+						Size:      1,
+					},
+					want: 90 * time.Millisecond, // Over a day since last access.
+				},
+			},
+		},
+		{
+			desc:         "op times",
+			deviceConfig: opTimesDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 21 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(21 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+					},
+					want: 2 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(23 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 103 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "cold write penalty",
+			deviceConfig: coldWritePenaltyDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      10,
+					},
+					want: 50 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      10,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "a",
+						Start:     5,
+						Size:      10,
+					},
+					want: 50 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      15,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      15,
+					},
+					want: 50 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "append writes are sequential",
+			deviceConfig: basicDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+						Append:    true,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(20 * time.Millisecond),
+						Path:      "a",
+						Start:     100,
+						Size:      1,
+						Append:    true,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(30 * time.Millisecond),
+						Path:      "a",
+						Start:     50,
+						Size:      1,
+						Append:    true,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(40 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+						Append:    true,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(60 * time.Millisecond),
+						Path:      "b",
+						Start:     100,
+						Size:      1,
+						Append:    false,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "dirty throttling",
+			deviceConfig: dirtyThrottleDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      40,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      20,
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "c",
+						Start:     0,
+						Size:      5,
+					},
+					want: 50 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Timestamp: startTime.Add(time.Hour),
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(time.Hour + 80*time.Millisecond),
+						Path:      "c",
+						Start:     0,
+						Size:      10,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(time.Hour + 80*time.Millisecond),
+						Path:      "d",
+						Start:     0,
+						Size:      25,
+					},
+					want: 50 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "metadata cache",
+			deviceConfig: metadataCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(160 * time.Millisecond),
+						Path:      "c",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(240 * time.Millisecond),
+						Path:      "b",
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(240 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "metadata cache invalidated by changes",
+			deviceConfig: metadataCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Op:        "rename",
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(160 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Op:        "chmod",
+						Timestamp: startTime.Add(240 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(320 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Op:        "unlink",
+						Timestamp: startTime.Add(400 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(480 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Op:        "getxattr",
+						Timestamp: startTime.Add(560 * time.Millisecond),
+						Path:      "c",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(640 * time.Millisecond),
+						Path:      "a/b",
+					},
+					want: 0,
+				},
+			},
+		},
+		{
+			desc:         "stat without metadata cache",
+			deviceConfig: basicDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "interleaved handles",
+			deviceConfig: basicDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(20 * time.Millisecond),
+						Path:      "a",
+						Start:     100,
+						Size:      1,
+						Handle:    2,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(40 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "a",
+						Start:     101,
+						Size:      1,
+						Handle:    2,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(60 * time.Millisecond),
+						Path:      "a",
+						Handle:    1,
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(140 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "interleaved sequential readers",
+			deviceConfig: basicDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(20 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+						Handle:    2,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(40 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "b",
+						Start:     1,
+						Size:      1,
+						Handle:    2,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(60 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      1,
+						Handle:    1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(70 * time.Millisecond),
+						Path:      "b",
+						Start:     2,
+						Size:      1,
+						Handle:    2,
+					},
+					want: 10 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "trigger after writes",
+			deviceConfig: triggerDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(200 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(200 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 300 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(500 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 300 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "block group crossings",
+			deviceConfig: blockGroupDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(30 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      2,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "a",
+						Start:     4,
+						Size:      2,
+					},
+					want: 21 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(71 * time.Millisecond),
+						Path:      "a",
+						Start:     6,
+						Size:      4,
+					},
+					want: 41 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "close leaves dirty data cached",
+			deviceConfig: writeBackCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(2000 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "flush on close",
+			deviceConfig: flushOnCloseDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 1090 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      CloseRequest,
+						Timestamp: startTime.Add(2000 * time.Millisecond),
+						Path:      "a",
+					},
+					want: 80 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "time to first byte",
+			deviceConfig: timeToFirstByteDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 220 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(220 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(230 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+					},
+					want: 220 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "per file fsync",
+			deviceConfig: writeBackCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "big",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+						Start:     0,
+						Size:      1,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(2000 * time.Millisecond),
+						Path:      "big",
+					},
+					want: 1010 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "global fsync",
+			deviceConfig: globalFsyncDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "big",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+						Start:     0,
+						Size:      1,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+					},
+					want: 1030 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(2000 * time.Millisecond),
+						Path:      "big",
+					},
+					want: 0,
+				},
+			},
+		},
+		{
+			desc:         "global write back cached fsync strategy",
+			deviceConfig: globalWriteBackCachedFsyncDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "big",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+						Start:     0,
+						Size:      1,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "small",
+					},
+					want: 1030 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(2000 * time.Millisecond),
+						Path:      "big",
+					},
+					want: 0,
+				},
+			},
+		},
+		{
+			desc:         "direct writes bypass the write back cache",
+			deviceConfig: writeBackCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "cached",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "direct",
+						Start:     0,
+						Size:      100,
+						Direct:    true,
+					},
+					want: 1010 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(1010 * time.Millisecond),
+						Path:      "direct",
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(1020 * time.Millisecond),
+						Path:      "cached",
+					},
+					want: 1010 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "metadata contends with data",
+			deviceConfig: writeBackCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 1010 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "b",
+					},
+					want: 1090 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "separate metadata queue",
+			deviceConfig: separateMetadataQueueDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 1010 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      MetadataRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "b",
+					},
+					want: 80 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      StatRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "c",
+					},
+					want: 160 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     100,
+						Size:      100,
+					},
+					want: 2010 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "pinned path latency",
+			deviceConfig: pathLatencyDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "slow/a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 50 * time.Millisecond,
+				},
+				{
+					// Other paths are modeled as usual, and still wait for the device.
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      100,
+					},
+					want: 1060 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "random and sequential throughput",
+			deviceConfig: randomThroughputDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      10,
+					},
+					want: 1010 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1010 * time.Millisecond),
+						Path:      "a",
+						Start:     10,
+						Size:      10,
+					},
+					want: 100 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(1110 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      10,
+					},
+					want: 510 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(1620 * time.Millisecond),
+						Path:      "b",
+						Start:     10,
+						Size:      10,
+					},
+					want: 100 * time.Millisecond,
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		for _, req := range c.requests {
+			if got, want := dc.computeTime(req.req), req.want; got != want {
+				t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req.req, got, want)
+			}
+			dc.execute(req.req)
+		}
+	}
+}
+
+func TestDeviceContext_TransientReadErrors(t *testing.T) {
+	cases := []struct {
+		desc    string
+		req     *Request
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			desc: "first read fails",
+			req: &Request{
+				Type:      ReadRequest,
+				Timestamp: startTime,
+				Path:      "a",
+				Start:     0,
+				Size:      1,
+			},
+			want:    20 * time.Millisecond,
+			wantErr: true,
+		},
+		{
+			desc: "retry succeeds after recovering",
+			req: &Request{
+				Type:      ReadRequest,
+				Timestamp: startTime.Add(20 * time.Millisecond),
+				Path:      "a",
+				Start:     0,
+				Size:      1,
+			},
+			want: 70 * time.Millisecond,
+		},
+		{
+			desc: "different offset fails",
+			req: &Request{
+				Type:      ReadRequest,
+				Timestamp: startTime.Add(90 * time.Millisecond),
+				Path:      "a",
+				Start:     1,
+				Size:      1,
+			},
+			want:    10 * time.Millisecond,
+			wantErr: true,
+		},
+		{
+			desc: "retry after ttl fails again",
+			req: &Request{
+				Type:      ReadRequest,
+				Timestamp: startTime.Add(time.Minute),
+				Path:      "a",
+				Start:     1,
+				Size:      1,
+			},
+			want:    20 * time.Millisecond,
+			wantErr: true,
+		},
+		{
+			desc: "writes are unaffected",
+			req: &Request{
+				Type:      WriteRequest,
+				Timestamp: startTime.Add(2 * time.Minute),
+				Path:      "a",
+				Start:     0,
+				Size:      1,
+			},
+			want: 20 * time.Millisecond,
+		},
+	}
+
+	dc := newDeviceContext(transientErrorDeviceConfig)
+	for _, c := range cases {
+		err := dc.checkTransientError(c.req)
+		if c.wantErr != (err != nil) {
+			t.Errorf("fail (%s) checkTransientError(%+v) = %v, want error: %t", c.desc, c.req, err, c.wantErr)
+		}
+		if got, want := dc.computeTime(c.req), c.want; got != want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, c.req, got, want)
+		}
+		dc.execute(c.req)
+	}
+}
+
+func TestDeviceContext_ReadAhead(t *testing.T) {
+	config := *basicDeviceConfig
+	config.ReadAheadBytes = 100 * units.Byte
+	// A read which misses seeks, taking 10ms plus 100ms for 10 bytes. A hit takes MetadataOpTime.
+	miss, hit := 110*time.Millisecond, config.MetadataOpTime
+
+	cases := []struct {
+		desc  string
+		at    time.Duration
+		start units.NumBytes
+		want  time.Duration
+	}{
+		{"first read", 0, 0, miss},
+		{"strided read after prefetching in spare time", 1110 * time.Millisecond, 20, hit},
+		{"next strided read", 1190 * time.Millisecond, 40, hit},
+		{"seek", 1270 * time.Millisecond, 500, miss},
+		{"window reset by seek", 1380 * time.Millisecond, 20, miss},
+	}
+
+	dc := newDeviceContext(&config)
+	for _, c := range cases {
+		req := &Request{Type: ReadRequest, Timestamp: startTime.Add(c.at), Path: "a", Start: c.start, Size: 10}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+		dc.execute(req)
+	}
+
+	// Closing the file drops what was prefetched.
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime.Add(10 * time.Second), Path: "a", Start: 0, Size: 10})
+	dc.execute(&Request{Type: CloseRequest, Timestamp: startTime.Add(20 * time.Second), Path: "a"})
+	req := &Request{Type: ReadRequest, Timestamp: startTime.Add(30 * time.Second), Path: "a", Start: 10, Size: 10}
+	if got := dc.computeTime(req); got == hit {
+		t.Errorf("computeTime(%+v) after close = %s, want a miss", req, got)
+	}
+}
+
+func TestDeviceContext_RPM(t *testing.T) {
+	config := *basicDeviceConfig
+	config.RPM = 7200
+	rotation := 4166666 * time.Nanosecond
+
+	cases := []struct {
+		desc string
+		req  *Request
+		want time.Duration
+	}{
+		{
+			desc: "seeking read",
+			req:  &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10},
+			want: 110*time.Millisecond + rotation,
+		},
+		{
+			desc: "sequential read still waits for the disk to turn",
+			req:  &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Second), Path: "a", Start: 10, Size: 10},
+			want: 100*time.Millisecond + rotation,
+		},
+		{
+			desc: "sequential write",
+			req:  &Request{Type: WriteRequest, Timestamp: startTime.Add(2 * time.Second), Path: "a", Start: 20, Size: 10},
+			want: 100*time.Millisecond + rotation,
+		},
+		{
+			desc: "metadata unaffected",
+			req:  &Request{Type: MetadataRequest, Timestamp: startTime.Add(3 * time.Second)},
+			want: config.MetadataOpTime,
+		},
+	}
+
+	dc := newDeviceContext(&config)
+	for _, c := range cases {
+		if got := dc.computeTime(c.req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, c.req, got, c.want)
+		}
+		dc.execute(c.req)
+	}
+}
+
+func TestDeviceContext_QueueDepth(t *testing.T) {
+	// Each read seeks, so takes 10ms plus 100ms to read 10 bytes.
+	readTime := 110 * time.Millisecond
+	queueDepth1 := *basicDeviceConfig
+	queueDepth1.QueueDepth = 1
+	queueDepth4 := *basicDeviceConfig
+	queueDepth4.QueueDepth = 4
+	oneAtATime := []time.Duration{readTime, 2 * readTime, 3 * readTime, 4 * readTime, 5 * readTime}
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		// Wanted times of four concurrent reads then a fifth.
+		want []time.Duration
+	}{
+		{"one at a time by default", basicDeviceConfig, oneAtATime},
+		{"queue depth 1", &queueDepth1, oneAtATime},
+		{"four in parallel", &queueDepth4, []time.Duration{readTime, readTime, readTime, readTime, 2 * readTime}},
 	}
 
 	for _, c := range cases {
 		dc := newDeviceContext(c.deviceConfig)
-		for _, req := range c.requests {
-			if got, want := dc.computeTime(req.req), req.want; got != want {
-				t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req.req, got, want)
+		for i, want := range c.want {
+			req := &Request{Type: ReadRequest, Timestamp: startTime, Path: fmt.Sprintf("file%d", i), Start: 0, Size: 10}
+			if got := dc.computeTime(req); got != want {
+				t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, want)
 			}
-			dc.execute(req.req)
+			dc.execute(req)
+		}
+	}
+
+	// An fsync waits for every request in flight, and the next request waits for the fsync.
+	dc := newDeviceContext(&queueDepth4)
+	for i := 0; i < 2; i++ {
+		dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: fmt.Sprintf("file%d", i), Size: 10 * (units.NumBytes(i) + 1)})
+	}
+	fsync := &Request{Type: FsyncRequest, Timestamp: startTime, Path: "file0"}
+	if got, want := dc.computeTime(fsync), 210*time.Millisecond; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", fsync, got, want)
+	}
+	dc.execute(fsync)
+	read := &Request{Type: ReadRequest, Timestamp: startTime, Path: "file2", Size: 10}
+	if got, want := dc.computeTime(read), 210*time.Millisecond+readTime; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", read, got, want)
+	}
+}
+
+func TestDeviceContext_MaxIOPS(t *testing.T) {
+	for _, size := range []units.NumBytes{512 * units.Byte, 64 * units.Kibibyte} {
+		dc := newDeviceContext(maxIOPSDeviceConfig)
+		// Sequential reads, each issued as soon as the last finishes, would take microseconds
+		// each if only bandwidth counted.
+		now := startTime
+		for i := 0; i < 1000; i++ {
+			req := &Request{Type: ReadRequest, Timestamp: now, Path: "a", Start: units.NumBytes(i) * size, Size: size}
+			now = now.Add(dc.computeTime(req))
+			dc.execute(req)
+		}
+		// The first second's worth is a burst, then 100 more complete each second.
+		if got, want := now.Sub(startTime), 9*time.Second; got < want || got > want+time.Second {
+			t.Errorf("1000 reads of %s took %s, want about %s", size, got, want)
+		}
+	}
+
+	// Metadata operations don't count.
+	dc := newDeviceContext(maxIOPSDeviceConfig)
+	for i := 0; i < 200; i++ {
+		dc.execute(&Request{Type: MetadataRequest, Timestamp: startTime})
+	}
+	req := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 512}
+	if got, limit := dc.computeTime(req), 200*maxIOPSDeviceConfig.MetadataOpTime+time.Second; got >= limit {
+		t.Errorf("read after metadata operations took %s, want less than %s", got, limit)
+	}
+}
+
+func TestDeviceContext_TooManyStreams(t *testing.T) {
+	// Interleaved sequential readers each avoid a seek while their cursors are tracked, and seek on
+	// every read once there are too many of them.
+	for _, streams := range []int{maxCursors, maxCursors + 1} {
+		dc := newDeviceContext(basicDeviceConfig)
+		seeks := 0
+		for start := units.NumBytes(0); start < 3; start++ {
+			for i := 0; i < streams; i++ {
+				req := &Request{Type: ReadRequest, Timestamp: startTime, Path: fmt.Sprint(i), Start: start, Size: 1, Handle: uint64(i + 1)}
+				if seek, _ := dc.seekDecision(req); seek {
+					seeks++
+				}
+				dc.execute(req)
+			}
+		}
+		want := streams
+		if streams > maxCursors {
+			want = 3 * streams
+		}
+		if seeks != want {
+			t.Errorf("%d interleaved streams seeked %d times, want %d", streams, seeks, want)
+		}
+	}
+}
+
+func TestDeviceContext_MetadataIOPS(t *testing.T) {
+	config := *basicDeviceConfig
+	config.MetadataOpTime = 10 * time.Millisecond
+	config.MetadataIOPS = 10
+
+	cases := []struct {
+		desc    string
+		reqType RequestType
+		at      time.Duration
+		want    time.Duration
+	}{
+		{"first op unthrottled", MetadataRequest, 0, 10 * time.Millisecond},
+		{"next op completes an interval later", OpenRequest, 0, 110 * time.Millisecond},
+		{"stats are throttled", StatRequest, 110 * time.Millisecond, 100 * time.Millisecond},
+		{"op after the interval unthrottled", MetadataRequest, 400 * time.Millisecond, 10 * time.Millisecond},
+	}
+
+	dc := newDeviceContext(&config)
+	for _, c := range cases {
+		req := &Request{Type: c.reqType, Timestamp: startTime.Add(c.at), Path: ""}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+		dc.execute(req)
+	}
+}
+
+func TestDeviceContext_InjectedErrors(t *testing.T) {
+	readErrors := *basicDeviceConfig
+	readErrors.ReadErrorRate = 1
+	writeErrors := *basicDeviceConfig
+	writeErrors.WriteErrorRate = 1
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		reqType      RequestType
+		wantErr      bool
+	}{
+		{"no errors by default", basicDeviceConfig, ReadRequest, false},
+		{"read fails", &readErrors, ReadRequest, true},
+		{"write unaffected by read error rate", &readErrors, WriteRequest, false},
+		{"write fails", &writeErrors, WriteRequest, true},
+		{"read unaffected by write error rate", &writeErrors, ReadRequest, false},
+		{"metadata never fails", &writeErrors, MetadataRequest, false},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		req := &Request{Type: c.reqType, Timestamp: startTime, Path: "a", Size: 1}
+		// Retrying doesn't help, unlike with transient errors.
+		for i := 0; i < 2; i++ {
+			if err := dc.checkErrors(req); c.wantErr != (err != nil) {
+				t.Errorf("fail (%s) checkErrors(%+v) = %v, want error: %t", c.desc, req, err, c.wantErr)
+			}
+		}
+	}
+}
+
+func TestDeviceContext_Corruption(t *testing.T) {
+	config := *basicDeviceConfig
+	config.CorruptionProbability = 1
+	dc := newDeviceContext(&config)
+	random, err := newRandomSources(1, nil)
+	if err != nil {
+		t.Fatalf("newRandomSources(1, nil) error: %s", err)
+	}
+	dc.setRandomSources(random)
+	var events []Event
+	dc.eventHandler = func(ev Event) { events = append(events, ev) }
+
+	read := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 100, Size: 10}
+	dc.chooseCorruption(read)
+	if len(read.CorruptOffsets) != 1 || read.CorruptOffsets[0] < 0 || read.CorruptOffsets[0] >= 10 {
+		t.Errorf("CorruptOffsets = %v, want one offset in [0, 10)", read.CorruptOffsets)
+	}
+	if len(events) != 1 || events[0].Type != CorruptionEvent {
+		t.Errorf("events = %v, want one %s event", events, CorruptionEvent)
+	}
+
+	// The same seed corrupts the same byte.
+	again := newDeviceContext(&config)
+	random, _ = newRandomSources(1, nil)
+	again.setRandomSources(random)
+	readAgain := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 100, Size: 10}
+	again.chooseCorruption(readAgain)
+	if !reflect.DeepEqual(readAgain.CorruptOffsets, read.CorruptOffsets) {
+		t.Errorf("CorruptOffsets with the same seed = %v, want %v", readAgain.CorruptOffsets, read.CorruptOffsets)
+	}
+
+	// With CorruptionBytes a run of consecutive bytes is, but no more than the read has.
+	for _, c := range []struct {
+		corruptionBytes int
+		wantLen         int
+	}{
+		{4, 4},
+		{20, 10},
+	} {
+		config := config
+		config.CorruptionBytes = c.corruptionBytes
+		dc := newDeviceContext(&config)
+		random, _ := newRandomSources(1, nil)
+		dc.setRandomSources(random)
+		read := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 100, Size: 10}
+		dc.chooseCorruption(read)
+		offsets := read.CorruptOffsets
+		if len(offsets) != c.wantLen || offsets[0] < 0 || offsets[len(offsets)-1] >= 10 {
+			t.Errorf("CorruptOffsets with CorruptionBytes %d = %v, want %d offsets in [0, 10)", c.corruptionBytes, offsets, c.wantLen)
+			continue
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] != offsets[i-1]+1 {
+				t.Errorf("CorruptOffsets with CorruptionBytes %d = %v, want consecutive offsets", c.corruptionBytes, offsets)
+				break
+			}
+		}
+	}
+
+	// Only reads with data are corrupted.
+	for _, req := range []*Request{
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Size: 10},
+		{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 0},
+	} {
+		dc.chooseCorruption(req)
+		if req.CorruptOffsets != nil {
+			t.Errorf("CorruptOffsets for %s of %d bytes = %v, want nil", req.Type, req.Size, req.CorruptOffsets)
+		}
+	}
+
+	// Without CorruptionProbability nothing is.
+	clean := newDeviceContext(basicDeviceConfig)
+	cleanRead := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Size: 10}
+	clean.chooseCorruption(cleanRead)
+	if cleanRead.CorruptOffsets != nil {
+		t.Errorf("CorruptOffsets without CorruptionProbability = %v, want nil", cleanRead.CorruptOffsets)
+	}
+}
+
+func TestDeviceContext_LyingFsync(t *testing.T) {
+	dc := newDeviceContext(lyingFsyncDeviceConfig)
+
+	write := &Request{
+		Type:      WriteRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     0,
+		Size:      100,
+	}
+	dc.execute(write)
+
+	fsync := &Request{
+		Type:      FsyncRequest,
+		Timestamp: startTime,
+		Path:      "a",
+	}
+	if got, want := dc.computeTime(fsync), 1*time.Millisecond; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", fsync, got, want)
+	}
+	dc.execute(fsync)
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(100); got != want {
+		t.Errorf("getUnwrittenBytes(a) after fsync = %d, want %d", got, want)
+	}
+
+	// The data only becomes durable once there is spare time to write it back.
+	dc.execute(&Request{
+		Type:      MetadataRequest,
+		Timestamp: startTime.Add(time.Hour),
+	})
+	if got, want := dc.writeBackCache.getUnwrittenBytes("a"), units.NumBytes(0); got != want {
+		t.Errorf("getUnwrittenBytes(a) after spare time = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_WriteBackCacheSaturates(t *testing.T) {
+	dc := newDeviceContext(saturatingCacheDeviceConfig)
+	size := 10 * units.Byte
+	fullSpeed := saturatingCacheDeviceConfig.WriteTime(size)
+
+	// Each write is issued as soon as the last finishes, without fsyncs.
+	now := startTime
+	var last time.Duration
+	for i := 0; i < 50; i++ {
+		req := &Request{Type: WriteRequest, Timestamp: now, Path: "a", Start: units.NumBytes(i) * size, Size: size}
+		opTime := dc.computeTime(req)
+		dirty := dc.writeBackCache.getTotalUnwrittenBytes()
+		switch {
+		case dirty+size <= saturatingCacheDeviceConfig.WriteBackHighWaterMark && opTime != 0:
+			t.Errorf("write %d with %s dirty took %s, want 0s under the high water mark", i, dirty, opTime)
+		case opTime < last:
+			t.Errorf("write %d with %s dirty took %s, less than the last write's %s", i, dirty, opTime, last)
+		case opTime > fullSpeed:
+			t.Errorf("write %d with %s dirty took %s, want at most %s", i, dirty, opTime, fullSpeed)
+		}
+		last = opTime
+		now = now.Add(opTime)
+		dc.execute(req)
+		if dirty := dc.writeBackCache.getTotalUnwrittenBytes(); dirty > saturatingCacheDeviceConfig.WriteBackCacheSize {
+			t.Errorf("after write %d, %s dirty, want at most %s", i, dirty, saturatingCacheDeviceConfig.WriteBackCacheSize)
+		}
+	}
+	// Once the cache is full, writes go as fast as the device writes.
+	if last != fullSpeed {
+		t.Errorf("write with saturated cache took %s, want %s", last, fullSpeed)
+	}
+}
+
+func TestDeviceContext_HardLinksShareWriteBackCache(t *testing.T) {
+	dc := newDeviceContext(writeBackCacheDeviceConfig)
+
+	// "a" and "b" are hard links to the same file.
+	dc.execute(&Request{
+		Type:      WriteRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Inode:     7,
+		Start:     0,
+		Size:      100,
+	})
+
+	otherFsync := &Request{
+		Type:      FsyncRequest,
+		Timestamp: startTime,
+		Path:      "c",
+		Inode:     8,
+	}
+	fsync := &Request{
+		Type:      FsyncRequest,
+		Timestamp: startTime,
+		Path:      "b",
+		Inode:     7,
+	}
+	want := dc.computeTime(otherFsync) + writeBackCacheDeviceConfig.WriteTime(100)
+	if got := dc.computeTime(fsync); got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", fsync, got, want)
+	}
+	dc.execute(fsync)
+	if got, want := dc.writeBackCache.getUnwrittenBytes(fileKey("a", 7)), units.NumBytes(0); got != want {
+		t.Errorf("unwritten bytes of a after fsync of b = %d, want %d", got, want)
+	}
+}
+
+func TestDeviceContext_LatencyHistogram(t *testing.T) {
+	histograms, err := slowfs.ParseLatencyHistograms(strings.NewReader("read 7ms 1"))
+	if err != nil {
+		t.Fatalf("ParseLatencyHistograms() error: %s", err)
+	}
+	config := *basicDeviceConfig
+	config.LatencyHistograms = histograms
+	dc := newDeviceContext(&config)
+
+	read := &Request{
+		Type:      ReadRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     0,
+		Size:      100,
+	}
+	if got, want := dc.computeTime(read), 7*time.Millisecond; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", read, got, want)
+	}
+
+	// Operations without a histogram are modeled as usual.
+	metadata := &Request{
+		Type:      MetadataRequest,
+		Timestamp: startTime,
+	}
+	if got, want := dc.computeTime(metadata), basicDeviceConfig.MetadataOpTime; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", metadata, got, want)
+	}
+}
+
+func TestSampledLatency_SamplesOnce(t *testing.T) {
+	histograms, err := slowfs.ParseLatencyHistograms(strings.NewReader("read 1ms 1\nread 2ms 1\nread 3ms 1"))
+	if err != nil {
+		t.Fatalf("ParseLatencyHistograms() error: %s", err)
+	}
+	req := &Request{Type: ReadRequest}
+	first := sampledLatency(req, histograms["read"], testRandom())
+	for i := 0; i < 100; i++ {
+		if got := sampledLatency(req, histograms["read"], testRandom()); got != first {
+			t.Fatalf("sampledLatency() = %s, previously %s", got, first)
+		}
+	}
+}
+
+func TestPathDepth(t *testing.T) {
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a/b", 2},
+		{"/a/b/c/", 3},
+	}
+	for _, c := range cases {
+		if got := pathDepth(c.path); got != c.want {
+			t.Errorf("pathDepth(%q) = %d, want %d", c.path, got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_MetadataPerComponentTime(t *testing.T) {
+	config := *basicDeviceConfig
+	config.MetadataPerComponentTime = 5 * time.Millisecond
+	dc := newDeviceContext(&config)
+
+	for _, req := range []*Request{
+		{Type: MetadataRequest, Timestamp: startTime, Path: "a/b/c"},
+		{Type: StatRequest, Timestamp: startTime, Path: "a/b/c"},
+	} {
+		if got, want := dc.computeTime(req), basicDeviceConfig.MetadataOpTime+15*time.Millisecond; got != want {
+			t.Errorf("computeTime(%+v) = %s, want %s", req, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_OpenDirTime(t *testing.T) {
+	withOpenDirTime := *basicDeviceConfig
+	withOpenDirTime.OpenDirTime = 5 * time.Millisecond
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		want         time.Duration
+	}{
+		{"defaults to metadata op time", basicDeviceConfig, basicDeviceConfig.MetadataOpTime},
+		{"open dir time", &withOpenDirTime, 5 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		req := &Request{
+			Type:      OpenDirRequest,
+			Timestamp: startTime,
+			Path:      "",
+			Size:      100000,
+		}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_ReaddirEntryTime(t *testing.T) {
+	withEntryTime := *basicDeviceConfig
+	withEntryTime.ReaddirEntryTime = 10 * time.Microsecond
+	withOpenDirTime := withEntryTime
+	withOpenDirTime.OpenDirTime = 5 * time.Millisecond
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		entries      units.NumBytes
+		want         time.Duration
+	}{
+		{"no entry time", basicDeviceConfig, 300000, basicDeviceConfig.MetadataOpTime},
+		{"empty directory", &withEntryTime, 0, basicDeviceConfig.MetadataOpTime},
+		{"small directory", &withEntryTime, 3, basicDeviceConfig.MetadataOpTime + 30*time.Microsecond},
+		{"large directory", &withEntryTime, 300000, basicDeviceConfig.MetadataOpTime + 3*time.Second},
+		{"with open dir time", &withOpenDirTime, 300000, 5*time.Millisecond + 3*time.Second},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		req := &Request{
+			Type:      OpenDirRequest,
+			Timestamp: startTime,
+			Path:      "",
+			Size:      c.entries,
+		}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+	}
+
+	// Each entry adds the same time, however large the directory gets.
+	dc := newDeviceContext(&withEntryTime)
+	prev := dc.computeTime(&Request{Type: OpenDirRequest, Timestamp: startTime})
+	for entries := units.NumBytes(50000); entries <= 500000; entries += 50000 {
+		got := dc.computeTime(&Request{Type: OpenDirRequest, Timestamp: startTime, Size: entries})
+		if step := got - prev; step != 50000*withEntryTime.ReaddirEntryTime {
+			t.Errorf("listing %d entries took %s longer than %d entries, want %s", entries, step, entries-50000, 50000*withEntryTime.ReaddirEntryTime)
+		}
+		prev = got
+	}
+}
+
+func TestDeviceContext_TraversalProfile(t *testing.T) {
+	cases := []struct {
+		profile string
+		entries units.NumBytes
+		want    time.Duration
+	}{
+		{"local", 0, 5 * time.Millisecond},
+		{"local", 1000, 5*time.Millisecond + 1*time.Millisecond},
+		{"nas", 1000, 50*time.Millisecond + 20*time.Millisecond},
+		{"wan", 1000, 200*time.Millisecond + 100*time.Millisecond},
+	}
+
+	for _, c := range cases {
+		config := *basicDeviceConfig
+		if err := config.ApplyTraversalProfile(c.profile); err != nil {
+			t.Fatalf("ApplyTraversalProfile(%s) = %s, want nil", c.profile, err)
+		}
+		dc := newDeviceContext(&config)
+		req := &Request{Type: OpenDirRequest, Timestamp: startTime, Size: c.entries}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s profile) listing %d entries takes %s, want %s", c.profile, c.entries, got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_NetworkLatency(t *testing.T) {
+	withNetworkLatency := *basicDeviceConfig
+	withNetworkLatency.NetworkLatency = 2 * time.Millisecond
+	withNetworkLatency.MetadataCacheSize = 10
+
+	requests := []*Request{
+		{Type: MetadataRequest, Timestamp: startTime, Path: "a"},
+		{Type: StatRequest, Timestamp: startTime, Path: "a"},
+		{Type: OpenRequest, Timestamp: startTime, Path: "a"},
+		{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10},
+		{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 10, Size: 10},
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 20, Size: 10},
+		{Type: FsyncRequest, Timestamp: startTime, Path: "a"},
+		{Type: CloseRequest, Timestamp: startTime, Path: "a"},
+	}
+	for _, req := range requests {
+		// Each request is computed from the same state on both devices.
+		without, with := newDeviceContext(basicDeviceConfig), newDeviceContext(&withNetworkLatency)
+		if got, want := with.computeTime(req), without.computeTime(req)+2*time.Millisecond; got != want {
+			t.Errorf("computeTime(%+v) with network latency = %s, want %s", req, got, want)
+		}
+	}
+
+	// Lookups served from the metadata cache don't go over the network.
+	dc := newDeviceContext(&withNetworkLatency)
+	stat := &Request{Type: StatRequest, Timestamp: startTime, Path: "a"}
+	dc.execute(stat)
+	stat = &Request{Type: StatRequest, Timestamp: startTime.Add(time.Hour), Path: "a"}
+	if got := dc.computeTime(stat); got != 0 {
+		t.Errorf("computeTime(%+v) of cached path = %s, want 0s", stat, got)
+	}
+
+	// The hard disk preset has no network latency, so its metadata operations take just
+	// MetadataOpTime.
+	hdd := newDeviceContext(&slowfs.HDD7200RpmDeviceConfig)
+	for _, req := range requests[:3] {
+		if got, want := hdd.computeTime(req), slowfs.HDD7200RpmDeviceConfig.MetadataOpTime; got != want {
+			t.Errorf("computeTime(%+v) on hard disk = %s, want %s", req, got, want)
+		}
+	}
+}
+
+func TestDeviceContext_MaxOpDelay(t *testing.T) {
+	capped := *basicDeviceConfig
+	capped.MaxOpDelay = 500 * time.Millisecond
+
+	cases := []struct {
+		desc string
+		req  *Request
+		want time.Duration
+	}{
+		{"huge read is capped", &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 1000}, 500 * time.Millisecond},
+		{"small read is unaffected", &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 1}, 20 * time.Millisecond},
+		{"metadata is unaffected", &Request{Type: MetadataRequest, Timestamp: startTime, Path: "a"}, 80 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(&capped)
+		if got := dc.computeTime(c.req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, c.req, got, c.want)
+		}
+	}
+
+	// Waiting for the device counts towards the cap too, and a capped read leaves the device busy
+	// only until the cap.
+	dc := newDeviceContext(&capped)
+	huge := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 1000}
+	dc.execute(huge)
+	if got, want := dc.busyUntil, startTime.Add(500*time.Millisecond); got != want {
+		t.Errorf("busyUntil after capped read = %s, want %s", got, want)
+	}
+	small := &Request{Type: ReadRequest, Timestamp: startTime.Add(100 * time.Millisecond), Path: "b", Start: 0, Size: 1}
+	if got, want := dc.computeTime(small), 420*time.Millisecond; got != want {
+		t.Errorf("computeTime(%+v) behind capped read = %s, want %s", small, got, want)
+	}
+}
+
+func TestDeviceContext_OpenTime(t *testing.T) {
+	withOpenTime := *basicDeviceConfig
+	withOpenTime.OpenTime = 15 * time.Millisecond
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		reqType      RequestType
+		want         time.Duration
+	}{
+		{"open defaults to metadata op time", basicDeviceConfig, OpenRequest, basicDeviceConfig.MetadataOpTime},
+		{"open time", &withOpenTime, OpenRequest, 15 * time.Millisecond},
+		{"other metadata unaffected by open time", &withOpenTime, MetadataRequest, basicDeviceConfig.MetadataOpTime},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		req := &Request{
+			Type:      c.reqType,
+			Timestamp: startTime,
+			Path:      "",
+		}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_MetadataOpTimes(t *testing.T) {
+	differentiated := *basicDeviceConfig
+	differentiated.OpenTime = 15 * time.Millisecond
+	differentiated.MetadataOpTimes = map[string]time.Duration{
+		"rename":  200 * time.Millisecond,
+		"unlink":  150 * time.Millisecond,
+		"getattr": 5 * time.Millisecond,
+		"open":    50 * time.Millisecond,
+	}
+
+	cases := []struct {
+		desc    string
+		reqType RequestType
+		op      string
+		want    time.Duration
+	}{
+		{"rename", MetadataRequest, "rename", 200 * time.Millisecond},
+		{"unlink", MetadataRequest, "unlink", 150 * time.Millisecond},
+		{"stat", StatRequest, "getattr", 5 * time.Millisecond},
+		{"chmod defaults to metadata op time", MetadataRequest, "chmod", basicDeviceConfig.MetadataOpTime},
+		{"no op defaults to metadata op time", MetadataRequest, "", basicDeviceConfig.MetadataOpTime},
+		{"open time takes precedence", OpenRequest, "open", 15 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(&differentiated)
+		req := &Request{
+			Type:      c.reqType,
+			Timestamp: startTime,
+			Op:        c.op,
+		}
+		if got := dc.computeTime(req); got != c.want {
+			t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req, got, c.want)
+		}
+	}
+}
+
+func TestDeviceContext_ApplyLatencyTarget(t *testing.T) {
+	cases := []struct {
+		desc   string
+		req    *Request
+		opTime time.Duration
+		want   time.Duration
+	}{
+		{"fast read is raised to target", &Request{Type: ReadRequest}, 20 * time.Millisecond, 50 * time.Millisecond},
+		{"read on target", &Request{Type: ReadRequest}, 50 * time.Millisecond, 50 * time.Millisecond},
+		{"slow read misses target", &Request{Type: ReadRequest}, 60 * time.Millisecond, 60 * time.Millisecond},
+		{"fast write is raised to target", &Request{Type: WriteRequest}, 0, 30 * time.Millisecond},
+		{"slow write misses target", &Request{Type: WriteRequest}, 110 * time.Millisecond, 110 * time.Millisecond},
+		{"slow write misses target again", &Request{Type: WriteRequest}, 31 * time.Millisecond, 31 * time.Millisecond},
+		{"no target for fsync", &Request{Type: FsyncRequest}, 1 * time.Millisecond, 1 * time.Millisecond},
+	}
+
+	dc := newDeviceContext(latencyTargetDeviceConfig)
+	for _, c := range cases {
+		if got, want := dc.applyLatencyTarget(c.req, c.opTime), c.want; got != want {
+			t.Errorf("fail (%s) applyLatencyTarget(%+v, %s) = %s, want %s", c.desc, c.req, c.opTime, got, want)
+		}
+	}
+
+	if got, want := dc.readTargetMisses, uint64(1); got != want {
+		t.Errorf("readTargetMisses = %d, want %d", got, want)
+	}
+	if got, want := dc.writeTargetMisses, uint64(2); got != want {
+		t.Errorf("writeTargetMisses = %d, want %d", got, want)
+	}
+
+	// Without targets latency is left alone.
+	dc = newDeviceContext(basicDeviceConfig)
+	if got, want := dc.applyLatencyTarget(&Request{Type: ReadRequest}, time.Millisecond), time.Millisecond; got != want {
+		t.Errorf("applyLatencyTarget without target = %s, want %s", got, want)
+	}
+}
+
+func TestDeviceContext_Drain(t *testing.T) {
+	dc := newDeviceContext(writeBackCacheDeviceConfig)
+	dc.execute(&Request{
+		Type:      WriteRequest,
+		Timestamp: startTime,
+		Path:      "a",
+		Start:     0,
+		Size:      100,
+	})
+
+	// The device is busy with a metadata request for the first 80ms, then has 20ms of spare time,
+	// enough to seek and write back 1 byte. The remaining 99 bytes need another seek.
+	dc.execute(&Request{
+		Type:      MetadataRequest,
+		Timestamp: startTime,
+	})
+	now := startTime.Add(100 * time.Millisecond)
+	if got, want := dc.drain(now), now.Add(1000*time.Millisecond); got != want {
+		t.Errorf("drain(%s) = %s, want %s", now, got, want)
+	}
+	if got, want := dc.writeBackCache.getTotalUnwrittenBytes(), units.NumBytes(0); got != want {
+		t.Errorf("getTotalUnwrittenBytes() after drain = %d, want %d", got, want)
+	}
+
+	// Without a write back cache there is nothing to drain.
+	dc = newDeviceContext(basicDeviceConfig)
+	if got, want := dc.drain(now), now; got != want {
+		t.Errorf("drain(%s) without write back cache = %s, want %s", now, got, want)
+	}
+}
+
+func TestDeviceContext_SeekDecision(t *testing.T) {
+	dc := newDeviceContext(basicDeviceConfig)
+	dc.lastAccessedFile = "a"
+	dc.firstUnseenByte = 10
+
+	cases := []struct {
+		req        *Request
+		wantSeek   bool
+		wantReason string
+	}{
+		{&Request{Type: ReadRequest, Path: "b", Start: 10}, true, `different file (last accessed "a")`},
+		{&Request{Type: ReadRequest, Path: "a", Start: 5}, true, "backward (offset 5, first unseen byte 10)"},
+		{&Request{Type: ReadRequest, Path: "a", Start: 14}, true, "beyond seek window (offset 14, first unseen byte 10, window 4B (4))"},
+		{&Request{Type: ReadRequest, Path: "a", Start: 12}, false, "sequential (offset 12, first unseen byte 10)"},
+		{&Request{Type: WriteRequest, Path: "a", Start: 0, Append: true}, false, "append"},
+	}
+
+	for _, c := range cases {
+		seek, reason := dc.seekDecision(c.req)
+		if seek != c.wantSeek || reason != c.wantReason {
+			t.Errorf("seekDecision(%+v) = %t, %q, want %t, %q", c.req, seek, reason, c.wantSeek, c.wantReason)
+		}
+	}
+}
+
+func TestDeviceContext_LatencyJitter(t *testing.T) {
+	config := *basicDeviceConfig
+	config.LatencyJitter = 0.1
+	opTimes := func(seed int64) []time.Duration {
+		dc := newDeviceContext(&config)
+		random, err := newRandomSources(seed, nil)
+		if err != nil {
+			t.Fatalf("newRandomSources(%d, nil) error: %s", seed, err)
 		}
+		dc.setRandomSources(random)
+		var times []time.Duration
+		for i := 0; i < 20; i++ {
+			req := &Request{Type: MetadataRequest, Timestamp: startTime, Path: "a"}
+			got := dc.computeTime(req)
+			// Computing the time again must not draw a different factor.
+			if again := dc.computeTime(req); again != got {
+				t.Errorf("computeTime(%+v) = %s then %s, want the same", req, got, again)
+			}
+			times = append(times, got)
+		}
+		return times
+	}
+
+	want := basicDeviceConfig.MetadataOpTime
+	lo, hi := time.Duration(float64(want)*0.9), time.Duration(float64(want)*1.1)
+	first := opTimes(1)
+	varied := false
+	for _, got := range first {
+		if got < lo || got > hi {
+			t.Errorf("jittered op time = %s, want between %s and %s", got, lo, hi)
+		}
+		if got != first[0] {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Errorf("op times = %v, want them to vary", first)
+	}
+	if second := opTimes(1); !reflect.DeepEqual(second, first) {
+		t.Errorf("op times with the same seed = %v, want %v", second, first)
 	}
 }
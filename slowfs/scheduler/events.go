@@ -0,0 +1,58 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import "time"
+
+// Types of Event.
+const (
+	// ThrottleStartEvent is sent when a write is first throttled because the write back cache
+	// holds DirtyBytes of dirty data.
+	ThrottleStartEvent = "throttle_start"
+	// ThrottleEndEvent is sent when a write is no longer throttled.
+	ThrottleEndEvent = "throttle_end"
+	// TriggerFiredEvent is sent when a Trigger's operation count reaches AfterOps, or on the
+	// first operation it counts if AfterOps is 0.
+	TriggerFiredEvent = "trigger_fired"
+	// CorruptionEvent is sent when a read returns corrupted data because of
+	// CorruptionProbability. Its detail gives the offsets in the file of the corrupted bytes.
+	CorruptionEvent = "corruption"
+	// CacheFullEvent is sent when a write first fills the write back cache to
+	// WriteBackCacheSize, so that writes go no faster than the device can write.
+	CacheFullEvent = "cache_full"
+	// NoSpaceEvent is sent when an operation fails with ENOSPC because the SimulatedCapacity is
+	// used up. Its detail gives how many bytes were needed.
+	NoSpaceEvent = "no_space"
+	// StallEvent is sent when an operation would have taken longer than MaxOpDelay, and was cut
+	// short. Its detail gives how long it would have taken.
+	StallEvent = "stall"
+)
+
+// Event records a significant change in the modeled device's state.
+type Event struct {
+	// Time is the modeled time the event happened at, which is when the request causing it was
+	// made.
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Path   string    `json:"path,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// emit passes ev to the event handler, if there is one.
+func (dc *deviceContext) emit(ev Event) {
+	if dc.eventHandler != nil {
+		dc.eventHandler(ev)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestDeviceContext_ThrottleEvents(t *testing.T) {
+	dc := newDeviceContext(dirtyThrottleDeviceConfig)
+	var events []Event
+	dc.eventHandler = func(ev Event) { events = append(events, ev) }
+
+	for _, req := range []*Request{
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 40},
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 40, Size: 20},
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 60, Size: 20},
+		{Type: FsyncRequest, Timestamp: startTime, Path: "a"},
+		{Type: WriteRequest, Timestamp: startTime.Add(time.Hour), Path: "a", Start: 80, Size: 10},
+	} {
+		dc.execute(req)
+	}
+
+	want := []Event{
+		{Time: startTime, Type: ThrottleStartEvent, Path: "a", Detail: "40B (40) dirty"},
+		{Time: startTime.Add(time.Hour), Type: ThrottleEndEvent, Path: "a"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got events %+v, want %+v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestDeviceContext_TriggerFiredEvent(t *testing.T) {
+	dc := newDeviceContext(triggerDeviceConfig)
+	var events []Event
+	dc.eventHandler = func(ev Event) { events = append(events, ev) }
+
+	for i := 0; i < 3; i++ {
+		dc.execute(&Request{
+			Type:      WriteRequest,
+			Timestamp: startTime.Add(time.Duration(i) * time.Second),
+			Path:      "a",
+			Start:     0,
+			Size:      1,
+		})
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got events %+v, want one", events)
+	}
+	if got, want := events[0].Type, TriggerFiredEvent; got != want {
+		t.Errorf("event type = %s, want %s", got, want)
+	}
+	if got, want := events[0].Time, startTime.Add(time.Second); !got.Equal(want) {
+		t.Errorf("event time = %s, want %s", got, want)
+	}
+}
+
+func TestDeviceContext_TriggerFiredEventAfterZeroOps(t *testing.T) {
+	config := *triggerDeviceConfig
+	config.Triggers = []slowfs.Trigger{{
+		Op:         "write",
+		AfterOps:   0,
+		ExtraDelay: map[string]time.Duration{"fsync": 200 * time.Millisecond},
+	}}
+	dc := newDeviceContext(&config)
+	var events []Event
+	dc.eventHandler = func(ev Event) { events = append(events, ev) }
+
+	for i := 0; i < 2; i++ {
+		dc.execute(&Request{Type: WriteRequest, Timestamp: startTime.Add(time.Duration(i) * time.Second), Path: "a", Size: 1})
+	}
+
+	if len(events) != 1 || events[0].Type != TriggerFiredEvent || !events[0].Time.Equal(startTime) {
+		t.Errorf("got events %+v, want %s on the first write", events, TriggerFiredEvent)
+	}
+}
+
+func TestDeviceContext_CacheFullEvent(t *testing.T) {
+	dc := newDeviceContext(saturatingCacheDeviceConfig)
+	var events []Event
+	dc.eventHandler = func(ev Event) {
+		if ev.Type == CacheFullEvent {
+			events = append(events, ev)
+		}
+	}
+
+	for _, req := range []*Request{
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 60},
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 60, Size: 60},
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 120, Size: 60},
+		{Type: FsyncRequest, Timestamp: startTime, Path: "a"},
+		{Type: WriteRequest, Timestamp: startTime.Add(time.Hour), Path: "a", Start: 180, Size: 10},
+		{Type: WriteRequest, Timestamp: startTime.Add(2 * time.Hour), Path: "a", Start: 190, Size: 100},
+	} {
+		dc.execute(req)
+	}
+
+	// Only writes which fill the cache after it had room send an event.
+	want := []time.Time{startTime, startTime.Add(2 * time.Hour)}
+	if len(events) != len(want) {
+		t.Fatalf("got events %+v, want %d", events, len(want))
+	}
+	for i := range want {
+		if !events[i].Time.Equal(want[i]) {
+			t.Errorf("event %d = %+v, want it at %s", i, events[i], want[i])
+		}
+	}
+}
+
+func TestDeviceContext_StallEvent(t *testing.T) {
+	config := *basicDeviceConfig
+	config.MaxOpDelay = 500 * time.Millisecond
+	dc := newDeviceContext(&config)
+	var events []Event
+	dc.eventHandler = func(ev Event) { events = append(events, ev) }
+
+	// The read takes over a second, but the metadata request which follows fits under the cap.
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 100})
+	dc.execute(&Request{Type: MetadataRequest, Timestamp: startTime.Add(time.Second), Path: "a"})
+
+	want := []Event{{Time: startTime, Type: StallEvent, Path: "a", Detail: "1.01s capped to 500ms"}}
+	if len(events) != len(want) || events[0] != want[0] {
+		t.Errorf("got events %+v, want %+v", events, want)
+	}
+}
+
+func TestScheduler_NoSpaceEvent(t *testing.T) {
+	config := *basicDeviceConfig
+	config.SimulatedCapacity = 100
+	s := New(&config)
+	var events []Event
+	s.SetEventHandler(func(ev Event) { events = append(events, ev) })
+
+	if !s.ReserveBytes("a", 60) {
+		t.Fatalf("ReserveBytes(a, 60B) = false, want true")
+	}
+	if s.ReserveBytes("a", 60) {
+		t.Errorf("ReserveBytes(a, 60B) with 40B free = true, want false")
+	}
+	if s.HasRoom("b", 41) {
+		t.Errorf("HasRoom(b, 41B) with 40B free = true, want false")
+	}
+	s.SetEventHandler(nil)
+
+	if len(events) != 2 || events[0].Type != NoSpaceEvent || events[0].Path != "a" || events[1].Path != "b" {
+		t.Errorf("got events %+v, want %s for a then b", events, NoSpaceEvent)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"cmp"
+	"slices"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strings"
+	"time"
+)
+
+// maxFileStats is how many files fileStats keeps statistics for. If there are more, the ones
+// which were delayed least are dropped, so many short-lived files don't make it grow without bound
+// while the files hit hardest are kept.
+const maxFileStats = 1024
+
+// FileStats is what the scheduler has done for requests on one file.
+type FileStats struct {
+	Path string
+	// Ops counts all requests on the file, including opens, closes and fsyncs.
+	Ops          uint64
+	Reads        uint64
+	Writes       uint64
+	BytesRead    units.NumBytes
+	BytesWritten units.NumBytes
+	// Delay is the total op time of the file's requests.
+	Delay time.Duration
+}
+
+// fileStats accumulates FileStats by Request.Path. It is only used from the scheduler's
+// goroutine.
+type fileStats struct {
+	files map[string]*FileStats
+}
+
+func newFileStats() *fileStats {
+	return &fileStats{files: make(map[string]*FileStats)}
+}
+
+func (fs *fileStats) record(req *Request, opTime time.Duration) {
+	if req.Path == "" {
+		return
+	}
+	st := fs.files[req.Path]
+	added := st == nil
+	if added {
+		st = &FileStats{Path: req.Path}
+		fs.files[req.Path] = st
+	}
+	st.Ops++
+	st.Delay += opTime
+	switch req.Type {
+	case ReadRequest:
+		st.Reads++
+		st.BytesRead += req.Size
+	case WriteRequest:
+		st.Writes++
+		st.BytesWritten += req.Size
+	}
+	if added {
+		fs.prune()
+	}
+}
+
+// prune drops the statistics of the least delayed files if there are more than maxFileStats.
+// Files which are still open may be dropped too, and start over if used again. Only a new file
+// can take the count over maxFileStats, so it sorts at most once per file.
+func (fs *fileStats) prune() {
+	if len(fs.files) <= maxFileStats {
+		return
+	}
+	for _, st := range fs.sorted()[maxFileStats:] {
+		delete(fs.files, st.Path)
+	}
+}
+
+// forget drops the statistics of the file at path, e.g. because it was deleted.
+func (fs *fileStats) forget(path string) {
+	delete(fs.files, path)
+}
+
+// rename moves the statistics of the file at oldPath, and of everything under it if it is a
+// directory, to newPath, dropping those of whatever newPath replaced.
+func (fs *fileStats) rename(oldPath, newPath string) {
+	var moved []*FileStats
+	for path, st := range fs.files {
+		if slowfs.PathHasPrefix(path, newPath) {
+			delete(fs.files, path)
+		}
+		if slowfs.PathHasPrefix(path, oldPath) {
+			delete(fs.files, path)
+			st.Path = newPath + strings.TrimPrefix(path, oldPath)
+			moved = append(moved, st)
+		}
+	}
+	for _, st := range moved {
+		fs.files[st.Path] = st
+	}
+}
+
+// sorted returns a copy of the statistics of every file, most delayed first.
+func (fs *fileStats) sorted() []FileStats {
+	files := make([]FileStats, 0, len(fs.files))
+	for _, st := range fs.files {
+		files = append(files, *st)
+	}
+	slices.SortFunc(files, func(a, b FileStats) int {
+		return cmp.Or(cmp.Compare(b.Delay, a.Delay), cmp.Compare(a.Path, b.Path))
+	})
+	return files
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStats(t *testing.T) {
+	fs := newFileStats()
+	fs.record(&Request{Type: OpenRequest, Path: "a"}, time.Millisecond)
+	fs.record(&Request{Type: ReadRequest, Path: "a", Size: 10}, 2*time.Millisecond)
+	fs.record(&Request{Type: ReadRequest, Path: "a", Size: 20}, 3*time.Millisecond)
+	fs.record(&Request{Type: WriteRequest, Path: "b", Size: 5}, 10*time.Millisecond)
+	fs.record(&Request{Type: MetadataRequest}, time.Second)
+
+	want := []FileStats{
+		{Path: "b", Ops: 1, Writes: 1, BytesWritten: 5, Delay: 10 * time.Millisecond},
+		{Path: "a", Ops: 3, Reads: 2, BytesRead: 30, Delay: 6 * time.Millisecond},
+	}
+	if got := fs.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted() = %+v, want %+v", got, want)
+	}
+
+	fs.forget("b")
+	if got := fs.sorted(); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("sorted() after forget(b) = %+v, want %+v", got, want[1:])
+	}
+}
+
+func TestFileStats_PrunesOnClose(t *testing.T) {
+	fs := newFileStats()
+	fs.record(&Request{Type: ReadRequest, Path: "hot"}, time.Second)
+	for i := 0; i < 2*maxFileStats; i++ {
+		path := fmt.Sprintf("tmp%d", i)
+		fs.record(&Request{Type: OpenRequest, Path: path}, time.Millisecond)
+		fs.record(&Request{Type: CloseRequest, Path: path}, time.Millisecond)
+	}
+
+	got := fs.sorted()
+	if len(got) != maxFileStats {
+		t.Errorf("kept statistics for %d files, want %d", len(got), maxFileStats)
+	}
+	if got[0].Path != "hot" {
+		t.Errorf("most delayed file = %s, want hot", got[0].Path)
+	}
+}
+
+func TestFileStats_PrunesWithoutClose(t *testing.T) {
+	fs := newFileStats()
+	fs.record(&Request{Type: ReadRequest, Path: "hot"}, time.Second)
+	for i := 0; i < 2*maxFileStats; i++ {
+		fs.record(&Request{Type: MetadataRequest, Path: fmt.Sprintf("stat%d", i)}, time.Millisecond)
+	}
+
+	got := fs.sorted()
+	if len(got) != maxFileStats {
+		t.Errorf("kept statistics for %d files, want %d", len(got), maxFileStats)
+	}
+	if got[0].Path != "hot" {
+		t.Errorf("most delayed file = %s, want hot", got[0].Path)
+	}
+}
+
+func TestFileStats_Rename(t *testing.T) {
+	fs := newFileStats()
+	fs.record(&Request{Type: ReadRequest, Path: "a", Size: 10}, time.Second)
+	fs.record(&Request{Type: ReadRequest, Path: "dir/b", Size: 20}, time.Millisecond)
+	fs.record(&Request{Type: ReadRequest, Path: "c", Size: 30}, time.Minute)
+	fs.record(&Request{Type: ReadRequest, Path: "ab", Size: 40}, time.Microsecond)
+
+	// Renaming over c drops its statistics; those of files merely sharing a prefix stay.
+	fs.rename("a", "c")
+	fs.rename("dir", "moved")
+	want := []FileStats{
+		{Path: "c", Ops: 1, Reads: 1, BytesRead: 10, Delay: time.Second},
+		{Path: "moved/b", Ops: 1, Reads: 1, BytesRead: 20, Delay: time.Millisecond},
+		{Path: "ab", Ops: 1, Reads: 1, BytesRead: 40, Delay: time.Microsecond},
+	}
+	if got := fs.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted() after renames = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduler_FileStats(t *testing.T) {
+	s := New(basicDeviceConfig)
+	s.Schedule(&Request{Type: OpenRequest, Timestamp: time.Now(), Path: "a"})
+	s.Schedule(&Request{Type: CloseRequest, Timestamp: time.Now(), Path: "a"})
+
+	files := s.FileStats()
+	if len(files) != 1 || files[0].Path != "a" || files[0].Ops != 2 {
+		t.Errorf("FileStats() = %+v, want 2 ops on a", files)
+	}
+	s.ForgetFile("a")
+	if files := s.FileStats(); len(files) != 0 {
+		t.Errorf("FileStats() after ForgetFile(a) = %+v, want none", files)
+	}
+}
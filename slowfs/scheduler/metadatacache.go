@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"container/list"
+	"slowfs/slowfs"
+)
+
+// metadataCache models the kernel's dentry and inode caches as an LRU set of paths. Looking up a
+// cached path doesn't need to touch the device.
+type metadataCache struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newMetadataCache(size int) *metadataCache {
+	return &metadataCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (mc *metadataCache) contains(path string) bool {
+	_, ok := mc.entries[path]
+	return ok
+}
+
+// touch marks path as most recently used, adding it and evicting the least recently used path if
+// the cache is full.
+func (mc *metadataCache) touch(path string) {
+	if e, ok := mc.entries[path]; ok {
+		mc.order.MoveToFront(e)
+		return
+	}
+	if mc.order.Len() >= mc.size {
+		oldest := mc.order.Back()
+		mc.order.Remove(oldest)
+		delete(mc.entries, oldest.Value.(string))
+	}
+	mc.entries[path] = mc.order.PushFront(path)
+}
+
+// forget drops path from the cache, along with everything under it if tree is set.
+func (mc *metadataCache) forget(path string, tree bool) {
+	if !tree {
+		if e, ok := mc.entries[path]; ok {
+			mc.order.Remove(e)
+			delete(mc.entries, path)
+		}
+		return
+	}
+	for p, e := range mc.entries {
+		if slowfs.PathHasPrefix(p, path) {
+			mc.order.Remove(e)
+			delete(mc.entries, p)
+		}
+	}
+}
+
+// clone returns a copy of mc which can be changed independently.
+func (mc *metadataCache) clone() *metadataCache {
+	c := newMetadataCache(mc.size)
+	for e := mc.order.Front(); e != nil; e = e.Next() {
+		path := e.Value.(string)
+		c.entries[path] = c.order.PushBack(path)
+	}
+	return c
+}
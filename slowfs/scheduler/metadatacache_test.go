@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import "testing"
+
+func TestMetadataCache(t *testing.T) {
+	mc := newMetadataCache(2)
+	mc.touch("a")
+	mc.touch("b")
+	// Using a again makes b the least recently used entry.
+	mc.touch("a")
+	mc.touch("c")
+
+	cases := []struct {
+		path string
+		want bool
+	}{{"a", true}, {"b", false}, {"c", true}, {"d", false}}
+	for _, c := range cases {
+		if got := mc.contains(c.path); got != c.want {
+			t.Errorf("contains(%s) = %t, want %t", c.path, got, c.want)
+		}
+	}
+}
+
+func TestMetadataCache_Forget(t *testing.T) {
+	mc := newMetadataCache(10)
+	for _, path := range []string{"a", "a/b", "a/b/c", "ab", "d"} {
+		mc.touch(path)
+	}
+
+	mc.forget("d", false)
+	mc.forget("a", true)
+	cases := []struct {
+		path string
+		want bool
+	}{{"a", false}, {"a/b", false}, {"a/b/c", false}, {"ab", true}, {"d", false}}
+	for _, c := range cases {
+		if got := mc.contains(c.path); got != c.want {
+			t.Errorf("contains(%s) after forgetting = %t, want %t", c.path, got, c.want)
+		}
+	}
+	// Forgotten entries free their space.
+	if got := mc.order.Len(); got != 1 {
+		t.Errorf("cache holds %d entries after forgetting, want 1", got)
+	}
+}
+
+func TestMetadataCache_Clone(t *testing.T) {
+	mc := newMetadataCache(2)
+	mc.touch("a")
+	mc.touch("b")
+
+	c := mc.clone()
+	c.touch("c")
+	if !mc.contains("a") || mc.contains("c") {
+		t.Errorf("touching a clone changed the original")
+	}
+	// The clone keeps the original's order, so a is the one evicted.
+	if c.contains("a") || !c.contains("b") || !c.contains("c") {
+		t.Errorf("clone after touching c contains a=%v b=%v c=%v, want false true true", c.contains("a"), c.contains("b"), c.contains("c"))
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// Model runs requests one at a time directly against the device model, without mounting or
+// reordering, for exploring how long operations take. Each request is made when the previous one
+// finishes, on a simulated clock starting at zero.
+type Model struct {
+	dc    *deviceContext
+	start time.Time
+	now   time.Time
+}
+
+// ModelState describes the device model between requests.
+type ModelState struct {
+	// Now is the simulated time since the model was created.
+	Now time.Duration
+	// BusyUntil is when the device finishes its current work, relative to the same start.
+	BusyUntil time.Duration
+	// DirtyBytes is how much data is waiting in the write back cache.
+	DirtyBytes units.NumBytes
+	// LastAccessedFile and FirstUnseenByte are where the device's head is.
+	LastAccessedFile string
+	FirstUnseenByte  units.NumBytes
+}
+
+// NewModel creates a Model of a device described by config.
+func NewModel(config *slowfs.DeviceConfig) *Model {
+	start := time.Unix(0, 0)
+	return &Model{
+		dc:    newDeviceContext(config),
+		start: start,
+		now:   start,
+	}
+}
+
+// Run makes req at the current simulated time, returning how long it takes and whether it fails,
+// and advances the clock until it finishes.
+func (m *Model) Run(req *Request) (time.Duration, error) {
+	req.Timestamp = m.now
+	err := m.dc.checkErrors(req)
+	if err == nil {
+		m.dc.chooseCorruption(req)
+	}
+	opTime := m.dc.applyLatencyTarget(req, m.dc.computeTime(req))
+	m.dc.execute(req)
+	m.now = m.now.Add(opTime)
+	return opTime, err
+}
+
+// Wait advances the simulated clock by d without making any requests, leaving the device idle.
+func (m *Model) Wait(d time.Duration) {
+	m.now = m.now.Add(d)
+}
+
+// State returns the current state of the device model.
+func (m *Model) State() ModelState {
+	state := ModelState{
+		Now:              m.now.Sub(m.start),
+		BusyUntil:        m.dc.busyUntil.Sub(m.start),
+		LastAccessedFile: m.dc.lastAccessedFile,
+		FirstUnseenByte:  m.dc.firstUnseenByte,
+	}
+	if state.BusyUntil < 0 {
+		state.BusyUntil = 0
+	}
+	if m.dc.writeBackCache != nil {
+		state.DirtyBytes = m.dc.writeBackCache.getTotalUnwrittenBytes()
+	}
+	return state
+}
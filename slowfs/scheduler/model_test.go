@@ -0,0 +1,50 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestModel(t *testing.T) {
+	m := NewModel(writeBackCacheDeviceConfig)
+
+	write := &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 100}
+	if opTime, err := m.Run(write); opTime != 0 || err != nil {
+		t.Errorf("Run(write) = %s, %v, want 0s, nil", opTime, err)
+	}
+	if got, want := m.State().DirtyBytes, 100*units.Byte; got != want {
+		t.Errorf("DirtyBytes after write = %s, want %s", got, want)
+	}
+
+	fsync := &Request{Type: FsyncRequest, Path: "a"}
+	if opTime, err := m.Run(fsync); opTime != 1010*time.Millisecond || err != nil {
+		t.Errorf("Run(fsync) = %s, %v, want 1.01s, nil", opTime, err)
+	}
+
+	m.Wait(time.Second)
+	state := m.State()
+	if got, want := state.Now, 2010*time.Millisecond; got != want {
+		t.Errorf("Now = %s, want %s", got, want)
+	}
+	if got, want := state.BusyUntil, 1010*time.Millisecond; got != want {
+		t.Errorf("BusyUntil = %s, want %s", got, want)
+	}
+	if got, want := state.DirtyBytes, 0*units.Byte; got != want {
+		t.Errorf("DirtyBytes after fsync = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Subsystems of the device model which make random choices, each with its own source of
+// randomness so that one can be varied while the others stay fixed.
+const (
+	// ErrorsRandom decides which reads and writes fail with errors.
+	ErrorsRandom = "errors"
+	// WriteBackRandom picks which files spare time write back goes to.
+	WriteBackRandom = "writeback"
+	// LatencyRandom samples op times from latency histograms.
+	LatencyRandom = "latency"
+	// CorruptionRandom decides which reads return corrupted data, and which byte is corrupted.
+	CorruptionRandom = "corruption"
+	// JitterRandom varies op times by up to LatencyJitter.
+	JitterRandom = "jitter"
+)
+
+// subsystemSeedOffsets are added to the global seed to give each subsystem a different sequence.
+var subsystemSeedOffsets = map[string]int64{
+	ErrorsRandom:     1,
+	WriteBackRandom:  2,
+	LatencyRandom:    3,
+	CorruptionRandom: 4,
+	JitterRandom:     5,
+}
+
+// randomSources holds a random number generator per subsystem.
+type randomSources struct {
+	errors     *rand.Rand
+	writeBack  *rand.Rand
+	latency    *rand.Rand
+	corruption *rand.Rand
+	jitter     *rand.Rand
+}
+
+// newRandomSources seeds each subsystem's generator with seed plus the subsystem's offset, unless
+// overrides gives the subsystem a seed of its own.
+func newRandomSources(seed int64, overrides map[string]int64) (*randomSources, error) {
+	for name := range overrides {
+		if _, ok := subsystemSeedOffsets[name]; !ok {
+			return nil, fmt.Errorf("unknown random subsystem %q, want one of %s", name, strings.Join(RandomSubsystems(), ", "))
+		}
+	}
+	source := func(name string) *rand.Rand {
+		if s, ok := overrides[name]; ok {
+			return rand.New(rand.NewSource(s))
+		}
+		return rand.New(rand.NewSource(seed + subsystemSeedOffsets[name]))
+	}
+	return &randomSources{
+		errors:     source(ErrorsRandom),
+		writeBack:  source(WriteBackRandom),
+		latency:    source(LatencyRandom),
+		corruption: source(CorruptionRandom),
+		jitter:     source(JitterRandom),
+	}, nil
+}
+
+// unseededRandomSources returns sources which differ from run to run.
+func unseededRandomSources() *randomSources {
+	rs, _ := newRandomSources(time.Now().UnixNano(), nil)
+	return rs
+}
+
+// RandomSubsystems returns the names of the subsystems which can be seeded separately.
+func RandomSubsystems() []string {
+	names := make([]string, 0, len(subsystemSeedOffsets))
+	for name := range subsystemSeedOffsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// testRandom returns a random source which is the same on every run.
+func testRandom() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
+func TestNewRandomSources(t *testing.T) {
+	draw := func(rs *randomSources) []int64 {
+		return []int64{rs.errors.Int63(), rs.writeBack.Int63(), rs.latency.Int63(), rs.corruption.Int63(), rs.jitter.Int63()}
+	}
+
+	a, err := newRandomSources(42, nil)
+	if err != nil {
+		t.Fatalf("newRandomSources(42, nil) error: %s", err)
+	}
+	b, _ := newRandomSources(42, nil)
+	first, second := draw(a), draw(b)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave %v then %v, want the same", first, second)
+	}
+	if first[0] == first[1] || first[1] == first[2] || first[2] == first[3] || first[3] == first[4] {
+		t.Errorf("subsystems drew %v, want them to differ", first)
+	}
+
+	// Overriding one subsystem's seed leaves the others alone.
+	c, err := newRandomSources(42, map[string]int64{ErrorsRandom: 7})
+	if err != nil {
+		t.Fatalf("newRandomSources() error: %s", err)
+	}
+	third := draw(c)
+	if third[0] == first[0] {
+		t.Errorf("errors drew %d with and without an override, want them to differ", third[0])
+	}
+	if !reflect.DeepEqual(third[1:], first[1:]) {
+		t.Errorf("other subsystems drew %v, want %v", third[1:], first[1:])
+	}
+
+	if _, err := newRandomSources(42, map[string]int64{"bogus": 1}); err == nil {
+		t.Errorf("newRandomSources() with unknown subsystem = nil error, want an error")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"sort"
+)
+
+// byteRange is the half-open range of bytes [start, end).
+type byteRange struct {
+	start units.NumBytes
+	end   units.NumBytes
+}
+
+// rangeSet is a set of bytes within a file, kept as sorted ranges which neither overlap nor touch.
+type rangeSet struct {
+	ranges []byteRange
+}
+
+// contains returns whether every byte in [start, end) is in the set.
+func (rs *rangeSet) contains(start, end units.NumBytes) bool {
+	if start >= end {
+		return true
+	}
+	// Find the last range starting at or before start.
+	i := sort.Search(len(rs.ranges), func(i int) bool { return rs.ranges[i].start > start }) - 1
+	return i >= 0 && rs.ranges[i].end >= end
+}
+
+// add adds every byte in [start, end) to the set.
+func (rs *rangeSet) add(start, end units.NumBytes) {
+	if start >= end {
+		return
+	}
+	// Ranges in [lo, hi) overlap or touch the new range, and get merged into it.
+	lo := sort.Search(len(rs.ranges), func(i int) bool { return rs.ranges[i].end >= start })
+	hi := sort.Search(len(rs.ranges), func(i int) bool { return rs.ranges[i].start > end })
+	if lo < hi {
+		if rs.ranges[lo].start < start {
+			start = rs.ranges[lo].start
+		}
+		if rs.ranges[hi-1].end > end {
+			end = rs.ranges[hi-1].end
+		}
+	}
+
+	merged := append(rs.ranges[:lo:lo], byteRange{start, end})
+	rs.ranges = append(merged, rs.ranges[hi:]...)
+}
+
+// clone returns a copy of rs which can be changed independently.
+func (rs *rangeSet) clone() *rangeSet {
+	return &rangeSet{ranges: append([]byteRange(nil), rs.ranges...)}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestRangeSet_Add(t *testing.T) {
+	cases := []struct {
+		desc string
+		adds []byteRange
+		want []byteRange
+	}{
+		{
+			desc: "disjoint",
+			adds: []byteRange{{20, 30}, {0, 10}},
+			want: []byteRange{{0, 10}, {20, 30}},
+		},
+		{
+			desc: "adjacent ranges merge",
+			adds: []byteRange{{0, 10}, {10, 20}},
+			want: []byteRange{{0, 20}},
+		},
+		{
+			desc: "overlapping",
+			adds: []byteRange{{0, 10}, {5, 15}},
+			want: []byteRange{{0, 15}},
+		},
+		{
+			desc: "bridging several ranges",
+			adds: []byteRange{{0, 5}, {10, 15}, {20, 25}, {30, 35}, {3, 22}},
+			want: []byteRange{{0, 25}, {30, 35}},
+		},
+		{
+			desc: "contained",
+			adds: []byteRange{{0, 20}, {5, 10}},
+			want: []byteRange{{0, 20}},
+		},
+		{
+			desc: "empty",
+			adds: []byteRange{{5, 5}},
+			want: nil,
+		},
+	}
+
+	for _, c := range cases {
+		var rs rangeSet
+		for _, r := range c.adds {
+			rs.add(r.start, r.end)
+		}
+		if !reflect.DeepEqual(rs.ranges, c.want) {
+			t.Errorf("fail (%s) ranges = %v, want %v", c.desc, rs.ranges, c.want)
+		}
+	}
+}
+
+func TestRangeSet_Contains(t *testing.T) {
+	var rs rangeSet
+	rs.add(0, 10)
+	rs.add(20, 30)
+
+	cases := []struct {
+		start units.NumBytes
+		end   units.NumBytes
+		want  bool
+	}{
+		{0, 10, true},
+		{2, 8, true},
+		{20, 30, true},
+		{5, 15, false},
+		{10, 20, false},
+		{5, 25, false},
+		{30, 31, false},
+		{15, 15, true},
+	}
+
+	for _, c := range cases {
+		if got := rs.contains(c.start, c.end); got != c.want {
+			t.Errorf("contains(%d, %d) = %t, want %t", c.start, c.end, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"maps"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// readAheadCache models the device prefetching data past the end of reads in spare time, so
+// later sequential reads of prefetched data are served from its cache without touching the disk.
+type readAheadCache struct {
+	deviceConfig *slowfs.DeviceConfig
+
+	// The prefetched window of each file being read.
+	windows map[string]readAheadWindow
+
+	// The file being prefetched, which is the last one read.
+	current string
+
+	// Spare time up to here has already been spent prefetching.
+	spentUntil time.Time
+}
+
+// readAheadWindow holds what has been prefetched of a file.
+type readAheadWindow struct {
+	// Bytes [start, end) have been read or prefetched.
+	start, end units.NumBytes
+	// Prefetching continues in spare time until end reaches target.
+	target units.NumBytes
+}
+
+func newReadAheadCache(config *slowfs.DeviceConfig) *readAheadCache {
+	return &readAheadCache{
+		deviceConfig: config,
+		windows:      make(map[string]readAheadWindow),
+	}
+}
+
+// contains returns whether all of req's data has been prefetched, once prefetching has used
+// spareTime more.
+func (rac *readAheadCache) contains(req *Request, spareTime time.Duration) bool {
+	w, ok := rac.windows[req.file()]
+	if !ok {
+		return false
+	}
+	end := w.end
+	if req.file() == rac.current && spareTime > 0 {
+		end = min(w.target, end+rac.deviceConfig.ReadableBytes(spareTime))
+	}
+	return req.Start >= w.start && req.Start+req.Size <= end
+}
+
+// read records that req was read, and that prefetching should continue ReadAheadBytes past it.
+// A read which starts outside the file's window seeks away from it, so the window starts over.
+func (rac *readAheadCache) read(req *Request) {
+	file := req.file()
+	end := req.Start + req.Size
+	w, ok := rac.windows[file]
+	if !ok || req.Start < w.start || req.Start > w.end {
+		w = readAheadWindow{start: req.Start, end: end}
+	}
+	w.end = max(w.end, end)
+	w.target = max(w.target, end+rac.deviceConfig.ReadAheadBytes)
+	rac.windows[file] = w
+	rac.current = file
+}
+
+// prefetch spends up to duration, the spare time until now, prefetching the current file,
+// returning how long it took and where prefetching left off.
+func (rac *readAheadCache) prefetch(duration time.Duration, now time.Time) (time.Duration, units.NumBytes) {
+	rac.spentUntil = now
+	w, ok := rac.windows[rac.current]
+	if !ok || w.end >= w.target {
+		return 0, w.end
+	}
+	numBytes := units.NumBytesMin(w.target-w.end, rac.deviceConfig.ReadableBytes(duration))
+	w.end += numBytes
+	rac.windows[rac.current] = w
+	return rac.deviceConfig.ReadTime(numBytes), w.end
+}
+
+// forget drops what has been prefetched of file, when it is closed or its data changes.
+func (rac *readAheadCache) forget(file string) {
+	delete(rac.windows, file)
+	if rac.current == file {
+		rac.current = ""
+	}
+}
+
+// clone returns a copy of rac which can be changed independently.
+func (rac *readAheadCache) clone() *readAheadCache {
+	c := *rac
+	c.windows = maps.Clone(rac.windows)
+	return &c
+}
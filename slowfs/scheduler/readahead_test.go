@@ -0,0 +1,64 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestReadAheadCache(t *testing.T) {
+	rac := newReadAheadCache(&slowfs.DeviceConfig{
+		ReadBytesPerSecond: 100 * units.Byte,
+		ReadAheadBytes:     50 * units.Byte,
+	})
+	rac.read(&Request{Type: ReadRequest, Path: "a", Start: 0, Size: 10})
+
+	// Prefetching stops ReadAheadBytes past the read, however much spare time there is.
+	if took, end := rac.prefetch(time.Second, startTime); took != 500*time.Millisecond || end != 60 {
+		t.Errorf("prefetch(1s) = %s, %d, want 500ms, 60", took, end)
+	}
+	if took, _ := rac.prefetch(time.Second, startTime); took != 0 {
+		t.Errorf("prefetch(1s) with nothing left to prefetch took %s, want 0", took)
+	}
+
+	cases := []struct {
+		desc  string
+		start units.NumBytes
+		size  units.NumBytes
+		want  bool
+	}{
+		{"prefetched", 10, 50, true},
+		{"past the window", 50, 20, false},
+		{"before the window", 0, 10, true},
+	}
+	for _, c := range cases {
+		req := &Request{Type: ReadRequest, Path: "a", Start: c.start, Size: c.size}
+		if got := rac.contains(req, 0); got != c.want {
+			t.Errorf("fail (%s) contains(%+v) = %t, want %t", c.desc, req, got, c.want)
+		}
+	}
+	if req := (&Request{Type: ReadRequest, Path: "b", Start: 0, Size: 1}); rac.contains(req, time.Second) {
+		t.Errorf("contains(%+v) = true for a file never read, want false", req)
+	}
+
+	c := rac.clone()
+	c.forget("a")
+	if !rac.contains(&Request{Type: ReadRequest, Path: "a", Start: 0, Size: 10}, 0) {
+		t.Errorf("forgetting a file in a clone changed the original")
+	}
+}
@@ -15,17 +15,25 @@
 package scheduler
 
 import (
+	"cmp"
 	"math"
+	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"strings"
 	"time"
 )
 
-// ReadWriteQueue reorders any requests that are close enough together in time if they would become
-// a sequential read or write by being reordered.
+// ReadWriteQueue reorders requests that are close enough together in time, according to the
+// SchedulerPolicy of the device serving them. By default, requests are reordered if they would
+// become a sequential read or write by being reordered.
 type readWriteQueue struct {
-	dc    *deviceContext
-	timer *time.Timer
-	queue []*requestData
+	// Returns the device which serves a request.
+	device func(req *Request) *deviceContext
+	timer  *time.Timer
+	queue  []*requestData
+
+	// Devices whose elevator is sweeping towards lower positions, for SCANSchedulerPolicy.
+	sweepingDown map[*deviceContext]bool
 }
 
 func newReadWriteQueue(dc *deviceContext) *readWriteQueue {
@@ -34,14 +42,21 @@ func newReadWriteQueue(dc *deviceContext) *readWriteQueue {
 	t := time.NewTimer(time.Hour)
 	t.Stop()
 	return &readWriteQueue{
-		dc:    dc,
-		timer: t,
-		queue: make([]*requestData, 0, 16),
+		device:       func(*Request) *deviceContext { return dc },
+		timer:        t,
+		queue:        make([]*requestData, 0, 16),
+		sweepingDown: make(map[*deviceContext]bool),
 	}
 }
 
 func (rwq *readWriteQueue) push(data *requestData) {
 	req := data.req
+	if rwq.device(req).deviceConfig.SchedulerPolicy != slowfs.SequentialSchedulerPolicy {
+		// Requests are served in the order they were made, or picked by the elevator when popped.
+		rwq.queue = append(rwq.queue, data)
+		return
+	}
+
 	reqByteEnd := req.Start + req.Size
 	var bestDiff units.NumBytes = math.MaxInt64
 	bestIdx := len(rwq.queue)
@@ -49,7 +64,7 @@ func (rwq *readWriteQueue) push(data *requestData) {
 		otherReq := rwq.queue[i].req
 
 		otherReqByteEnd := otherReq.Start + otherReq.Size
-		if otherReq.Path == req.Path && req.Start >= otherReqByteEnd {
+		if otherReq.file() == req.file() && req.Start >= otherReqByteEnd {
 			// Place after request other.
 			diff := req.Start - otherReqByteEnd
 			if diff < bestDiff {
@@ -59,11 +74,11 @@ func (rwq *readWriteQueue) push(data *requestData) {
 		}
 
 		// Don't insert before a request that was made really early.
-		if req.Timestamp.After(otherReq.Timestamp.Add(rwq.dc.deviceConfig.RequestReorderMaxDelay)) {
+		if req.Timestamp.After(otherReq.Timestamp.Add(rwq.device(req).deviceConfig.RequestReorderMaxDelay)) {
 			break
 		}
 
-		if otherReq.Path == req.Path && reqByteEnd <= otherReq.Start {
+		if otherReq.file() == req.file() && reqByteEnd <= otherReq.Start {
 			// Place before request other.
 			diff := otherReq.Start - reqByteEnd
 			if diff < bestDiff {
@@ -82,11 +97,57 @@ func (rwq *readWriteQueue) pop(curTime time.Time) *requestData {
 		return nil
 	}
 
-	item := rwq.queue[0]
-	rwq.queue = rwq.queue[1:]
+	i := 0
+	if rwq.device(rwq.queue[0].req).deviceConfig.SchedulerPolicy == slowfs.SCANSchedulerPolicy {
+		i = rwq.scanNext()
+	}
+	item := rwq.queue[i]
+	rwq.queue = append(rwq.queue[:i], rwq.queue[i+1:]...)
 	return item
 }
 
+// scanNext returns the index of the request the elevator of the device serving the front of the
+// queue reaches next. Only requests made within RequestReorderMaxDelay of the front one are
+// considered, so the front one waits for at most one sweep each way. The elevator carries on in
+// the direction it was going from the device's current position, ordering requests by file then
+// offset, and turns around when there is nothing left that way.
+func (rwq *readWriteQueue) scanNext() int {
+	dc := rwq.device(rwq.queue[0].req)
+	cutoff := rwq.queue[0].req.Timestamp.Add(dc.deviceConfig.RequestReorderMaxDelay)
+	for turns := 0; ; turns++ {
+		down := rwq.sweepingDown[dc]
+		best := -1
+		for i, data := range rwq.queue {
+			req := data.req
+			if req.Timestamp.After(cutoff) || rwq.device(req) != dc {
+				continue
+			}
+			fromHead := comparePositions(req.file(), req.Start, dc.lastAccessedFile, dc.firstUnseenByte)
+			if (down && fromHead >= 0) || (!down && fromHead < 0) {
+				continue
+			}
+			if best == -1 {
+				best = i
+				continue
+			}
+			fromBest := comparePositions(req.file(), req.Start, rwq.queue[best].req.file(), rwq.queue[best].req.Start)
+			if (down && fromBest > 0) || (!down && fromBest < 0) {
+				best = i
+			}
+		}
+		// The front request is always a candidate, so turning around once finds one.
+		if best != -1 || turns > 0 {
+			return max(best, 0)
+		}
+		rwq.sweepingDown[dc] = !down
+	}
+}
+
+// comparePositions orders positions on a device by file, then offset.
+func comparePositions(fileA string, offsetA units.NumBytes, fileB string, offsetB units.NumBytes) int {
+	return cmp.Or(strings.Compare(fileA, fileB), cmp.Compare(offsetA, offsetB))
+}
+
 func (rwq *readWriteQueue) scheduleResponse(curTime time.Time) {
 	if len(rwq.queue) == 0 {
 		return
@@ -110,5 +171,5 @@ func (rwq *readWriteQueue) ready(curTime time.Time) bool {
 // we may want to put ahead of that request need time to come in. So, we wait half the time that
 // the request on the head of the queue takes before saying it can be popped off.
 func (rwq *readWriteQueue) cutoffTime(req *Request) time.Time {
-	return req.Timestamp.Add(rwq.dc.computeTime(req) / 2)
+	return req.Timestamp.Add(rwq.device(req).computeTime(req) / 2)
 }
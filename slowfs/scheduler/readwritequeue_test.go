@@ -17,6 +17,8 @@ package scheduler
 import (
 	"fmt"
 	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
 	"testing"
 	"time"
 )
@@ -836,3 +838,97 @@ func TestReadWriteQueue_PushAndPop(t *testing.T) {
 		}
 	}
 }
+
+// popAll pushes every request to a queue served by dc, then pops them all, executing each on dc.
+// It returns the offsets served in order and the total seek time charged.
+func popAll(dc *deviceContext, pushes []*Request) ([]units.NumBytes, time.Duration) {
+	testRwq := newReadWriteQueue(dc)
+	for _, req := range pushes {
+		testRwq.push(&requestData{req, nil})
+	}
+	var offsets []units.NumBytes
+	var seekTime time.Duration
+	for len(testRwq.queue) > 0 {
+		data := testRwq.pop(startTime.Add(time.Hour))
+		offsets = append(offsets, data.req.Start)
+		seekTime += dc.computeSeekTime(data.req)
+		dc.execute(data.req)
+	}
+	return offsets, seekTime
+}
+
+func TestReadWriteQueue_SchedulerPolicies(t *testing.T) {
+	var shuffled []*Request
+	for _, offset := range []units.NumBytes{30, 0, 50, 10, 70, 20, 60, 40} {
+		shuffled = append(shuffled, &Request{
+			Type:      ReadRequest,
+			Timestamp: startTime,
+			Path:      "a",
+			Start:     offset,
+			Size:      10,
+		})
+	}
+
+	fifo := *basicDeviceConfig
+	fifo.SchedulerPolicy = slowfs.FIFOSchedulerPolicy
+	scan := *basicDeviceConfig
+	scan.SchedulerPolicy = slowfs.SCANSchedulerPolicy
+
+	fifoOffsets, fifoSeekTime := popAll(newDeviceContext(&fifo), shuffled)
+	if want := []units.NumBytes{30, 0, 50, 10, 70, 20, 60, 40}; !reflect.DeepEqual(fifoOffsets, want) {
+		t.Errorf("FIFO served offsets %v, want %v", fifoOffsets, want)
+	}
+	scanOffsets, scanSeekTime := popAll(newDeviceContext(&scan), shuffled)
+	if want := []units.NumBytes{0, 10, 20, 30, 40, 50, 60, 70}; !reflect.DeepEqual(scanOffsets, want) {
+		t.Errorf("SCAN served offsets %v, want %v", scanOffsets, want)
+	}
+	if got, want := fifoSeekTime, 80*time.Millisecond; got != want {
+		t.Errorf("FIFO seek time = %s, want %s", got, want)
+	}
+	if got, want := scanSeekTime, 10*time.Millisecond; got != want {
+		t.Errorf("SCAN seek time = %s, want %s", got, want)
+	}
+}
+
+func TestReadWriteQueue_SCAN(t *testing.T) {
+	scan := *basicDeviceConfig
+	scan.SchedulerPolicy = slowfs.SCANSchedulerPolicy
+
+	cases := []struct {
+		desc    string
+		head    units.NumBytes
+		pushes  []*Request
+		offsets []units.NumBytes
+	}{
+		{
+			desc: "sweeps up then back down",
+			head: 35,
+			pushes: []*Request{
+				{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 10, Size: 5},
+				{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 50, Size: 5},
+				{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 20, Size: 5},
+				{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 40, Size: 5},
+			},
+			offsets: []units.NumBytes{40, 50, 20, 10},
+		},
+		{
+			desc: "requests made after the window wait",
+			head: 0,
+			pushes: []*Request{
+				{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 50, Size: 5},
+				{Type: ReadRequest, Timestamp: startTime.Add(time.Second), Path: "a", Start: 10, Size: 5},
+				{Type: ReadRequest, Timestamp: startTime.Add(time.Second), Path: "a", Start: 20, Size: 5},
+			},
+			offsets: []units.NumBytes{50, 20, 10},
+		},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(&scan)
+		dc.lastAccessedFile = "a"
+		dc.firstUnseenByte = c.head
+		if got, _ := popAll(dc, c.pushes); !reflect.DeepEqual(got, c.offsets) {
+			t.Errorf("fail (%s) served offsets %v, want %v", c.desc, got, c.offsets)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strconv"
+	"time"
+)
+
+// ReplayTrace runs the requests in a CSV trace, as written by CSVTraceWriter, through a fresh
+// model of the device described by config, and returns the total time they take.
+//
+// Requests run one at a time in the order they were traced. The device is left idle between two
+// requests for as long as the trace shows it was between the first finishing and the second being
+// issued, so that write back gets the same spare time, but never for less than zero. This makes
+// the result deterministic, so that configs can be compared against exactly the same workload.
+func ReplayTrace(r io.Reader, config *slowfs.DeviceConfig) (time.Duration, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read trace header: %s", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"time", "type", "path", "offset", "size"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("trace has no %s column", name)
+		}
+	}
+	_, hasDelay := columns["delay_ns"]
+
+	m := NewModel(config)
+	var total time.Duration
+	// When the previous request was issued, and how long it took, in the trace.
+	var lastIssued time.Time
+	var lastDelay time.Duration
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("couldn't read trace: %s", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		issued, err := time.Parse(time.RFC3339Nano, record[columns["time"]])
+		if err != nil {
+			return 0, fmt.Errorf("line %d: invalid time %q", line, record[columns["time"]])
+		}
+		req, err := parseTraceRequest(record, columns)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %s", line, err)
+		}
+		var delay time.Duration
+		if hasDelay {
+			ns, err := strconv.ParseInt(record[columns["delay_ns"]], 10, 64)
+			if err != nil || ns < 0 {
+				return 0, fmt.Errorf("line %d: invalid delay %q", line, record[columns["delay_ns"]])
+			}
+			delay = time.Duration(ns)
+		}
+
+		if !lastIssued.IsZero() {
+			if idle := issued.Sub(lastIssued.Add(lastDelay)); idle > 0 {
+				m.Wait(idle)
+			}
+		}
+		lastIssued, lastDelay = issued, delay
+
+		// Requests which fail still take their time, just as when they were traced.
+		opTime, _ := m.Run(req)
+		total += opTime
+	}
+}
+
+// parseTraceRequest makes a Request from the type, path, offset and size in a trace record, and
+// the op and direct flag if the trace has those columns, since traces from before they were added
+// don't.
+func parseTraceRequest(record []string, columns map[string]int) (*Request, error) {
+	typ, err := parseRequestType(record[columns["type"]])
+	if err != nil {
+		return nil, err
+	}
+	offset, err := strconv.ParseInt(record[columns["offset"]], 10, 64)
+	if err != nil || offset < 0 {
+		return nil, fmt.Errorf("invalid offset %q", record[columns["offset"]])
+	}
+	size, err := strconv.ParseInt(record[columns["size"]], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid size %q", record[columns["size"]])
+	}
+	req := &Request{
+		Type:  typ,
+		Path:  record[columns["path"]],
+		Start: units.NumBytes(offset),
+		Size:  units.NumBytes(size),
+	}
+	if i, ok := columns["op"]; ok {
+		req.Op = record[i]
+	}
+	if i, ok := columns["direct"]; ok {
+		if req.Direct, err = strconv.ParseBool(record[i]); err != nil {
+			return nil, fmt.Errorf("invalid direct %q", record[i])
+		}
+	}
+	return req, nil
+}
+
+// parseRequestType parses a RequestType from its String form.
+func parseRequestType(s string) (RequestType, error) {
+	for rt := ReadRequest; rt < numRequestTypes; rt++ {
+		if rt.String() == s {
+			return rt, nil
+		}
+	}
+	return 0, errors.New("unknown request type " + strconv.Quote(s))
+}
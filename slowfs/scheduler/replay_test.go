@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"strings"
+	"testing"
+	"time"
+)
+
+const replayHeader = "time,type,path,offset,size,delay_ns,seek,error\n"
+
+func TestReplayTrace(t *testing.T) {
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		trace        string
+		want         time.Duration
+	}{
+		{
+			desc:         "empty trace",
+			deviceConfig: basicDeviceConfig,
+			trace:        "",
+			want:         0,
+		},
+		{
+			desc:         "header only",
+			deviceConfig: basicDeviceConfig,
+			trace:        replayHeader,
+			want:         0,
+		},
+		{
+			desc:         "sequential reads",
+			deviceConfig: basicDeviceConfig,
+			trace: replayHeader +
+				"2016-01-01T00:00:00Z,READ,a,0,100,1010000000,true,\n" +
+				"2016-01-01T00:00:01.01Z,READ,a,100,100,1000000000,false,\n",
+			want: 2010 * time.Millisecond,
+		},
+		{
+			desc:         "idle time writes back",
+			deviceConfig: writeBackCacheDeviceConfig,
+			trace: replayHeader +
+				"2016-01-01T00:00:00Z,WRITE,a,0,100,0,false,\n" +
+				"2016-01-01T00:00:05Z,METADATA,a,0,0,80000000,false,\n" +
+				"2016-01-01T00:00:05.08Z,FSYNC,a,0,0,0,false,\n",
+			want: 90 * time.Millisecond,
+		},
+		{
+			desc:         "no idle time",
+			deviceConfig: writeBackCacheDeviceConfig,
+			trace: replayHeader +
+				"2016-01-01T00:00:00Z,WRITE,a,0,100,0,false,\n" +
+				"2016-01-01T00:00:00Z,METADATA,a,0,0,80000000,false,\n" +
+				"2016-01-01T00:00:00.08Z,FSYNC,a,0,0,1010000000,false,\n",
+			want: 1090 * time.Millisecond,
+		},
+		{
+			desc:         "without delays",
+			deviceConfig: basicDeviceConfig,
+			trace: "type,path,offset,size,time\n" +
+				"METADATA,a,0,0,2016-01-01T00:00:00Z\n" +
+				"METADATA,b,0,0,2016-01-01T00:00:00Z\n",
+			want: 160 * time.Millisecond,
+		},
+		{
+			desc:         "metadata op times",
+			deviceConfig: metadataOpTimesDeviceConfig,
+			trace: "time,type,path,offset,size,op\n" +
+				"2016-01-01T00:00:00Z,METADATA,a,0,0,rename\n" +
+				"2016-01-01T00:00:00Z,METADATA,a,0,0,unlink\n",
+			want: 90 * time.Millisecond,
+		},
+		{
+			desc:         "direct writes bypass the write back cache",
+			deviceConfig: writeBackCacheDeviceConfig,
+			trace: "time,type,path,offset,size,direct\n" +
+				"2016-01-01T00:00:00Z,WRITE,a,0,100,false\n" +
+				"2016-01-01T00:00:00Z,WRITE,b,0,100,true\n",
+			want: 1010 * time.Millisecond,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := ReplayTrace(strings.NewReader(c.trace), c.deviceConfig)
+		if err != nil {
+			t.Errorf("%s: ReplayTrace() = _, %s, want nil", c.desc, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: ReplayTrace() = %s, want %s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestReplayTrace_Errors(t *testing.T) {
+	cases := []struct {
+		desc  string
+		trace string
+	}{
+		{"missing column", "time,type,path,offset\n"},
+		{"invalid time", replayHeader + "yesterday,READ,a,0,100,0,false,\n"},
+		{"unknown type", replayHeader + "2016-01-01T00:00:00Z,TRUNCATE,a,0,100,0,false,\n"},
+		{"invalid offset", replayHeader + "2016-01-01T00:00:00Z,READ,a,-1,100,0,false,\n"},
+		{"invalid size", replayHeader + "2016-01-01T00:00:00Z,READ,a,0,big,0,false,\n"},
+		{"invalid delay", replayHeader + "2016-01-01T00:00:00Z,READ,a,0,100,1s,false,\n"},
+		{"invalid direct", "time,type,path,offset,size,direct\n2016-01-01T00:00:00Z,WRITE,a,0,100,maybe\n"},
+		{"missing field", replayHeader + "2016-01-01T00:00:00Z,READ,a,0,100\n"},
+		{"bad quoting", replayHeader + "2016-01-01T00:00:00Z,READ,\"a,0,100,0,false,\n"},
+	}
+
+	for _, c := range cases {
+		if _, err := ReplayTrace(strings.NewReader(c.trace), basicDeviceConfig); err == nil {
+			t.Errorf("%s: ReplayTrace() = _, nil, want an error", c.desc)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package scheduler
 
 import (
 	"slowfs/slowfs/units"
+	"strconv"
 	"time"
 )
 
@@ -31,6 +32,14 @@ const (
 	FsyncRequest
 	AllocateRequest
 	MetadataRequest
+	// StatRequest is a metadata lookup, like stat or access, which can be served from the
+	// metadata cache.
+	StatRequest
+	// OpenDirRequest lists a directory. Its Size is the number of entries listed.
+	OpenDirRequest
+
+	// numRequestTypes is how many request types there are. New types go before it.
+	numRequestTypes
 )
 
 // String returns the string representation of RequestType
@@ -50,6 +59,10 @@ func (rt RequestType) String() string {
 		return "ALLOCATE"
 	case MetadataRequest:
 		return "METADATA"
+	case StatRequest:
+		return "STAT"
+	case OpenDirRequest:
+		return "OPENDIR"
 	default:
 		return "UNKNOWN"
 	}
@@ -62,4 +75,57 @@ type Request struct {
 	Path      string
 	Start     units.NumBytes
 	Size      units.NumBytes
+
+	// Op names the filesystem operation which made a metadata request, like "rename", which
+	// MetadataOpTimes can give a time of its own. Empty for other requests.
+	Op string
+
+	// Inode is the backing file's inode number, or 0 if unknown. When set, the device tracks the
+	// file by inode rather than by path, so hard links share dirty data and sequentiality.
+	Inode uint64
+
+	// Handle identifies the open file handle a read, write or close came through, or is 0 if
+	// unknown. Sequential access is also tracked per handle, so interleaved streams reading the
+	// same file don't look like seeks.
+	Handle uint64
+
+	// Append is set for writes to a file opened with O_APPEND. These always go to the end of the
+	// file, so they are sequential regardless of the offset they report.
+	Append bool
+
+	// Direct is set for writes to a file opened with O_DIRECT. These bypass the write back cache
+	// and take the full time to reach the media up-front, whatever the write strategy.
+	Direct bool
+
+	// CorruptOffsets is set by the scheduler, for a read which should silently return corrupted
+	// data, to the offsets within the read of the bytes to flip. The caller must apply it.
+	CorruptOffsets []int64
+
+	// Set for a read which retries one that recently failed with a transient error.
+	recovering bool
+
+	// Set by the scheduler, while tracing, for a request which was charged a seek.
+	chargedSeek bool
+
+	// The request's time sampled from a latency histogram, once latencySampled is set.
+	latencySample  time.Duration
+	latencySampled bool
+
+	// The factor the request's time is scaled by for LatencyJitter, once jittered is set.
+	jitterFactor float64
+	jittered     bool
+}
+
+// file returns the key the device tracks req's file under.
+func (req *Request) file() string {
+	return fileKey(req.Path, req.Inode)
+}
+
+// fileKey returns the key for the file at path with the given inode, which is 0 if unknown. Inode
+// keys start with a NUL byte, which can't appear in a path, so they never collide with path keys.
+func fileKey(path string, inode uint64) string {
+	if inode == 0 {
+		return path
+	}
+	return "\x00inode:" + strconv.FormatUint(inode, 10)
 }
@@ -17,41 +17,130 @@
 package scheduler
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
 	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"strings"
 	"time"
 )
 
 // Scheduler determines how long operations should take given a description of a physical medium.
+// It is safe for concurrent use: requests are handed to a single goroutine which owns the device
+// context and serves them one at a time.
 type Scheduler struct {
 	dc             *deviceContext
 	readWriteQueue *readWriteQueue
 	requests       chan *requestData
+
+	// Devices serving the paths under a prefix in place of dc, longest prefix first.
+	pathDevices []pathDevice
+
+	// Functions to run on the scheduler's goroutine, used for access to the device context from
+	// outside of the scheduler.
+	calls chan func()
+
+	// Records each request as it is executed, if set.
+	tracer Tracer
+
+	stats     *opStats
+	fileStats *fileStats
+
+	// Whether any device had a SimulatedCapacity when the scheduler was created.
+	simulatesCapacity bool
 }
 
 // New creates a new Scheduler using the given DeviceConfig to help compute how long requests
 // should take.
 func New(config *slowfs.DeviceConfig) *Scheduler {
+	return NewWithPathConfigs(config, nil)
+}
+
+// NewWithPathConfigs is like New, but the paths under each prefix in pathConfigs are served by a
+// device of their own, with its own timeline, using the config the prefix maps to. The longest
+// matching prefix applies, and the device using config serves all other paths.
+func NewWithPathConfigs(config *slowfs.DeviceConfig, pathConfigs map[string]*slowfs.DeviceConfig) *Scheduler {
 	dc := newDeviceContext(config)
 	scheduler := &Scheduler{
 		dc:             dc,
 		readWriteQueue: newReadWriteQueue(dc),
 		requests:       make(chan *requestData, 10),
+		calls:          make(chan func()),
+		stats:          newOpStats(),
+		fileStats:      newFileStats(),
+	}
+	for prefix, pathConfig := range pathConfigs {
+		scheduler.pathDevices = append(scheduler.pathDevices, pathDevice{
+			prefix: strings.Trim(prefix, "/"),
+			dc:     newDeviceContext(pathConfig),
+		})
+	}
+	slices.SortFunc(scheduler.pathDevices, func(a, b pathDevice) int {
+		return cmp.Or(cmp.Compare(len(b.prefix), len(a.prefix)), cmp.Compare(a.prefix, b.prefix))
+	})
+	for _, dc := range scheduler.devices() {
+		scheduler.simulatesCapacity = scheduler.simulatesCapacity || dc.deviceConfig.SimulatedCapacity > 0
+	}
+	scheduler.readWriteQueue.device = func(req *Request) *deviceContext {
+		return scheduler.device(req.Path)
 	}
 	go scheduler.serveRequests()
 	return scheduler
 }
 
+// pathDevice is a device serving the paths under prefix, from NewWithPathConfigs.
+type pathDevice struct {
+	prefix string
+	dc     *deviceContext
+}
+
+// device returns the device serving path, which is relative to the mount point.
+func (s *Scheduler) device(path string) *deviceContext {
+	for _, pd := range s.pathDevices {
+		if slowfs.PathHasPrefix(path, pd.prefix) {
+			return pd.dc
+		}
+	}
+	return s.dc
+}
+
+// devices returns every device, the one serving paths under no prefix first.
+func (s *Scheduler) devices() []*deviceContext {
+	devices := []*deviceContext{s.dc}
+	for _, pd := range s.pathDevices {
+		devices = append(devices, pd.dc)
+	}
+	return devices
+}
+
 type requestData struct {
 	req             *Request
-	responseChannel chan time.Duration
+	responseChannel chan response
+}
+
+// response is what the scheduler sends back for a request.
+type response struct {
+	opTime time.Duration
+	err    error
 }
 
 // Schedule schedules a new request and returns how long the request should take.
 // N.B. this can block.
 func (s *Scheduler) Schedule(req *Request) time.Duration {
-	ch := make(chan time.Duration, 1)
+	opTime, _ := s.ScheduleWithError(req)
+	return opTime
+}
+
+// ScheduleWithError is like Schedule, but also returns an error if the device model decided the
+// request should fail. Failed requests still take the returned amount of time.
+// N.B. this can block.
+func (s *Scheduler) ScheduleWithError(req *Request) (time.Duration, error) {
+	ch := make(chan response, 1)
 	s.requests <- &requestData{req, ch}
-	return <-ch
+	resp := <-ch
+	return resp.opTime, resp.err
 }
 
 // Main event loop to serve requests.
@@ -59,20 +148,19 @@ func (s *Scheduler) serveRequests() {
 	for {
 		select {
 		case reqData := <-s.requests:
-			req, resp := reqData.req, reqData.responseChannel
-			switch req.Type {
+			switch reqData.req.Type {
 			case ReadRequest, WriteRequest:
 				s.readWriteQueue.push(reqData)
 			default:
-				resp <- s.dc.computeTime(req)
-				s.dc.execute(req)
+				s.respond(reqData)
 			}
 		case <-s.readWriteQueue.responseChannel():
 			reqData := s.readWriteQueue.pop(time.Now())
 			if reqData != nil {
-				reqData.responseChannel <- s.dc.computeTime(reqData.req)
-				s.dc.execute(reqData.req)
+				s.respond(reqData)
 			}
+		case f := <-s.calls:
+			f()
 		}
 
 		// This needs to be called every loop, since executing a request can change how long a
@@ -80,3 +168,294 @@ func (s *Scheduler) serveRequests() {
 		s.readWriteQueue.scheduleResponse(time.Now())
 	}
 }
+
+// respond sends back how long a request takes, then executes it on the device.
+func (s *Scheduler) respond(reqData *requestData) {
+	req := reqData.req
+	dc := s.device(req.Path)
+	err := dc.checkErrors(req)
+	if err == nil {
+		dc.chooseCorruption(req)
+	}
+	opTime := dc.applyLatencyTarget(req, dc.computeTime(req))
+	reqData.responseChannel <- response{opTime, err}
+	if s.tracer != nil {
+		req.chargedSeek = dc.chargesSeek(req)
+		s.tracer.Trace(req, opTime, err)
+	}
+	s.stats.record(req, opTime)
+	s.fileStats.record(req, opTime)
+	dc.execute(req)
+}
+
+// do runs f on the scheduler's goroutine, where it can safely use the device context, and waits
+// for it to finish.
+func (s *Scheduler) do(f func()) {
+	done := make(chan struct{})
+	s.calls <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// SetTracer makes the scheduler record every request it executes with t. Passing nil stops
+// tracing; once SetTracer returns, the previous tracer will not be called again.
+func (s *Scheduler) SetTracer(t Tracer) {
+	s.do(func() {
+		s.tracer = t
+	})
+}
+
+// SetEventHandler makes the scheduler call h with every Event. h is called on the scheduler's
+// goroutine, so it must not block. Passing nil stops sending events.
+func (s *Scheduler) SetEventHandler(h func(Event)) {
+	s.do(func() {
+		for _, dc := range s.devices() {
+			dc.eventHandler = h
+		}
+	})
+}
+
+// SeedRandom makes the scheduler's random choices reproducible. Each subsystem, as listed by
+// RandomSubsystems, is seeded with seed plus a fixed offset, unless overrides gives it a seed of
+// its own. This allows e.g. varying error injection while keeping the rest of a run the same.
+func (s *Scheduler) SeedRandom(seed int64, overrides map[string]int64) error {
+	random, err := newRandomSources(seed, overrides)
+	if err != nil {
+		return err
+	}
+	s.do(func() {
+		for _, dc := range s.devices() {
+			dc.setRandomSources(random)
+		}
+	})
+	return nil
+}
+
+// SetSeekLogging turns logging of whether each read, write and allocation seeks, and why, on or
+// off.
+func (s *Scheduler) SetSeekLogging(enabled bool) {
+	s.do(func() {
+		for _, dc := range s.devices() {
+			dc.logSeeks = enabled
+		}
+	})
+}
+
+// LatencyTargetMisses returns how many reads and writes have taken longer than TargetReadLatency
+// and TargetWriteLatency respectively, on all devices.
+func (s *Scheduler) LatencyTargetMisses() (reads, writes uint64) {
+	s.do(func() {
+		for _, dc := range s.devices() {
+			reads += dc.readTargetMisses
+			writes += dc.writeTargetMisses
+		}
+	})
+	return reads, writes
+}
+
+// UpdateConfig validates config and, if it is valid, makes the scheduler use it for the requests
+// it serves from now on, keeping the state of the device. Requests already being served finish
+// as the old config decided. Devices serving path prefixes keep their own configs. A
+// SimulatedCapacity can't be turned on unless the scheduler was created with one, since the bytes
+// stored until then weren't counted.
+func (s *Scheduler) UpdateConfig(config *slowfs.DeviceConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.SimulatedCapacity > 0 && !s.simulatesCapacity {
+		return errors.New("SimulatedCapacity can't be turned on without remounting, since the bytes already stored weren't counted")
+	}
+	s.do(func() {
+		s.dc.setConfig(config, time.Now())
+	})
+	return nil
+}
+
+// Config returns the config in use by the device serving paths under no prefix, as last set by
+// New or UpdateConfig. It is safe to call from any goroutine.
+func (s *Scheduler) Config() *slowfs.DeviceConfig {
+	var config *slowfs.DeviceConfig
+	s.do(func() {
+		config = s.dc.deviceConfig
+	})
+	return config
+}
+
+// Drain writes back all data in the write back cache and returns how long from now that takes,
+// which is how long a clean shutdown should wait before the data is durable. Every device drains
+// at once, so this is as long as the slowest takes.
+func (s *Scheduler) Drain() time.Duration {
+	var d time.Duration
+	s.do(func() {
+		now := time.Now()
+		for _, dc := range s.devices() {
+			d = max(d, dc.drain(now).Sub(now))
+		}
+	})
+	return d
+}
+
+// Stats returns a snapshot of how many requests the scheduler has served, how much data they
+// moved and how long they took. It is safe to call from any goroutine.
+func (s *Scheduler) Stats() Stats {
+	var stats Stats
+	s.do(func() {
+		stats = s.stats.snapshot()
+		for _, dc := range s.devices() {
+			stats.PeakDirtyBytes += dc.peakDirtyBytes
+			if dc.writeBackCache != nil {
+				stats.DirtyBytes += dc.writeBackCache.getTotalUnwrittenBytes()
+			}
+			stats.Backlog = max(stats.Backlog, time.Until(dc.busyUntil))
+		}
+	})
+	return stats
+}
+
+// FileStats returns a snapshot of what the scheduler has done for each file, by the path requests
+// gave, with the most delayed files first. Files which have been forgotten, or were among the
+// least delayed when there were too many files, are left out. It is safe to call from any
+// goroutine.
+func (s *Scheduler) FileStats() []FileStats {
+	var files []FileStats
+	s.do(func() {
+		files = s.fileStats.sorted()
+	})
+	return files
+}
+
+// ForgetFile drops the statistics FileStats has for the file at path, which should be called when
+// the file is deleted.
+func (s *Scheduler) ForgetFile(path string) {
+	s.do(func() {
+		s.fileStats.forget(path)
+	})
+}
+
+// RenameFile moves the statistics FileStats has for the file at oldPath to newPath, which should
+// be called when the file is renamed.
+func (s *Scheduler) RenameFile(oldPath, newPath string) {
+	s.do(func() {
+		s.fileStats.rename(oldPath, newPath)
+	})
+}
+
+// Snapshot returns a copy of the device's current state, which Restore can later return it to.
+// Requests still waiting to be reordered are not part of the device's state.
+func (s *Scheduler) Snapshot() DeviceState {
+	var state DeviceState
+	s.do(func() {
+		for _, dc := range s.devices() {
+			copied := &deviceContext{}
+			copied.copyState(dc)
+			state.dcs = append(state.dcs, copied)
+		}
+	})
+	return state
+}
+
+// Restore returns the device to a state taken by Snapshot, on this scheduler or another using the
+// same config, so that different sequences of requests can be run from the same starting point.
+// It returns an error, leaving the devices alone, if state wasn't taken from a scheduler with as
+// many devices.
+func (s *Scheduler) Restore(state DeviceState) error {
+	var err error
+	s.do(func() {
+		devices := s.devices()
+		if len(state.dcs) != len(devices) {
+			err = fmt.Errorf("state has %d devices, scheduler has %d", len(state.dcs), len(devices))
+			return
+		}
+		for i, dc := range devices {
+			dc.copyState(state.dcs[i])
+		}
+	})
+	return err
+}
+
+// DirtyBytes returns how many bytes written to the file at path, with the given inode or 0 if
+// unknown, have not yet been written back to disk. This is always zero unless the write back cache
+// is in use.
+func (s *Scheduler) DirtyBytes(path string, inode uint64) units.NumBytes {
+	var dirty units.NumBytes
+	s.do(func() {
+		if dc := s.device(path); dc.writeBackCache != nil {
+			dirty = dc.writeBackCache.getUnwrittenBytes(fileKey(path, inode))
+		}
+	})
+	return dirty
+}
+
+// MarkDirty adds numBytes to the unwritten bytes of the file at path, with the given inode or 0 if
+// unknown, as if they had just been written through the mount. This allows starting out with a
+// warm write back cache. It returns an error if the write back cache is not in use on the device
+// serving path.
+func (s *Scheduler) MarkDirty(path string, inode uint64, numBytes units.NumBytes) error {
+	var err error
+	s.do(func() {
+		dc := s.device(path)
+		if dc.writeBackCache == nil {
+			err = errors.New("write back cache is not in use")
+			return
+		}
+		dc.writeBackCache.write(fileKey(path, inode), numBytes)
+		// Otherwise the data would be written back using idle time from before it was written.
+		dc.occupyAllLanes(latestTime(dc.busyUntil, time.Now()))
+	})
+	return err
+}
+
+// SimulatesCapacity returns whether any device had a SimulatedCapacity when the scheduler was
+// created, in which case the bytes stored should be reported with AddUsedBytes. It doesn't change
+// afterwards, even if UpdateConfig removes the capacity, so that it can be set again.
+func (s *Scheduler) SimulatesCapacity() bool {
+	return s.simulatesCapacity
+}
+
+// Usage returns the SimulatedCapacity of the device serving path, which is 0 if it has none, and
+// how many bytes are stored on it.
+func (s *Scheduler) Usage(path string) (capacity, used units.NumBytes) {
+	s.do(func() {
+		dc := s.device(path)
+		capacity, used = dc.deviceConfig.SimulatedCapacity, dc.usedBytes
+	})
+	return capacity, used
+}
+
+// HasRoom returns whether there is room for n more bytes within the SimulatedCapacity of the
+// device serving path, which there always is if it has none.
+func (s *Scheduler) HasRoom(path string, n units.NumBytes) bool {
+	var room bool
+	s.do(func() {
+		room = s.device(path).hasRoom(path, n, time.Now())
+	})
+	return room
+}
+
+// ReserveBytes adds n bytes to those stored on the device serving path if there is room for them
+// within its SimulatedCapacity, and returns whether there was. Checking and adding at once means
+// concurrent writers can't both take the last free bytes. Reservations that aren't used should be
+// given back with AddUsedBytes.
+func (s *Scheduler) ReserveBytes(path string, n units.NumBytes) bool {
+	reserved := false
+	s.do(func() {
+		dc := s.device(path)
+		if !dc.hasRoom(path, n, time.Now()) {
+			return
+		}
+		dc.usedBytes = max(dc.usedBytes+n, 0)
+		reserved = true
+	})
+	return reserved
+}
+
+// AddUsedBytes adds delta, which is negative when space is freed, to the bytes stored on the
+// device serving path. They never go below zero.
+func (s *Scheduler) AddUsedBytes(path string, delta units.NumBytes) {
+	s.do(func() {
+		dc := s.device(path)
+		dc.usedBytes = max(dc.usedBytes+delta, 0)
+	})
+}
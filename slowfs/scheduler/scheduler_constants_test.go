@@ -81,3 +81,330 @@ var notNiceNumbersDeviceConfig = &slowfs.DeviceConfig{
 	WriteStrategy:          slowfs.SimulateWrite,
 	MetadataOpTime:         80 * time.Millisecond,
 }
+
+var minFsyncIntervalDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MinFsyncInterval:       500 * time.Millisecond,
+}
+
+var transientErrorDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:                 4 * units.Byte,
+	SeekTime:                   10 * time.Millisecond,
+	ReadBytesPerSecond:         100 * units.Byte,
+	WriteBytesPerSecond:        100 * units.Byte,
+	AllocateBytesPerSecond:     1000 * units.Byte,
+	RequestReorderMaxDelay:     10 * time.Millisecond,
+	FsyncStrategy:              slowfs.NoFsync,
+	WriteStrategy:              slowfs.SimulateWrite,
+	MetadataOpTime:             80 * time.Millisecond,
+	TransientReadErrorRate:     1,
+	TransientErrorRecoveryTime: 50 * time.Millisecond,
+}
+
+var delayedAllocationDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	DelayedAllocation:      true,
+}
+
+var delayedAllocationNoFsyncDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	DelayedAllocation:      true,
+}
+
+var strictAtimeDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	AtimeMode:              slowfs.StrictAtime,
+}
+
+var relAtimeDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	AtimeMode:              slowfs.RelAtime,
+}
+
+var opTimesDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	ReadOpTime:             1 * time.Millisecond,
+	WriteOpTime:            2 * time.Millisecond,
+	FsyncOpTime:            3 * time.Millisecond,
+}
+
+var metadataOpTimesDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MetadataOpTimes:        map[string]time.Duration{"rename": 10 * time.Millisecond},
+}
+
+var coldWritePenaltyDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	ColdWritePenalty:       50 * time.Millisecond,
+}
+
+var dirtyThrottleDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	DirtyBackgroundBytes:   20 * units.Byte,
+	DirtyBytes:             50 * units.Byte,
+}
+
+var saturatingCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	WriteBackCacheSize:     100 * units.Byte,
+	WriteBackHighWaterMark: 50 * units.Byte,
+}
+
+var lyingFsyncDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	FsyncOpTime:            1 * time.Millisecond,
+	LyingFsync:             true,
+}
+
+var latencyTargetDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	TargetReadLatency:      50 * time.Millisecond,
+	TargetWriteLatency:     30 * time.Millisecond,
+}
+
+var metadataCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MetadataCacheSize:      2,
+}
+
+var triggerDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	Triggers: []slowfs.Trigger{{
+		Op:         "write",
+		AfterOps:   2,
+		ExtraDelay: map[string]time.Duration{"fsync": 200 * time.Millisecond},
+	}},
+}
+
+var blockGroupDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             1000 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	BlockGroupSize:         4 * units.Byte,
+	BlockGroupSeekTime:     1 * time.Millisecond,
+}
+
+var flushOnCloseDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	FlushOnClose:           true,
+}
+
+var timeToFirstByteDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	TimeToFirstByte:        200 * time.Millisecond,
+}
+
+var globalFsyncDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	GlobalFsync:            true,
+}
+
+var globalWriteBackCachedFsyncDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.GlobalWriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+}
+
+var separateMetadataQueueDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	SeparateMetadataQueue:  true,
+}
+
+var pathLatencyDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	PathLatencies: []slowfs.PathLatency{{
+		Pattern: "slow/*",
+		Latency: map[string]time.Duration{"read": 50 * time.Millisecond},
+	}},
+}
+
+var maxIOPSDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Mebibyte,
+	WriteBytesPerSecond:    100 * units.Mebibyte,
+	AllocateBytesPerSecond: 100 * units.Mebibyte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MaxIOPS:                100,
+}
+
+var randomThroughputDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:                4 * units.Byte,
+	SeekTime:                  10 * time.Millisecond,
+	ReadBytesPerSecond:        100 * units.Byte,
+	WriteBytesPerSecond:       100 * units.Byte,
+	RandomReadBytesPerSecond:  10 * units.Byte,
+	RandomWriteBytesPerSecond: 20 * units.Byte,
+	AllocateBytesPerSecond:    1000 * units.Byte,
+	RequestReorderMaxDelay:    10 * time.Millisecond,
+	FsyncStrategy:             slowfs.NoFsync,
+	WriteStrategy:             slowfs.SimulateWrite,
+	MetadataOpTime:            80 * time.Millisecond,
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_MarkDirty(t *testing.T) {
+	s := New(writeBackCacheDeviceConfig)
+
+	if err := s.MarkDirty("a", 0, 1000); err != nil {
+		t.Fatalf("MarkDirty(a, 0, 1000) = %s, want nil", err)
+	}
+	if got, want := s.DirtyBytes("a", 0), 1000*units.Byte; got != want {
+		t.Errorf("DirtyBytes(a) = %s, want %s", got, want)
+	}
+	if got, want := s.DirtyBytes("b", 0), 0*units.Byte; got != want {
+		t.Errorf("DirtyBytes(b) = %s, want %s", got, want)
+	}
+
+	req := &Request{
+		Type:      FsyncRequest,
+		Timestamp: time.Now(),
+		Path:      "a",
+	}
+	if got, want := s.Schedule(req), 10*time.Second+10*time.Millisecond; got != want {
+		t.Errorf("Schedule(%+v) = %s, want %s", req, got, want)
+	}
+	if got, want := s.DirtyBytes("a", 0), 0*units.Byte; got != want {
+		t.Errorf("DirtyBytes(a) after fsync = %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_MarkDirtyWithoutWriteBackCache(t *testing.T) {
+	s := New(basicDeviceConfig)
+
+	if err := s.MarkDirty("a", 0, 1000); err == nil {
+		t.Errorf("MarkDirty(a, 0, 1000) = nil, want an error")
+	}
+	if got, want := s.DirtyBytes("a", 0), 0*units.Byte; got != want {
+		t.Errorf("DirtyBytes(a) = %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_RestoreMismatchedState(t *testing.T) {
+	s := NewWithPathConfigs(writeBackCacheDeviceConfig, map[string]*slowfs.DeviceConfig{"fast": basicDeviceConfig})
+	if err := s.MarkDirty("a", 0, 1000); err != nil {
+		t.Fatalf("MarkDirty(a, 0, 1000) = %s, want nil", err)
+	}
+
+	for _, c := range []struct {
+		desc  string
+		state DeviceState
+	}{
+		{"zero value", DeviceState{}},
+		{"from a scheduler without path devices", New(writeBackCacheDeviceConfig).Snapshot()},
+	} {
+		if err := s.Restore(c.state); err == nil {
+			t.Errorf("Restore(%s) = nil, want an error", c.desc)
+		}
+		if got, want := s.DirtyBytes("a", 0), 1000*units.Byte; got != want {
+			t.Errorf("DirtyBytes(a) after Restore(%s) = %s, want %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestScheduler_Usage(t *testing.T) {
+	if New(basicDeviceConfig).SimulatesCapacity() {
+		t.Errorf("SimulatesCapacity() without SimulatedCapacity = true, want false")
+	}
+
+	config := *basicDeviceConfig
+	config.SimulatedCapacity = 1000
+	s := NewWithPathConfigs(&config, map[string]*slowfs.DeviceConfig{"fast": basicDeviceConfig})
+	if !s.SimulatesCapacity() {
+		t.Errorf("SimulatesCapacity() = false, want true")
+	}
+
+	s.AddUsedBytes("a", 300)
+	s.AddUsedBytes("b", 200)
+	s.AddUsedBytes("fast/c", 100)
+	if capacity, used := s.Usage("a"); capacity != 1000 || used != 500 {
+		t.Errorf("Usage(a) = %s, %s, want 1000B, 500B", capacity, used)
+	}
+	if capacity, used := s.Usage("fast/d"); capacity != 0 || used != 100 {
+		t.Errorf("Usage(fast/d) = %s, %s, want 0B, 100B", capacity, used)
+	}
+
+	// Restoring a snapshot leaves the bytes stored alone, since the files are still there.
+	state := s.Snapshot()
+	s.AddUsedBytes("a", 100)
+	if err := s.Restore(state); err != nil {
+		t.Fatalf("Restore = %s, want nil", err)
+	}
+	if _, used := s.Usage("a"); used != 600 {
+		t.Errorf("Usage(a) after Restore = _, %s, want 600B", used)
+	}
+
+	// Freeing more than is used leaves nothing used.
+	s.AddUsedBytes("a", -700)
+	if _, used := s.Usage(""); used != 0 {
+		t.Errorf("Usage(root) after freeing more than used = _, %s, want 0B", used)
+	}
+
+	// Reservations are only taken if they fit.
+	if !s.ReserveBytes("a", 1000) {
+		t.Errorf("ReserveBytes(a, 1000B) with 1000B free = false, want true")
+	}
+	if s.ReserveBytes("a", 1) {
+		t.Errorf("ReserveBytes(a, 1B) when full = true, want false")
+	}
+	if _, used := s.Usage("a"); used != 1000 {
+		t.Errorf("Usage(a) after a refused reservation = _, %s, want 1000B", used)
+	}
+	if !s.ReserveBytes("fast/c", 1*units.Gibibyte) {
+		t.Errorf("ReserveBytes(fast/c, 1GiB) without SimulatedCapacity = false, want true")
+	}
+}
+
+func TestScheduler_Drain(t *testing.T) {
+	if got := New(writeBackCacheDeviceConfig).Drain(); got != 0 {
+		t.Errorf("Drain() with nothing dirty = %s, want 0s", got)
+	}
+
+	// Draining takes a seek plus the time to write back what is dirty.
+	for _, dirty := range []units.NumBytes{1000, 2000} {
+		s := New(writeBackCacheDeviceConfig)
+		if err := s.MarkDirty("a", 0, dirty); err != nil {
+			t.Fatalf("MarkDirty(a, 0, %d) = %s, want nil", dirty, err)
+		}
+		want := 10*time.Millisecond + time.Duration(dirty)*10*time.Millisecond
+		if got := s.Drain(); got != want {
+			t.Errorf("Drain() with %s dirty = %s, want %s", dirty, got, want)
+		}
+		if got, want := s.DirtyBytes("a", 0), 0*units.Byte; got != want {
+			t.Errorf("DirtyBytes(a) after Drain = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestScheduler_Stats(t *testing.T) {
+	s := New(writeBackCacheDeviceConfig)
+	if err := s.MarkDirty("a", 0, 1000); err != nil {
+		t.Fatalf("MarkDirty(a, 0, 1000) = %s, want nil", err)
+	}
+	s.Schedule(&Request{Type: MetadataRequest, Timestamp: time.Now(), Path: "a"})
+
+	stats := s.Stats()
+	if got, want := stats.Ops["metadata"], uint64(1); got != want {
+		t.Errorf("Ops[metadata] = %d, want %d", got, want)
+	}
+	if got, want := stats.DirtyBytes, 1000*units.Byte; got != want {
+		t.Errorf("DirtyBytes = %s, want %s", got, want)
+	}
+	// Schedule returns before the metadata operation's modeled time is up.
+	if got, limit := stats.Backlog, writeBackCacheDeviceConfig.MetadataOpTime; got <= 0 || got > limit {
+		t.Errorf("Backlog = %s, want more than 0 and at most %s", got, limit)
+	}
+
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "b", Size: 500})
+	if got, want := s.Stats().PeakDirtyBytes, 1500*units.Byte; got != want {
+		t.Errorf("PeakDirtyBytes = %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_UpdateConfig(t *testing.T) {
+	s := New(writeBackCacheDeviceConfig)
+	if err := s.MarkDirty("a", 0, 1000); err != nil {
+		t.Fatalf("MarkDirty(a, 0, 1000) = %s, want nil", err)
+	}
+
+	invalid := *basicDeviceConfig
+	invalid.SeekTime = -time.Second
+	if err := s.UpdateConfig(&invalid); err == nil {
+		t.Errorf("UpdateConfig(negative seek time) = nil, want an error")
+	}
+	if got, want := s.DirtyBytes("a", 0), 1000*units.Byte; got != want {
+		t.Errorf("DirtyBytes(a) after rejected update = %s, want %s", got, want)
+	}
+
+	// Without a write back cache, the dirty data has to be written back before anything else.
+	if err := s.UpdateConfig(basicDeviceConfig); err != nil {
+		t.Fatalf("UpdateConfig(basicDeviceConfig) = %s, want nil", err)
+	}
+	if err := s.MarkDirty("a", 0, 1000); err == nil {
+		t.Errorf("MarkDirty(a, 0, 1000) after update = nil, want an error")
+	}
+	req := &Request{Type: MetadataRequest, Timestamp: time.Now(), Path: "a"}
+	if got, atLeast := s.Schedule(req), 10*time.Second; got < atLeast {
+		t.Errorf("Schedule(%+v) = %s, want at least %s", req, got, atLeast)
+	}
+}
+
+func TestScheduler_UpdateConfigSimulatedCapacity(t *testing.T) {
+	withCapacity := *basicDeviceConfig
+	withCapacity.SimulatedCapacity = 1000
+
+	// Nothing counted the bytes stored so far, so the capacity can't be enforced.
+	s := New(basicDeviceConfig)
+	if err := s.UpdateConfig(&withCapacity); err == nil {
+		t.Errorf("UpdateConfig turning on SimulatedCapacity = nil, want an error")
+	}
+	if capacity, _ := s.Usage("a"); capacity != 0 {
+		t.Errorf("Usage(a) after rejected update = %s, _, want 0B", capacity)
+	}
+
+	// With a capacity from the start, the bytes stored stay counted while it is turned off.
+	s = New(&withCapacity)
+	s.AddUsedBytes("a", 600)
+	if err := s.UpdateConfig(basicDeviceConfig); err != nil {
+		t.Fatalf("UpdateConfig turning off SimulatedCapacity = %s, want nil", err)
+	}
+	if !s.SimulatesCapacity() {
+		t.Errorf("SimulatesCapacity() after turning it off = false, want true")
+	}
+	s.AddUsedBytes("a", 100)
+	if err := s.UpdateConfig(&withCapacity); err != nil {
+		t.Fatalf("UpdateConfig turning SimulatedCapacity back on = %s, want nil", err)
+	}
+	if capacity, used := s.Usage("a"); capacity != 1000 || used != 700 {
+		t.Errorf("Usage(a) = %s, %s, want 1000B, 700B", capacity, used)
+	}
+}
+
+func TestScheduler_PathConfigs(t *testing.T) {
+	fast := *basicDeviceConfig
+	fast.MetadataOpTime = time.Millisecond
+	slow := *basicDeviceConfig
+	slow.MetadataOpTime = 300 * time.Millisecond
+	s := NewWithPathConfigs(basicDeviceConfig, map[string]*slowfs.DeviceConfig{
+		"fast/":       &fast,
+		"/fast/slow/": &slow,
+	})
+
+	// Each device has its own timeline, so none of these wait behind the others.
+	cases := []struct {
+		path string
+		want time.Duration
+	}{
+		{"fast/slow/a", 300 * time.Millisecond},
+		{"fast/b", time.Millisecond},
+		{"faster/c", 80 * time.Millisecond},
+		{"d", 80*time.Millisecond + 80*time.Millisecond},
+	}
+	for _, c := range cases {
+		req := &Request{Type: MetadataRequest, Timestamp: time.Now(), Path: c.path}
+		if got := s.Schedule(req); got < c.want-10*time.Millisecond || got > c.want+10*time.Millisecond {
+			t.Errorf("Schedule(metadata %s) = %s, want %s", c.path, got, c.want)
+		}
+	}
+}
+
+func TestScheduler_SnapshotAndRestore(t *testing.T) {
+	s := New(writeBackCacheDeviceConfig)
+	if err := s.MarkDirty("a", 0, 1000); err != nil {
+		t.Fatalf("MarkDirty(a, 0, 1000) = %s, want nil", err)
+	}
+	state := s.Snapshot()
+
+	// Running the same fsync from the same starting point takes the same time every time, however
+	// the device was used in between.
+	for i := 0; i < 2; i++ {
+		req := &Request{Type: FsyncRequest, Timestamp: time.Now(), Path: "a"}
+		if got, want := s.Schedule(req), 10*time.Second+10*time.Millisecond; got != want {
+			t.Errorf("run %d: Schedule(%+v) = %s, want %s", i, req, got, want)
+		}
+		if got, want := s.DirtyBytes("a", 0), 0*units.Byte; got != want {
+			t.Errorf("run %d: DirtyBytes(a) after fsync = %s, want %s", i, got, want)
+		}
+
+		if err := s.Restore(state); err != nil {
+			t.Fatalf("run %d: Restore = %s, want nil", i, err)
+		}
+		if got, want := s.DirtyBytes("a", 0), 1000*units.Byte; got != want {
+			t.Errorf("run %d: DirtyBytes(a) after Restore = %s, want %s", i, got, want)
+		}
+	}
+
+	// The snapshot can be restored on another scheduler with the same config.
+	other := New(writeBackCacheDeviceConfig)
+	if err := other.Restore(state); err != nil {
+		t.Fatalf("Restore on another scheduler = %s, want nil", err)
+	}
+	if got, want := other.DirtyBytes("a", 0), 1000*units.Byte; got != want {
+		t.Errorf("DirtyBytes(a) after Restore on another scheduler = %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_ConcurrentSchedule(t *testing.T) {
+	const numRequests = 200
+	// Reads are queued in real time for half as long as they take, so keep them quick.
+	config := *basicDeviceConfig
+	config.SeekTime = time.Millisecond
+	config.ReadBytesPerSecond = 100 * units.Kilobyte
+	s := New(&config)
+
+	// Every read is of a different file, so each costs a seek plus 100 bytes at 100KB per second,
+	// and they all arrive at once. However they interleave, the device serves them one at a time,
+	// so the k-th served waits for the k-1 before it.
+	const cost = 2 * time.Millisecond
+	start := time.Now()
+	opTimes := make([]time.Duration, numRequests)
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opTimes[i] = s.Schedule(&Request{
+				Type:      ReadRequest,
+				Timestamp: start,
+				Path:      fmt.Sprintf("f%d", i),
+				Size:      100,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(opTimes, func(i, j int) bool { return opTimes[i] < opTimes[j] })
+	for k, got := range opTimes {
+		if want := time.Duration(k+1) * cost; got != want {
+			t.Errorf("%d-th shortest read took %s, want %s", k+1, got, want)
+		}
+	}
+
+	var busyUntil time.Time
+	s.do(func() {
+		busyUntil = s.dc.busyUntil
+	})
+	if got, want := busyUntil.Sub(start), numRequests*cost; got != want {
+		t.Errorf("device busy for %s, want %s", got, want)
+	}
+}
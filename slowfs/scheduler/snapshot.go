@@ -0,0 +1,77 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"maps"
+	"slices"
+)
+
+// DeviceState is a copy of the device's modeled state: when it is busy until, which file and
+// offset it last accessed, what the write back cache holds, and its other per-file state and
+// counters. It is independent of the device it was taken from, so it can be restored any number
+// of times. It does not include the state of the scheduler's sources of randomness, which can be
+// reset with SeedRandom, or the bytes stored on the device, which follow the files actually in the
+// backing directory. With path configs, it has the state of every device.
+type DeviceState struct {
+	// Copies of the scheduler's devices, in the order of Scheduler.devices.
+	dcs []*deviceContext
+}
+
+// copyState replaces dc's modeled state with a copy of from's, leaving its config, logging, event
+// handler, sources of randomness and used bytes alone.
+func (dc *deviceContext) copyState(from *deviceContext) {
+	dc.firstUnseenByte = from.firstUnseenByte
+	dc.lastAccessedFile = from.lastAccessedFile
+	dc.opCounts = maps.Clone(from.opCounts)
+	dc.cursors = from.cursors.clone()
+	dc.busyUntil = from.busyUntil
+	dc.lanes = slices.Clone(from.lanes)
+	dc.metadataBusyUntil = from.metadataBusyUntil
+	dc.lastFsyncEnd = from.lastFsyncEnd
+	dc.lastMetadataEnd = from.lastMetadataEnd
+	dc.recentIOEnds = slices.Clone(from.recentIOEnds)
+	dc.throttling = from.throttling
+	dc.cacheFull = from.cacheFull
+	dc.peakDirtyBytes = from.peakDirtyBytes
+	dc.readTargetMisses = from.readTargetMisses
+	dc.writeTargetMisses = from.writeTargetMisses
+	dc.failedReads = maps.Clone(from.failedReads)
+	dc.unallocatedBytes = maps.Clone(from.unallocatedBytes)
+	dc.atimes = maps.Clone(from.atimes)
+	dc.mtimes = maps.Clone(from.mtimes)
+
+	dc.writtenRanges = make(map[string]*rangeSet, len(from.writtenRanges))
+	for path, written := range from.writtenRanges {
+		dc.writtenRanges[path] = written.clone()
+	}
+
+	dc.readAheadCache = nil
+	if from.readAheadCache != nil {
+		dc.readAheadCache = from.readAheadCache.clone()
+	}
+
+	dc.writeBackCache = nil
+	if from.writeBackCache != nil {
+		dc.writeBackCache = from.writeBackCache.clone()
+		if dc.random != nil {
+			dc.writeBackCache.random = dc.random.writeBack
+		}
+	}
+	dc.metadataCache = nil
+	if from.metadataCache != nil {
+		dc.metadataCache = from.metadataCache.clone()
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencySamples is how many of the most recent op times are kept per request type to compute
+// percentiles from.
+const latencySamples = 1024
+
+// DurationBuckets are the upper bounds of the buckets op times are counted in for
+// Stats.Durations.
+var DurationBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Stats is a snapshot of what the scheduler has done since it was created.
+type Stats struct {
+	// Ops counts requests by lowercased request type, e.g. "read".
+	Ops          map[string]uint64
+	BytesRead    units.NumBytes
+	BytesWritten units.NumBytes
+	// Latency has percentiles of the recent op times of each request type in Ops.
+	Latency map[string]LatencyPercentiles
+	// Durations counts all op times of each request type in Ops, by DurationBuckets.
+	Durations map[string]DurationHistogram
+	// DirtyBytes is how much data is in the write back cache, summed over all files.
+	DirtyBytes units.NumBytes
+	// PeakDirtyBytes is the most DirtyBytes has been after a write.
+	PeakDirtyBytes units.NumBytes
+	// Backlog is how long the device will take to finish the requests it has already been given.
+	Backlog time.Duration
+}
+
+// LatencyPercentiles summarizes a distribution of op times.
+type LatencyPercentiles struct {
+	P50, P90, P99 time.Duration
+}
+
+// DurationHistogram counts op times.
+type DurationHistogram struct {
+	// Buckets[i] counts the op times no longer than DurationBuckets[i], and longer than the
+	// previous bucket's bound. Op times longer than all of them are only counted in Count.
+	Buckets []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+func (h *DurationHistogram) record(opTime time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(DurationBuckets))
+	}
+	if i := sort.Search(len(DurationBuckets), func(i int) bool { return opTime <= DurationBuckets[i] }); i < len(DurationBuckets) {
+		h.Buckets[i]++
+	}
+	h.Count++
+	h.Sum += opTime
+}
+
+// opStats accumulates Stats. It is only used from the scheduler's goroutine.
+type opStats struct {
+	ops          map[string]uint64
+	bytesRead    units.NumBytes
+	bytesWritten units.NumBytes
+	// Ring buffers of recent op times, indexed by ops[name] % latencySamples.
+	latencies map[string][]time.Duration
+	durations map[string]*DurationHistogram
+}
+
+func newOpStats() *opStats {
+	return &opStats{
+		ops:       make(map[string]uint64),
+		latencies: make(map[string][]time.Duration),
+		durations: make(map[string]*DurationHistogram),
+	}
+}
+
+func (st *opStats) record(req *Request, opTime time.Duration) {
+	name := strings.ToLower(req.Type.String())
+	samples := st.latencies[name]
+	if len(samples) < latencySamples {
+		st.latencies[name] = append(samples, opTime)
+	} else {
+		samples[st.ops[name]%latencySamples] = opTime
+	}
+	st.ops[name]++
+	h := st.durations[name]
+	if h == nil {
+		h = &DurationHistogram{}
+		st.durations[name] = h
+	}
+	h.record(opTime)
+
+	switch req.Type {
+	case ReadRequest:
+		st.bytesRead += req.Size
+	case WriteRequest:
+		st.bytesWritten += req.Size
+	}
+}
+
+func (st *opStats) snapshot() Stats {
+	stats := Stats{
+		Ops:          make(map[string]uint64, len(st.ops)),
+		BytesRead:    st.bytesRead,
+		BytesWritten: st.bytesWritten,
+		Latency:      make(map[string]LatencyPercentiles, len(st.latencies)),
+		Durations:    make(map[string]DurationHistogram, len(st.durations)),
+	}
+	for name, h := range st.durations {
+		stats.Durations[name] = DurationHistogram{
+			Buckets: append([]uint64(nil), h.Buckets...),
+			Count:   h.Count,
+			Sum:     h.Sum,
+		}
+	}
+	for name, n := range st.ops {
+		stats.Ops[name] = n
+	}
+	for name, samples := range st.latencies {
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats.Latency[name] = LatencyPercentiles{
+			P50: percentile(sorted, 50),
+			P90: percentile(sorted, 90),
+			P99: percentile(sorted, 99),
+		}
+	}
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted, which must not be empty, using the nearest
+// rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
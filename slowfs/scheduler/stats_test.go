@@ -0,0 +1,74 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestOpStats(t *testing.T) {
+	st := newOpStats()
+	for i := 1; i <= 100; i++ {
+		st.record(&Request{Type: ReadRequest, Size: 10}, time.Duration(i)*time.Millisecond)
+	}
+	st.record(&Request{Type: WriteRequest, Size: 5}, time.Second)
+
+	stats := st.snapshot()
+	if got, want := stats.Ops["read"], uint64(100); got != want {
+		t.Errorf("Ops[read] = %d, want %d", got, want)
+	}
+	if got, want := stats.Ops["write"], uint64(1); got != want {
+		t.Errorf("Ops[write] = %d, want %d", got, want)
+	}
+	if got, want := stats.BytesRead, 1000*units.Byte; got != want {
+		t.Errorf("BytesRead = %s, want %s", got, want)
+	}
+	if got, want := stats.BytesWritten, 5*units.Byte; got != want {
+		t.Errorf("BytesWritten = %s, want %s", got, want)
+	}
+	want := LatencyPercentiles{P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond}
+	if got := stats.Latency["read"]; got != want {
+		t.Errorf("Latency[read] = %+v, want %+v", got, want)
+	}
+	want = LatencyPercentiles{P50: time.Second, P90: time.Second, P99: time.Second}
+	if got := stats.Latency["write"]; got != want {
+		t.Errorf("Latency[write] = %+v, want %+v", got, want)
+	}
+	reads := stats.Durations["read"]
+	if reads.Count != 100 || reads.Sum != 5050*time.Millisecond {
+		t.Errorf("Durations[read] count %d, sum %s, want 100, 5.05s", reads.Count, reads.Sum)
+	}
+	// 51ms to 100ms.
+	if got, want := reads.Buckets[9], uint64(50); got != want {
+		t.Errorf("Durations[read] bucket for %s = %d, want %d", DurationBuckets[9], got, want)
+	}
+}
+
+func TestOpStats_KeepsRecentLatencies(t *testing.T) {
+	st := newOpStats()
+	for i := 0; i < latencySamples; i++ {
+		st.record(&Request{Type: FsyncRequest}, time.Second)
+	}
+	for i := 0; i < latencySamples; i++ {
+		st.record(&Request{Type: FsyncRequest}, time.Millisecond)
+	}
+
+	want := LatencyPercentiles{P50: time.Millisecond, P90: time.Millisecond, P99: time.Millisecond}
+	if got := st.snapshot().Latency["fsync"]; got != want {
+		t.Errorf("Latency[fsync] = %+v, want %+v", got, want)
+	}
+}
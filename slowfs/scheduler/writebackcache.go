@@ -15,14 +15,17 @@
 package scheduler
 
 import (
+	"maps"
 	"math/rand"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"sort"
 	"time"
 )
 
 type writeBackCache struct {
-	// Records cached writes for files. Will be written back gradually or on fsync.
+	// Records cached writes for files, keyed as by Request.file. Will be written back gradually or
+	// on fsync.
 	unwrittenBytes map[string]units.NumBytes
 
 	// If a file is closed while still having writes not yet written back to disk,
@@ -31,22 +34,48 @@ type writeBackCache struct {
 	orphanedUnwrittenBytes units.NumBytes
 
 	deviceConfig *slowfs.DeviceConfig
+
+	// Chooses which files to write back in spare time.
+	random *rand.Rand
+
+	// For each file with unwritten data, the order in which it became dirty, used by
+	// OldestFirstWriteBack.
+	dirtiedAt  map[string]uint64
+	dirtyCount uint64
+
+	// The file last written back in spare time, used by RoundRobinWriteBack.
+	lastWrittenBack string
 }
 
-func newWriteBackCache(config *slowfs.DeviceConfig) *writeBackCache {
+func newWriteBackCache(config *slowfs.DeviceConfig, random *rand.Rand) *writeBackCache {
 	return &writeBackCache{
 		unwrittenBytes: make(map[string]units.NumBytes),
 		deviceConfig:   config,
+		random:         random,
+		dirtiedAt:      make(map[string]uint64),
 	}
 }
 
+// clone returns a copy of wbc which can be changed independently, sharing its config and source
+// of randomness.
+func (wbc *writeBackCache) clone() *writeBackCache {
+	c := *wbc
+	c.unwrittenBytes = maps.Clone(wbc.unwrittenBytes)
+	c.dirtiedAt = maps.Clone(wbc.dirtiedAt)
+	return &c
+}
+
 func (wbc *writeBackCache) close(path string) {
 	wbc.orphanedUnwrittenBytes += wbc.unwrittenBytes[path]
-	delete(wbc.unwrittenBytes, path)
+	wbc.clean(path)
 }
 
 func (wbc *writeBackCache) write(path string, numBytes units.NumBytes) {
 	if numBytes > 0 {
+		if _, ok := wbc.unwrittenBytes[path]; !ok {
+			wbc.dirtyCount++
+			wbc.dirtiedAt[path] = wbc.dirtyCount
+		}
 		wbc.unwrittenBytes[path] += numBytes
 	}
 }
@@ -56,34 +85,141 @@ func (wbc *writeBackCache) getUnwrittenBytes(path string) units.NumBytes {
 }
 
 func (wbc *writeBackCache) writeBackFile(path string) {
+	wbc.clean(path)
+}
+
+// clean forgets the file at path, once it has no unwritten data.
+func (wbc *writeBackCache) clean(path string) {
 	delete(wbc.unwrittenBytes, path)
+	delete(wbc.dirtiedAt, path)
 }
 
-func (wbc *writeBackCache) writeBack(duration time.Duration) {
-	// Choose random files to write back bytes for.
+// drain writes back everything in the cache and returns how long that takes.
+func (wbc *writeBackCache) drain() time.Duration {
+	duration := wbc.drainTime()
+	for path := range wbc.unwrittenBytes {
+		wbc.clean(path)
+	}
+	wbc.orphanedUnwrittenBytes = 0
+	return duration
+}
+
+// drainTime returns how long writing back everything in the cache takes. Each file, and the data
+// of closed files, needs a seek before its data can be written.
+func (wbc *writeBackCache) drainTime() time.Duration {
+	var duration time.Duration
+	for _, numBytes := range wbc.unwrittenBytes {
+		duration += wbc.deviceConfig.SeekTime + wbc.deviceConfig.WriteTime(numBytes)
+	}
+	if wbc.orphanedUnwrittenBytes > 0 {
+		duration += wbc.deviceConfig.SeekTime + wbc.deviceConfig.WriteTime(wbc.orphanedUnwrittenBytes)
+	}
+	return duration
+}
+
+func (wbc *writeBackCache) getTotalUnwrittenBytes() units.NumBytes {
+	total := wbc.orphanedUnwrittenBytes
+	for _, numBytes := range wbc.unwrittenBytes {
+		total += numBytes
+	}
+	return total
+}
+
+// throttledBytes returns how many bytes of a write of numBytes the writer has to wait to be written
+// back: those which would take the cache past DirtyBytes, or the share of the write given by how
+// far past WriteBackHighWaterMark towards WriteBackCacheSize it takes the cache, whichever is more.
+// Either way, writes slow down gradually the further past the limit they go.
+func (wbc *writeBackCache) throttledBytes(numBytes units.NumBytes) units.NumBytes {
+	var throttled units.NumBytes
+	dirty := wbc.getTotalUnwrittenBytes() + numBytes
+	if limit := wbc.deviceConfig.DirtyBytes; limit > 0 && dirty > limit {
+		throttled = dirty - limit
+	}
+	if size := wbc.deviceConfig.WriteBackCacheSize; size > 0 {
+		if over := dirty - wbc.deviceConfig.WriteBackHighWaterMark; over > 0 {
+			throttled = max(throttled, numBytes*over/(size-wbc.deviceConfig.WriteBackHighWaterMark))
+		}
+	}
+	return units.NumBytesMin(throttled, numBytes)
+}
+
+// backgroundWritableBytes returns how many bytes may be written back in spare time. Background
+// write back only brings the cache down to DirtyBackgroundBytes.
+func (wbc *writeBackCache) backgroundWritableBytes() units.NumBytes {
+	total := wbc.getTotalUnwrittenBytes()
+	if total <= wbc.deviceConfig.DirtyBackgroundBytes {
+		return 0
+	}
+	return total - wbc.deviceConfig.DirtyBackgroundBytes
+}
+
+// writeBackOrder returns the files with unwritten data in the order WriteBackOrder says to write
+// them back in.
+func (wbc *writeBackCache) writeBackOrder() []string {
 	paths := make([]string, 0, len(wbc.unwrittenBytes))
 	for path := range wbc.unwrittenBytes {
 		paths = append(paths, path)
 	}
+	// Sort first so that the order only depends on the files and the random source, not map order.
+	sort.Strings(paths)
+
+	switch wbc.deviceConfig.WriteBackOrder {
+	case slowfs.OldestFirstWriteBack:
+		sort.Slice(paths, func(i, j int) bool {
+			return wbc.dirtiedAt[paths[i]] < wbc.dirtiedAt[paths[j]]
+		})
+	case slowfs.LargestFirstWriteBack:
+		sort.SliceStable(paths, func(i, j int) bool {
+			return wbc.unwrittenBytes[paths[i]] > wbc.unwrittenBytes[paths[j]]
+		})
+	case slowfs.RoundRobinWriteBack:
+		// Start with the file after the one last written back, wrapping around.
+		i := sort.SearchStrings(paths, wbc.lastWrittenBack)
+		if i < len(paths) && paths[i] == wbc.lastWrittenBack {
+			i++
+		}
+		paths = append(append([]string(nil), paths[i:]...), paths[:i]...)
+	default:
+		sliceShuffle(paths, wbc.random)
+	}
+	return paths
+}
 
-	sliceShuffle(paths)
-	for _, path := range paths {
-		duration -= wbc.writeBackBytesForFile(path, duration)
+func (wbc *writeBackCache) writeBack(duration time.Duration) {
+	limit := wbc.backgroundWritableBytes()
+	if limit == 0 {
+		return
+	}
 
-		if duration <= 0 {
+	for _, path := range wbc.writeBackOrder() {
+		before := wbc.unwrittenBytes[path]
+		duration -= wbc.writeBackLimitedBytesForFile(path, duration, limit)
+		limit -= before - wbc.unwrittenBytes[path]
+		if wbc.unwrittenBytes[path] != before {
+			wbc.lastWrittenBack = path
+		}
+
+		if duration <= 0 || limit <= 0 {
 			break
 		}
 	}
 
-	if duration >= wbc.deviceConfig.SeekTime {
-		wbc.orphanedUnwrittenBytes -= units.NumBytesMin(wbc.orphanedUnwrittenBytes, wbc.computeWritableBytes(duration))
+	if duration >= wbc.deviceConfig.SeekTime && limit > 0 {
+		bytesToWrite := units.NumBytesMin(wbc.orphanedUnwrittenBytes, wbc.computeWritableBytes(duration))
+		wbc.orphanedUnwrittenBytes -= units.NumBytesMin(bytesToWrite, limit)
 	}
 
 }
 
 func (wbc *writeBackCache) writeBackBytesForFile(path string, duration time.Duration) time.Duration {
+	return wbc.writeBackLimitedBytesForFile(path, duration, wbc.unwrittenBytes[path])
+}
+
+// writeBackLimitedBytesForFile is like writeBackBytesForFile, but writes back at most limit bytes.
+func (wbc *writeBackCache) writeBackLimitedBytesForFile(path string, duration time.Duration, limit units.NumBytes) time.Duration {
 	var timeTaken time.Duration
 	bytesToWrite := units.NumBytesMin(wbc.unwrittenBytes[path], wbc.computeWritableBytes(duration))
+	bytesToWrite = units.NumBytesMin(bytesToWrite, limit)
 
 	if bytesToWrite != 0 {
 		timeTaken = wbc.deviceConfig.SeekTime + wbc.deviceConfig.WriteTime(bytesToWrite)
@@ -91,7 +227,7 @@ func (wbc *writeBackCache) writeBackBytesForFile(path string, duration time.Dura
 
 	wbc.unwrittenBytes[path] -= bytesToWrite
 	if wbc.unwrittenBytes[path] == 0 {
-		delete(wbc.unwrittenBytes, path)
+		wbc.clean(path)
 	}
 	return timeTaken
 }
@@ -102,9 +238,9 @@ func (wbc *writeBackCache) computeWritableBytes(duration time.Duration) units.Nu
 	return wbc.deviceConfig.WritableBytes(duration - wbc.deviceConfig.SeekTime)
 }
 
-func sliceShuffle(arr []string) {
+func sliceShuffle(arr []string, random *rand.Rand) {
 	for i := 0; i < len(arr); i++ {
-		idx := i + rand.Intn(len(arr)-i)
+		idx := i + random.Intn(len(arr)-i)
 		arr[i], arr[idx] = arr[idx], arr[i]
 	}
 }
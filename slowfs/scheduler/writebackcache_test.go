@@ -30,7 +30,7 @@ func TestWriteBackCache_Write(t *testing.T) {
 		want     units.NumBytes
 	}{{"a", 101, 101}, {"b", 102, 102}, {"c", 0, 0}, {"c", 0, 0}, {"c", 1, 1}, {"c", 5, 6}, {"a", 1, 102}, {"b", 102, 204}}
 
-	writeBackCache := newWriteBackCache(basicDeviceConfig)
+	writeBackCache := newWriteBackCache(basicDeviceConfig, testRandom())
 	for _, c := range cases {
 		writeBackCache.write(c.path, c.numBytes)
 		if got, want := writeBackCache.getUnwrittenBytes(c.path), c.want; got != want {
@@ -46,7 +46,7 @@ func TestWriteBackCache_Close(t *testing.T) {
 		want     units.NumBytes
 	}{{"a", 101, 101}, {"b", 102, 203}, {"c", 0, 203}, {"c", 0, 203}, {"c", 1, 204}, {"c", 5, 209}, {"a", 1, 210}, {"b", 102, 312}}
 
-	writeBackCache := newWriteBackCache(basicDeviceConfig)
+	writeBackCache := newWriteBackCache(basicDeviceConfig, testRandom())
 	for _, c := range cases {
 		writeBackCache.write(c.path, c.numBytes)
 		writeBackCache.close(c.path)
@@ -124,7 +124,7 @@ func TestWriteBackCache_WriteBack(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		writeBackCache := newWriteBackCache(basicDeviceConfig)
+		writeBackCache := newWriteBackCache(basicDeviceConfig, testRandom())
 		for _, write := range c.writes {
 			writeBackCache.write(write.path, write.numBytes)
 			if write.shouldClose {
@@ -221,7 +221,7 @@ func TestWriteBackCache_WriteBackBytesForFile(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		writeBackCache := newWriteBackCache(c.deviceConfig)
+		writeBackCache := newWriteBackCache(c.deviceConfig, testRandom())
 		writeBackCache.write("a", c.numBytes)
 
 		if got, want := writeBackCache.writeBackBytesForFile("a", c.duration), c.wantDuration; got != want {
@@ -254,7 +254,7 @@ func TestComputeWritableBytes(t *testing.T) {
 		deviceConfig := *basicDeviceConfig
 		deviceConfig.WriteBytesPerSecond = c.bytesPerSecond
 		deviceConfig.SeekTime = c.seekTime
-		writeBackCache := newWriteBackCache(&deviceConfig)
+		writeBackCache := newWriteBackCache(&deviceConfig, testRandom())
 		if got, want := writeBackCache.computeWritableBytes(c.duration), c.want; got != want {
 			t.Errorf("computeWritableBytes(%s, %d, %s) = %d, want %d", c.duration, c.bytesPerSecond, c.seekTime, got, want)
 		}
@@ -266,9 +266,115 @@ func TestSliceShuffle(t *testing.T) {
 	acopy := make([]string, len(a))
 	copy(acopy, a)
 
-	sliceShuffle(acopy)
+	sliceShuffle(acopy, testRandom())
 	sort.Strings(acopy)
 	if !reflect.DeepEqual(a, acopy) {
 		t.Errorf("sliceShuffle failed: %v -> %v", a, acopy)
 	}
 }
+
+func TestWriteBackCache_ThrottledBytes(t *testing.T) {
+	cases := []struct {
+		path     string
+		numBytes units.NumBytes
+		want     units.NumBytes
+	}{{"a", 30, 0}, {"b", 20, 0}, {"a", 10, 10}, {"c", 10, 10}, {"c", 0, 0}}
+
+	writeBackCache := newWriteBackCache(dirtyThrottleDeviceConfig, testRandom())
+	for _, c := range cases {
+		if got, want := writeBackCache.throttledBytes(c.numBytes), c.want; got != want {
+			t.Errorf("throttledBytes(%d) = %d, want %d", c.numBytes, got, want)
+		}
+		writeBackCache.write(c.path, c.numBytes)
+	}
+
+	// Without DirtyBytes nothing is throttled.
+	writeBackCache = newWriteBackCache(writeBackCacheDeviceConfig, testRandom())
+	writeBackCache.write("a", 1000)
+	if got, want := writeBackCache.throttledBytes(1000), units.NumBytes(0); got != want {
+		t.Errorf("throttledBytes(1000) without DirtyBytes = %d, want %d", got, want)
+	}
+}
+
+func TestWriteBackCache_ThrottledBytesPastHighWaterMark(t *testing.T) {
+	cases := []struct {
+		path     string
+		numBytes units.NumBytes
+		want     units.NumBytes
+	}{{"a", 50, 0}, {"b", 10, 2}, {"a", 20, 11}, {"c", 40, 40}}
+
+	writeBackCache := newWriteBackCache(saturatingCacheDeviceConfig, testRandom())
+	for _, c := range cases {
+		got := writeBackCache.throttledBytes(c.numBytes)
+		if got != c.want {
+			t.Errorf("throttledBytes(%d) with %d dirty = %d, want %d", c.numBytes, writeBackCache.getTotalUnwrittenBytes(), got, c.want)
+		}
+		writeBackCache.write(c.path, c.numBytes-got)
+	}
+}
+
+func TestWriteBackCache_WriteBackStopsAtDirtyBackgroundBytes(t *testing.T) {
+	writeBackCache := newWriteBackCache(dirtyThrottleDeviceConfig, testRandom())
+	writeBackCache.write("a", 30)
+	writeBackCache.write("b", 15)
+	writeBackCache.close("b")
+
+	writeBackCache.writeBack(time.Hour)
+	if got, want := writeBackCache.getTotalUnwrittenBytes(), dirtyThrottleDeviceConfig.DirtyBackgroundBytes; got != want {
+		t.Errorf("getTotalUnwrittenBytes() after writeBack = %d, want %d", got, want)
+	}
+
+	writeBackCache.writeBack(time.Hour)
+	if got, want := writeBackCache.getTotalUnwrittenBytes(), dirtyThrottleDeviceConfig.DirtyBackgroundBytes; got != want {
+		t.Errorf("getTotalUnwrittenBytes() after second writeBack = %d, want %d", got, want)
+	}
+}
+
+func TestWriteBackCache_Drain(t *testing.T) {
+	writeBackCache := newWriteBackCache(writeBackCacheDeviceConfig, testRandom())
+	writeBackCache.write("a", 100)
+	writeBackCache.write("b", 50)
+	writeBackCache.write("c", 20)
+	writeBackCache.close("c")
+
+	// Three seeks, plus 170 bytes at 100 bytes per second.
+	if got, want := writeBackCache.drain(), 1730*time.Millisecond; got != want {
+		t.Errorf("drain() = %s, want %s", got, want)
+	}
+	if got, want := writeBackCache.getTotalUnwrittenBytes(), units.NumBytes(0); got != want {
+		t.Errorf("getTotalUnwrittenBytes() after drain = %d, want %d", got, want)
+	}
+	if got, want := writeBackCache.drain(), time.Duration(0); got != want {
+		t.Errorf("drain() of empty cache = %s, want %s", got, want)
+	}
+}
+
+func TestWriteBackCache_WriteBackOrder(t *testing.T) {
+	newCache := func(order slowfs.WriteBackOrder) *writeBackCache {
+		deviceConfig := *writeBackCacheDeviceConfig
+		deviceConfig.WriteBackOrder = order
+		writeBackCache := newWriteBackCache(&deviceConfig, testRandom())
+		writeBackCache.write("b", 30)
+		writeBackCache.write("a", 10)
+		writeBackCache.write("c", 20)
+		writeBackCache.write("a", 5)
+		return writeBackCache
+	}
+
+	if got, want := newCache(slowfs.OldestFirstWriteBack).writeBackOrder(), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("oldest first writeBackOrder() = %v, want %v", got, want)
+	}
+	if got, want := newCache(slowfs.LargestFirstWriteBack).writeBackOrder(), []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("largest first writeBackOrder() = %v, want %v", got, want)
+	}
+
+	// Each stretch of spare time is only long enough to write back part of one file, so they take
+	// turns.
+	roundRobin := newCache(slowfs.RoundRobinWriteBack)
+	for _, want := range [][]string{{"a", "b", "c"}, {"b", "c", "a"}, {"c", "a", "b"}, {"a", "b", "c"}} {
+		if got := roundRobin.writeBackOrder(); !reflect.DeepEqual(got, want) {
+			t.Errorf("round robin writeBackOrder() = %v, want %v", got, want)
+		}
+		roundRobin.writeBack(60 * time.Millisecond)
+	}
+}
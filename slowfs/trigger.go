@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trigger degrades the device once a number of operations of some type have run, for example
+// adding 200ms to every fsync after 10000 writes. Operations are named as in SetOpTimes.
+type Trigger struct {
+	// Op is the operation to count.
+	Op string
+
+	// AfterOps is how many operations of type Op have to run before the trigger fires. With 0,
+	// the extra delays apply from the start.
+	AfterOps uint64
+
+	// ExtraDelay maps operation names to how much longer they take once the trigger has fired.
+	ExtraDelay map[string]time.Duration
+}
+
+func (t Trigger) String() string {
+	delays := make([]string, 0, len(t.ExtraDelay))
+	for op, d := range t.ExtraDelay {
+		delays = append(delays, fmt.Sprintf("%s+%s", op, d))
+	}
+	sort.Strings(delays)
+	return fmt.Sprintf("after %d %s: %s", t.AfterOps, t.Op, strings.Join(delays, ","))
+}
+
+// validate checks that t only refers to operations in knownOps.
+func (t Trigger) validate(knownOps map[string]*time.Duration) error {
+	if _, ok := knownOps[t.Op]; !ok {
+		return fmt.Errorf("trigger %s: unknown operation %q", t, t.Op)
+	}
+	if len(t.ExtraDelay) == 0 {
+		return fmt.Errorf("trigger %s: no extra delays", t)
+	}
+	for op, d := range t.ExtraDelay {
+		if _, ok := knownOps[op]; !ok {
+			return fmt.Errorf("trigger %s: unknown operation %q", t, op)
+		}
+		if d < 0 {
+			return errors.New("trigger extra delays cannot be negative.")
+		}
+	}
+	return nil
+}
+
+// parseTriggers parses the Triggers field of a device config, which is an array of objects like
+// {"Op": "write", "AfterOps": "10000", "ExtraDelay": {"fsync": "200ms"}}.
+func parseTriggers(v interface{}) ([]Trigger, error) {
+	objs, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want array type, got %v", v)
+	}
+
+	triggers := make([]Trigger, 0, len(objs))
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("want object type, got %v", o)
+		}
+
+		t := Trigger{ExtraDelay: make(map[string]time.Duration)}
+		for k, v := range obj {
+			var err error
+			switch k {
+			case "Op":
+				strVal, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: want string type, got %v", k, v)
+				}
+				t.Op = strings.ToLower(strVal)
+			case "AfterOps":
+				strVal, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: want string type, got %v", k, v)
+				}
+				t.AfterOps, err = strconv.ParseUint(strVal, 10, 64)
+			case "ExtraDelay":
+				delays, ok := v.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: want object type, got %v", k, v)
+				}
+				for op, d := range delays {
+					strVal, ok := d.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: %s: want string type, got %v", k, op, d)
+					}
+					t.ExtraDelay[strings.ToLower(op)], err = time.ParseDuration(strVal)
+					if err != nil {
+						break
+					}
+				}
+			default:
+				return nil, fmt.Errorf("spurious trigger field %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		if t.Op == "" {
+			return nil, errors.New("trigger missing Op")
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// ParseTriggerFromString parses a trigger from a comma separated list like
+// "op=write,after=10000,fsync=200ms". Every key other than op and after names an operation which
+// takes longer once the trigger has fired.
+func ParseTriggerFromString(spec string) (Trigger, error) {
+	t := Trigger{ExtraDelay: make(map[string]time.Duration)}
+	for _, entry := range strings.Split(spec, ",") {
+		keyAndValue := strings.SplitN(entry, "=", 2)
+		if len(keyAndValue) != 2 {
+			return Trigger{}, fmt.Errorf("want key=value, got %q", entry)
+		}
+		key := strings.ToLower(strings.TrimSpace(keyAndValue[0]))
+		value := strings.TrimSpace(keyAndValue[1])
+
+		var err error
+		switch key {
+		case "op":
+			t.Op = strings.ToLower(value)
+		case "after":
+			t.AfterOps, err = strconv.ParseUint(value, 10, 64)
+		default:
+			t.ExtraDelay[key], err = time.ParseDuration(value)
+		}
+		if err != nil {
+			return Trigger{}, fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	if t.Op == "" {
+		return Trigger{}, errors.New("trigger missing op")
+	}
+	return t, nil
+}
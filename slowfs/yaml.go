@@ -0,0 +1,372 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The YAML parser here handles the subset of YAML device config files need: block mappings and
+// sequences, flow mappings and sequences like {read: 50ms} and [a, b], plain, single quoted and
+// double quoted scalars, and comments. Every scalar is a string, as every value is in JSON config
+// files, so values parse the same way whichever format they come from. It is hand-written rather
+// than using a YAML library so that slowfs keeps depending on go-fuse alone, and so that a full
+// YAML implementation's type guessing (which turns 010 into 8 and no into false) can't change how
+// a value parses. Anchors, aliases, tags, block scalars, directives, complex keys and multiple
+// documents aren't supported, and are rejected rather than read as plain strings.
+
+// yamlLine is a non-empty line of a YAML document, without its comment.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseYAML parses data into the same types encoding/json would unmarshal the equivalent JSON
+// into, with strings for all scalars.
+func parseYAML(data []byte) (interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (trimmed == "---" && len(lines) == 0) {
+			continue
+		}
+		if strings.HasPrefix(text, "%") {
+			return nil, fmt.Errorf("line %d: directives aren't supported: %s", i+1, text)
+		}
+		if trimmed == "---" || strings.HasPrefix(trimmed, "--- ") || trimmed == "..." {
+			return nil, fmt.Errorf("line %d: multiple documents aren't supported", i+1)
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("empty document")
+	}
+
+	p := &yamlParser{lines: lines}
+	v, err := p.parseNode(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return v, nil
+}
+
+// stripYAMLComment removes a comment, which starts with a # at the start of the line or after a
+// space, outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseNode parses the block node starting at the current line, whose lines are indented by
+// indent.
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok, err := splitYAMLKey(line); err != nil {
+		return nil, err
+	} else if ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLScalar(line.text, line.num)
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			// A sequence indented as much as its key ends at the next key.
+			break
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if item == "" {
+			// The item is the block node on the following lines.
+			p.pos++
+			if p.pos == len(p.lines) || p.lines[p.pos].indent <= indent {
+				return nil, fmt.Errorf("line %d: empty sequence item", line.num)
+			}
+			v, err := p.parseNode(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		// The item starts on the same line, so treat it as a line of its own indented to where
+		// it starts, which is where any further lines of it must be indented to.
+		p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(item), text: item}
+		v, err := p.parseNode(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		key, value, ok, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key: value", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line.num, key)
+		}
+		p.pos++
+
+		if value != "" {
+			if m[key], err = parseYAMLScalar(value, line.num); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// The value is the block node on the following lines. A sequence may be indented as
+		// much as its key.
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			isItem := next.text == "-" || strings.HasPrefix(next.text, "- ")
+			if next.indent > indent || (next.indent == indent && isItem) {
+				if m[key], err = p.parseNode(next.indent); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		m[key] = ""
+	}
+	return m, nil
+}
+
+// splitYAMLKey splits a line like "key: value" into its key and value, returning false if it isn't
+// one.
+func splitYAMLKey(line yamlLine) (key, value string, ok bool, err error) {
+	text := line.text
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("line %d: unterminated string", line.num)
+		}
+		rest := text[end+1:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false, nil
+		}
+		k, err := parseYAMLScalar(text[:end+1], line.num)
+		if err != nil {
+			return "", "", false, err
+		}
+		return k.(string), strings.TrimSpace(rest[1:]), true, nil
+	}
+	if text[0] == '{' || text[0] == '[' {
+		return "", "", false, nil
+	}
+	if err := checkYAMLPlain(text); err != nil {
+		return "", "", false, fmt.Errorf("line %d: %s", line.num, err)
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false, nil
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true, nil
+}
+
+// checkYAMLPlain returns an error if the plain scalar text starts with an indicator of a YAML
+// feature the parser doesn't support, which YAML wouldn't read as a string either.
+func checkYAMLPlain(text string) error {
+	switch text[0] {
+	case '&', '*':
+		return fmt.Errorf("anchors and aliases aren't supported: %s", text)
+	case '!':
+		return fmt.Errorf("tags aren't supported: %s", text)
+	case '|', '>':
+		return fmt.Errorf("block scalars aren't supported, quote the string instead: %s", text)
+	case '%':
+		return fmt.Errorf("directives aren't supported: %s", text)
+	case '?':
+		return fmt.Errorf("complex keys aren't supported: %s", text)
+	case '@', '`':
+		return fmt.Errorf("%c is reserved and can't start a plain string, quote it instead: %s", text[0], text)
+	}
+	return nil
+}
+
+// closingQuote returns the index of the quote closing the string text starts with, or -1.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar parses a value given on one line: a quoted or plain string, or a flow mapping or
+// sequence.
+func parseYAMLScalar(text string, num int) (interface{}, error) {
+	if text[0] == '{' || text[0] == '[' {
+		v, rest, err := parseYAMLFlow(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", num, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %d: unexpected %q after %s", num, rest, text[:len(text)-len(rest)])
+		}
+		return v, nil
+	}
+	if text[0] != '"' && text[0] != '\'' {
+		if err := checkYAMLPlain(text); err != nil {
+			return nil, fmt.Errorf("line %d: %s", num, err)
+		}
+		return text, nil
+	}
+	if closingQuote(text) != len(text)-1 {
+		return nil, fmt.Errorf("line %d: bad string %s", num, text)
+	}
+	s, err := unquoteYAML(text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s", num, err)
+	}
+	return s, nil
+}
+
+// unquoteYAML returns the string text quotes, which must be all of text.
+func unquoteYAML(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	s, err := strconv.Unquote(text)
+	if err != nil {
+		return "", fmt.Errorf("bad string %s", text)
+	}
+	return s, nil
+}
+
+// parseYAMLFlow parses the flow mapping, flow sequence or scalar text starts with, returning it
+// and what follows it.
+func parseYAMLFlow(text string) (interface{}, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", errors.New("missing value")
+	}
+	switch text[0] {
+	case '{', '[':
+		closing := byte('}')
+		if text[0] == '[' {
+			closing = ']'
+		}
+		m := make(map[string]interface{})
+		seq := []interface{}{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, string(closing)) {
+			item, after, err := parseYAMLFlow(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			if closing == '}' {
+				key, ok := item.(string)
+				after = strings.TrimLeft(after, " ")
+				if !ok || !strings.HasPrefix(after, ":") {
+					return nil, "", fmt.Errorf("want key: value in %s", text)
+				}
+				if item, after, err = parseYAMLFlow(after[1:]); err != nil {
+					return nil, "", err
+				}
+				m[key] = item
+			} else {
+				seq = append(seq, item)
+			}
+			rest = strings.TrimLeft(after, " ")
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, string(closing)) {
+				return nil, "", fmt.Errorf("missing %c in %s", closing, text)
+			}
+		}
+		if closing == '}' {
+			return m, rest[1:], nil
+		}
+		return seq, rest[1:], nil
+	case '"', '\'':
+		end := closingQuote(text)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string in %s", text)
+		}
+		v, err := unquoteYAML(text[:end+1])
+		return v, text[end+1:], err
+	}
+	end := strings.IndexAny(text, ",]}")
+	if end < 0 {
+		end = len(text)
+	}
+	plain := text[:end]
+	if err := checkYAMLPlain(plain); plain != "" && err != nil {
+		return nil, "", err
+	}
+	// A colon followed by a space ends a key.
+	if i := strings.Index(plain, ": "); i >= 0 {
+		end = i
+	} else if strings.HasSuffix(plain, ":") {
+		end--
+	}
+	return strings.TrimSpace(text[:end]), text[end:], nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	cases := []struct {
+		yaml      string
+		want      interface{}
+		shouldErr bool
+	}{
+		{"a", "a", false},
+		{"'it''s'", "it's", false},
+		{`"a\tb" # comment`, "a\tb", false},
+		{"a#b", "a#b", false},
+		{"- a\n- 'b # c'", []interface{}{"a", "b # c"}, false},
+		{"a: 1\nb:\n  c: 2\n", map[string]interface{}{"a": "1", "b": map[string]interface{}{"c": "2"}}, false},
+		{"a:\n- 1\n- 2\nb: 3", map[string]interface{}{"a": []interface{}{"1", "2"}, "b": "3"}, false},
+		{"- a: 1\n  b: 2\n-\n  - 3", []interface{}{map[string]interface{}{"a": "1", "b": "2"}, []interface{}{"3"}}, false},
+		{"a: {b: [1, '2'], c: 3ms}", map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{"1", "2"}, "c": "3ms"}}, false},
+		{"a:", map[string]interface{}{"a": ""}, false},
+		{"", nil, true},
+		{"a: 1\na: 2", nil, true},
+		{"a: 1\n  b: 2", nil, true},
+		{"- a\nb: c", nil, true},
+		{"a: [1, 2", nil, true},
+		{"a: {b}", nil, true},
+		{"a: 'b", nil, true},
+		{"a:\n\t- b", nil, true},
+		{"---\na: 1", map[string]interface{}{"a": "1"}, false},
+		{"a: '&b'", map[string]interface{}{"a": "&b"}, false},
+		{"a: b&c", map[string]interface{}{"a": "b&c"}, false},
+	}
+
+	for _, c := range cases {
+		got, err := parseYAML([]byte(c.yaml))
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("parseYAML(%q) = %v, should error", c.yaml, got)
+			}
+		} else if err != nil {
+			t.Errorf("parseYAML(%q) error: %s", c.yaml, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseYAML(%q) = %#v, want %#v", c.yaml, got, c.want)
+		}
+	}
+}
+
+func TestParseYAML_Unsupported(t *testing.T) {
+	cases := []struct {
+		yaml    string
+		wantErr string
+	}{
+		{"a: &x 1\nb: *x", "line 1: anchors and aliases aren't supported"},
+		{"a: 1\nb: *x", "line 2: anchors and aliases aren't supported"},
+		{"a: !!str 1", "tags aren't supported"},
+		{"a: |\n  multi\n  line", "block scalars aren't supported"},
+		{"a: >\n  folded", "block scalars aren't supported"},
+		{"%YAML 1.2\n---\na: 1", "directives aren't supported"},
+		{"? a\n: 1", "complex keys aren't supported"},
+		{"a: 1\n---\nb: 2", "line 2: multiple documents aren't supported"},
+		{"a: 1\n...", "multiple documents aren't supported"},
+		{"a: [1, *x]", "anchors and aliases aren't supported"},
+		{"a: {b: !t 1}", "tags aren't supported"},
+		{"a: @b", "@ is reserved"},
+	}
+
+	for _, c := range cases {
+		got, err := parseYAML([]byte(c.yaml))
+		if err == nil {
+			t.Errorf("parseYAML(%q) = %#v, want an error containing %q", c.yaml, got, c.wantErr)
+		} else if !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("parseYAML(%q) error %q, want it to contain %q", c.yaml, err, c.wantErr)
+		}
+	}
+}